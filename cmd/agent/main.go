@@ -0,0 +1,165 @@
+// Command agent connects a Docker daemon to a docker-web server that cannot reach it
+// directly. It dials out to the server over a WebSocket and serves the daemon's API
+// through that tunnel, so the host only needs outbound access.
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/gorilla/websocket"
+
+	"github.com/Nebula-work/docker-web/internal/tunnel"
+)
+
+const (
+	minBackoff = time.Second
+	maxBackoff = time.Minute
+)
+
+func main() {
+	server := os.Getenv("DOCKER_WEB_URL")
+	name := os.Getenv("AGENT_NAME")
+	token := os.Getenv("AGENT_TOKEN")
+	if server == "" || name == "" || token == "" {
+		log.Fatal("DOCKER_WEB_URL, AGENT_NAME and AGENT_TOKEN must be set")
+	}
+	connectURL, err := agentURL(server, name)
+	if err != nil {
+		log.Fatalf("invalid DOCKER_WEB_URL: %v", err)
+	}
+	dockerHost := os.Getenv(client.EnvOverrideHost)
+	if dockerHost == "" {
+		dockerHost = client.DefaultDockerHost
+	}
+	dialDocker, err := dockerDialer(dockerHost)
+	if err != nil {
+		log.Fatalf("invalid %s: %v", client.EnvOverrideHost, err)
+	}
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	sessions := make(chan *tunnel.Session, 1)
+	go func() {
+		backoff := minBackoff
+		for {
+			start := time.Now()
+			err := serve(connectURL, token, dialDocker, sessions)
+			if time.Since(start) > maxBackoff {
+				backoff = minBackoff // the last session was healthy for a while
+			}
+			log.Printf("tunnel closed: %v; reconnecting in %s", err, backoff)
+			time.Sleep(backoff)
+			backoff = min(backoff*2, maxBackoff)
+		}
+	}()
+
+	<-quit
+	select {
+	case sess := <-sessions:
+		sess.Close()
+	default:
+	}
+	log.Println("agent stopped")
+}
+
+// serve runs one tunnel session until it ends, proxying every stream to the daemon.
+func serve(connectURL, token string, dialDocker func() (net.Conn, error), sessions chan *tunnel.Session) error {
+	header := http.Header{"Authorization": {"Bearer " + token}}
+	conn, resp, err := websocket.DefaultDialer.Dial(connectURL, header)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusUnauthorized {
+			return errors.New("server rejected the agent name or token")
+		}
+		return err
+	}
+	sess := tunnel.New(conn, false)
+	defer sess.Close()
+	// keep only the current session for shutdown
+	select {
+	case <-sessions:
+	default:
+	}
+	sessions <- sess
+	log.Printf("connected to %s", connectURL)
+
+	for {
+		st, err := sess.Accept()
+		if err != nil {
+			return err
+		}
+		go proxy(st, dialDocker)
+	}
+}
+
+// proxy copies a tunnel stream to a new daemon connection and back, passing half-closes
+// through so hijacked exec sessions see the end of input.
+func proxy(st *tunnel.Stream, dialDocker func() (net.Conn, error)) {
+	defer st.Close()
+	dc, err := dialDocker()
+	if err != nil {
+		log.Printf("dial docker: %v", err)
+		return
+	}
+	defer dc.Close()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := io.Copy(dc, st); err != nil {
+			// the server dropped the stream; don't wait for the daemon to finish writing
+			dc.Close()
+			return
+		}
+		if cw, ok := dc.(interface{ CloseWrite() error }); ok {
+			_ = cw.CloseWrite()
+		}
+	}()
+	_, _ = io.Copy(st, dc)
+	_ = st.CloseWrite()
+	<-done
+}
+
+// agentURL turns the server's base URL into the WebSocket URL of its agent endpoint.
+func agentURL(server, name string) (string, error) {
+	u, err := url.Parse(strings.TrimSuffix(server, "/"))
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "http", "ws":
+		u.Scheme = "ws"
+	case "https", "wss":
+		u.Scheme = "wss"
+	default:
+		return "", errors.New("scheme must be http or https")
+	}
+	u.Path += "/api/v1/agent/connect"
+	u.RawQuery = url.Values{"host": {name}}.Encode()
+	return u.String(), nil
+}
+
+// dockerDialer connects to the local daemon at host, a unix:// or tcp:// address.
+func dockerDialer(host string) (func() (net.Conn, error), error) {
+	u, err := client.ParseHostURL(host)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "unix":
+		return func() (net.Conn, error) { return net.Dial("unix", u.Host) }, nil
+	case "tcp":
+		return func() (net.Conn, error) { return net.Dial("tcp", u.Host) }, nil
+	default:
+		return nil, errors.New("only unix and tcp daemons are supported")
+	}
+}
@@ -2,15 +2,23 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/Nebula-work/docker-web/internal/api"
+	"github.com/Nebula-work/docker-web/internal/audit"
+	"github.com/Nebula-work/docker-web/internal/auth"
+	"github.com/Nebula-work/docker-web/internal/backups"
+	"github.com/Nebula-work/docker-web/internal/credentials"
 	"github.com/Nebula-work/docker-web/internal/docker"
+	"github.com/Nebula-work/docker-web/internal/jobs"
 	"github.com/Nebula-work/docker-web/internal/utils"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -26,9 +34,62 @@ func main() {
 		log.Fatalf("failed to create docker client: %v", err)
 	}
 
+	dataDir := os.Getenv("DATA_DIR")
+	if dataDir == "" {
+		dataDir = "data"
+	}
+	users, tokens, err := setupAuth(dataDir)
+	if err != nil {
+		log.Fatalf("auth setup failed: %v", err)
+	}
+
+	auditLog, err := audit.Open(filepath.Join(dataDir, "audit.log"))
+	if err != nil {
+		log.Fatalf("failed to open audit log: %v", err)
+	}
+	defer auditLog.Close()
+
+	credKey, err := credentials.Key(os.Getenv("CREDENTIALS_KEY"), filepath.Join(dataDir, "credentials.key"))
+	if err != nil {
+		log.Fatalf("failed to load credential key: %v", err)
+	}
+	creds, err := credentials.Open(filepath.Join(dataDir, "credentials.enc"), credKey)
+	if err != nil {
+		log.Fatalf("failed to open registry credentials: %v", err)
+	}
+
+	backupDir := os.Getenv("BACKUP_DIR")
+	if backupDir == "" {
+		backupDir = filepath.Join(dataDir, "backups")
+	}
+	volumeBackups, err := backups.Open(backupDir)
+	if err != nil {
+		log.Fatalf("failed to open backup directory: %v", err)
+	}
+
+	hostsFile := os.Getenv("HOSTS_FILE")
+	if hostsFile == "" {
+		hostsFile = filepath.Join(dataDir, "hosts.json")
+	}
+	hosts, err := docker.NewRegistry(hostsFile)
+	if err != nil {
+		log.Fatalf("failed to load docker hosts: %v", err)
+	}
+	defer hosts.Close()
+	if err := hosts.Attach(docker.EnvEndpoint("local"), dCli); err != nil {
+		log.Fatalf("failed to register local docker host: %v", err)
+	}
+	healthCtx, stopHealth := context.WithCancel(context.Background())
+	defer stopHealth()
+	go hosts.Watch(healthCtx, 30*time.Second)
+
+	jobManager := jobs.NewManager(time.Hour)
+	defer jobManager.Shutdown()
+
 	// gin router
 	r := gin.New()
 	r.Use(gin.Recovery())
+	r.Use(api.QueryTokenToHeader())
 	r.Use(gin.Logger())
 
 	// CORS config - read allowed origin from env or default
@@ -46,7 +107,20 @@ func main() {
 		// middleware: max body size 8MB, request timeout 30s
 		apiGroup.Use(api.MaxBodySize(8 << 20))
 		apiGroup.Use(api.RequestTimeout(30 * time.Second))
-		api.RegisterRoutes(apiGroup, dCli)
+		api.RegisterRoutes(apiGroup, api.Config{
+			SecretEnv:          utils.NewSecretMatcher(utils.ParseSecretPatterns(os.Getenv("SECRET_ENV_PATTERNS"))),
+			Jobs:               jobManager,
+			Users:              users,
+			Tokens:             tokens,
+			Audit:              auditLog,
+			Hosts:              hosts,
+			Credentials:        creds,
+			InsecureRegistries: strings.FieldsFunc(os.Getenv("INSECURE_REGISTRIES"), func(r rune) bool { return r == ',' || r == ' ' }),
+			GitRoots:           filepath.SplitList(os.Getenv("GIT_LOCAL_ROOTS")),
+			BindRoots:          filepath.SplitList(os.Getenv("BIND_MOUNT_ROOTS")),
+			Backups:            volumeBackups,
+			HelperImage:        os.Getenv("VOLUME_HELPER_IMAGE"),
+		})
 	}
 
 	// HTTP server with timeouts
@@ -79,3 +153,42 @@ func main() {
 	}
 	log.Println("server exited")
 }
+
+// setupAuth opens the local user store, creating an initial admin account on first start,
+// and builds the token issuer from JWT_SECRET.
+func setupAuth(dataDir string) (*auth.UserStore, *auth.TokenIssuer, error) {
+	users, err := auth.OpenUserStore(filepath.Join(dataDir, "users.json"))
+	if err != nil {
+		return nil, nil, err
+	}
+	if users.Empty() {
+		username := os.Getenv("ADMIN_USERNAME")
+		if username == "" {
+			username = "admin"
+		}
+		password := os.Getenv("ADMIN_PASSWORD")
+		generated := password == ""
+		if generated {
+			password = auth.RandomPassword()
+		}
+		if _, err := users.Create(username, password, auth.RoleAdmin, ""); err != nil {
+			return nil, nil, fmt.Errorf("create initial user: %w", err)
+		}
+		if generated {
+			log.Printf("created initial user %q with password %s - change it after logging in", username, password)
+		} else {
+			log.Printf("created initial user %q", username)
+		}
+	}
+
+	secret := []byte(os.Getenv("JWT_SECRET"))
+	if len(secret) == 0 {
+		log.Println("JWT_SECRET not set; using a random key, sessions will not survive a restart")
+		return users, auth.NewTokenIssuer(auth.RandomSecret(), 15*time.Minute, 7*24*time.Hour), nil
+	}
+	tokens := auth.NewTokenIssuer(secret, 15*time.Minute, 7*24*time.Hour)
+	if err := tokens.LoadRevocations(filepath.Join(dataDir, "revoked-tokens.json")); err != nil {
+		return nil, nil, err
+	}
+	return users, tokens, nil
+}
@@ -0,0 +1,28 @@
+import axiosInstance from "@/api/axiosInstance.ts";
+
+const login=async(username:string,password:string)=>{
+    const response=await axiosInstance.post("/auth/login",{username,password});
+    localStorage.setItem('authToken',response.data.accessToken);
+    localStorage.setItem('refreshToken',response.data.refreshToken);
+    return response.data;
+}
+const refresh=async()=>{
+    const response=await axiosInstance.post("/auth/refresh",{refreshToken:localStorage.getItem('refreshToken')});
+    localStorage.setItem('authToken',response.data.accessToken);
+    localStorage.setItem('refreshToken',response.data.refreshToken);
+    return response.data;
+}
+const logout=async()=>{
+    const refreshToken=localStorage.getItem('refreshToken');
+    localStorage.removeItem('authToken');
+    localStorage.removeItem('refreshToken');
+    if(refreshToken){
+        await axiosInstance.post("/auth/logout",{refreshToken});
+    }
+}
+const getCurrentUser=async()=>{
+    const response=await axiosInstance.get("/auth/me");
+    return response.data;
+}
+
+export {login,refresh,logout,getCurrentUser};
@@ -4,6 +4,10 @@ const getContainers=async()=>{
     const response=await axiosInstance.get("/containers");
     return response.data;
 }
+const createContainer=async(config:object)=>{
+    const response=await axiosInstance.post("/containers",config);
+    return response.data;
+}
 const startContainer=async(containerId:string)=>{
     const response=await axiosInstance.post(`/containers/${containerId}/start`);
     return response.data;
@@ -25,4 +29,4 @@ const getContainerLogs=async(containerId:string)=>{
     return response.data;
 }
 
-export {getContainers,startContainer,stopContainer,restartContainer,deleteContainer,getContainerLogs};
\ No newline at end of file
+export {getContainers,createContainer,startContainer,stopContainer,restartContainer,deleteContainer,getContainerLogs};
\ No newline at end of file
@@ -9,4 +9,48 @@ const deleteImage=async(imageId:string)=>{
     return response.data;
 }
 
-export {getImages,deleteImage};
\ No newline at end of file
+const inspectImage=async(imageId:string)=>{
+    const response=await axiosInstance.get(`/images/${imageId}`);
+    return response.data;
+}
+const getImageHistory=async(imageId:string)=>{
+    const response=await axiosInstance.get(`/images/${imageId}/history`);
+    return response.data;
+}
+// a 202 response carries the analysis job instead of the result, so callers get the status too
+const getImageLayers=async(imageId:string)=>{
+    const response=await axiosInstance.get(`/images/${imageId}/layers`);
+    return response;
+}
+const getImageFiles=async(imageId:string,layer:number,path:string,changes=false)=>{
+    const response=await axiosInstance.get(`/images/${imageId}/files`,{params:{layer,path,changes}});
+    return response;
+}
+const tagImage=async(imageId:string,repository:string,tag:string)=>{
+    const response=await axiosInstance.post(`/images/${imageId}/tag`,{repository,tag});
+    return response.data;
+}
+const pushImage=async(image:string)=>{
+    const response=await axiosInstance.post("/images/push",{image});
+    return response.data;
+}
+const exportImagesUrl=(images:string[],gzip=false)=>{
+    const params=new URLSearchParams();
+    images.slice(1).forEach(image=>params.append("image",image));
+    if(gzip) params.set("gzip","true");
+    // a download link cannot send the Authorization header
+    const token=localStorage.getItem('authToken');
+    if(token) params.set("access_token",token);
+    return `${axiosInstance.defaults.baseURL}/images/${encodeURIComponent(images[0])}/export?${params}`;
+}
+const loadImages=async(archive:File,onUploadProgress?:(percent:number)=>void)=>{
+    const form=new FormData();
+    form.append("image",archive);
+    const response=await axiosInstance.post("/images/load",form,{
+        timeout:0,
+        onUploadProgress:(e)=>onUploadProgress?.(e.total?Math.round(e.loaded*100/e.total):0),
+    });
+    return response.data;
+}
+
+export {getImages,deleteImage,inspectImage,getImageHistory,getImageLayers,getImageFiles,tagImage,pushImage,exportImagesUrl,loadImages};
\ No newline at end of file
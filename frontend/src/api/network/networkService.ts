@@ -4,6 +4,10 @@ const getNetworks=async()=>{
     const response=await axiosInstance.get("/networks");
     return response.data;
 }
+const inspectNetwork=async(networkId:string)=>{
+    const response=await axiosInstance.get(`/networks/${networkId}`);
+    return response.data;
+}
 const deleteNetwork=async(networkId:string)=>{
     const response=await axiosInstance.delete(`/networks/${networkId}`);
     return response.data;
@@ -13,4 +17,4 @@ const createNetwork=async(networkName:string)=>{
     return response.data;
 }
 
-export {getNetworks,deleteNetwork,createNetwork};
\ No newline at end of file
+export {getNetworks,inspectNetwork,deleteNetwork,createNetwork};
\ No newline at end of file
@@ -0,0 +1,17 @@
+import axiosInstance from "@/api/axiosInstance.ts";
+
+const getRegistries=async()=>{
+    const response=await axiosInstance.get("/registries");
+    return response.data;
+}
+// an empty registry signs in to Docker Hub
+const loginRegistry=async(registry:string,username:string,password:string)=>{
+    const response=await axiosInstance.post("/registries/login",{registry,username,password});
+    return response.data;
+}
+const logoutRegistry=async(registry:string)=>{
+    const response=await axiosInstance.delete(`/registries/${encodeURIComponent(registry)}`);
+    return response.data;
+}
+
+export {getRegistries,loginRegistry,logoutRegistry};
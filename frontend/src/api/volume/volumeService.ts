@@ -1,12 +1,63 @@
 import axiosInstance from "@/api/axiosInstance.ts";
 
-const getVolumes=async()=>{
-    const response=await axiosInstance.get("/volumes");
+const getVolumes=async(query?:{driver?:string,label?:string,status?:string,minSize?:number,sort?:string,order?:"asc"|"desc",usage?:boolean})=>{
+    const response=await axiosInstance.get("/volumes",{params:query});
+    return response.data;
+}
+const createVolume=async(volume:{name?:string,driver?:string,driver_opts?:Record<string,string>,labels?:Record<string,string>})=>{
+    const response=await axiosInstance.post("/volumes",volume);
     return response.data;
 }
 const deleteVolume=async(volumeId:string)=>{
     const response=await axiosInstance.delete(`/volumes/${volumeId}`);
     return response.data;
 }
+const backupVolume=async(name:string)=>{
+    const response=await axiosInstance.post(`/volumes/${name}/backup`);
+    return response.data;
+}
+const getVolumeBackups=async(volume?:string)=>{
+    const response=await axiosInstance.get("/volume-backups",{params:{volume}});
+    return response.data;
+}
+const deleteVolumeBackup=async(volume:string,backup:string)=>{
+    const response=await axiosInstance.delete(`/volume-backups/${volume}/${backup}`);
+    return response.data;
+}
+const restoreVolume=async(name:string,backup:{backup:string,volume?:string,replace?:boolean})=>{
+    const response=await axiosInstance.post(`/volumes/${name}/restore`,backup);
+    return response.data;
+}
+const restoreVolumeUpload=async(name:string,archive:File,replace=false)=>{
+    const form=new FormData();
+    form.append("archive",archive);
+    const response=await axiosInstance.post(`/volumes/${name}/restore`,form,{params:{replace},timeout:0});
+    return response.data;
+}
+const copyVolume=async(name:string,copy:{name?:string,host?:string,labels?:Record<string,string>,replace?:boolean})=>{
+    const response=await axiosInstance.post(`/volumes/${name}/copy`,copy);
+    return response.data;
+}
+const getVolumeFiles=async(name:string,path="/")=>{
+    const response=await axiosInstance.get(`/volumes/${name}/files`,{params:{path}});
+    return response.data;
+}
+const volumeFileDownloadUrl=(name:string,path:string)=>{
+    const params=new URLSearchParams({path});
+    // a download link cannot send the Authorization header
+    const token=localStorage.getItem('authToken');
+    if(token) params.set("access_token",token);
+    return `${axiosInstance.defaults.baseURL}/volumes/${name}/files/download?${params}`;
+}
+const uploadVolumeFiles=async(name:string,path:string,files:File[],owner?:{uid?:number,gid?:number})=>{
+    const form=new FormData();
+    files.forEach(file=>form.append("file",file));
+    const response=await axiosInstance.post(`/volumes/${name}/files/upload`,form,{params:{path,...owner},timeout:0});
+    return response.data;
+}
+const deleteVolumeFile=async(name:string,path:string)=>{
+    const response=await axiosInstance.delete(`/volumes/${name}/files`,{params:{path}});
+    return response.data;
+}
 
-export {getVolumes,deleteVolume};
\ No newline at end of file
+export {getVolumes,createVolume,deleteVolume,backupVolume,getVolumeBackups,deleteVolumeBackup,restoreVolume,restoreVolumeUpload,copyVolume,getVolumeFiles,volumeFileDownloadUrl,uploadVolumeFiles,deleteVolumeFile};
\ No newline at end of file
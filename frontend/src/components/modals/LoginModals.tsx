@@ -12,7 +12,10 @@ import {
     Paper,
     Box
 } from "@mantine/core";
+import { notifications } from "@mantine/notifications";
+import { isAxiosError } from "axios";
 import { Container, User, Key } from "lucide-react";
+import { loginRegistry } from "@/api/registry/registryService.ts";
 
 interface LoginModalProps {
     open: boolean;
@@ -27,12 +30,21 @@ export function LoginModal({ open, onOpenChange }: LoginModalProps) {
     const [registryUsername, setRegistryUsername] = useState("");
     const [registryPassword, setRegistryPassword] = useState("");
     const [isLoading, setIsLoading] = useState(false);
+    const [error, setError] = useState<string | null>(null);
 
     const handleLogin = async () => {
         setIsLoading(true);
-        // Simulate login process
-        setTimeout(() => {
-            setIsLoading(false);
+        setError(null);
+        try {
+            // the server checks the login with the registry before storing it
+            const result = loginType === "docker"
+                ? await loginRegistry("", dockerUsername, dockerPassword)
+                : await loginRegistry(registryUrl, registryUsername, registryPassword);
+            notifications.show({
+                title: "Signed in",
+                message: `Logged in to ${result.registry} as ${result.username}`,
+                color: "green",
+            });
             onOpenChange(false);
             // Reset form
             setDockerUsername("");
@@ -40,7 +52,11 @@ export function LoginModal({ open, onOpenChange }: LoginModalProps) {
             setRegistryUrl("");
             setRegistryUsername("");
             setRegistryPassword("");
-        }, 2000);
+        } catch (err) {
+            setError(isAxiosError(err) ? err.response?.data?.detail ?? err.message : String(err));
+        } finally {
+            setIsLoading(false);
+        }
     };
 
     return (
@@ -101,10 +117,10 @@ export function LoginModal({ open, onOpenChange }: LoginModalProps) {
                         />
 
                         <Group justify="space-between">
-                            <Anchor size="sm" href="#">
+                            <Anchor size="sm" href="https://hub.docker.com/reset-password" target="_blank">
                                 Forgot password?
                             </Anchor>
-                            <Anchor size="sm" href="#">
+                            <Anchor size="sm" href="https://app.docker.com/signup" target="_blank">
                                 Create account
                             </Anchor>
                         </Group>
@@ -142,6 +158,12 @@ export function LoginModal({ open, onOpenChange }: LoginModalProps) {
                     </Stack>
                 )}
 
+                {error && (
+                    <Text size="sm" c="red">
+                        {error}
+                    </Text>
+                )}
+
                 <Paper p="md" bg="dark.6" style={{ border: '1px solid var(--mantine-color-dark-4)' }}>
                     <Group gap="xs">
                         <Box
@@ -153,7 +175,7 @@ export function LoginModal({ open, onOpenChange }: LoginModalProps) {
                             }}
                         />
                         <Text size="xs" c="dimmed">
-                            Your credentials are stored securely and used only for Docker operations
+                            Credentials are verified with the registry, stored encrypted on the server and used for pulls, pushes and builds
                         </Text>
                     </Group>
                 </Paper>
@@ -1,4 +1,5 @@
 import { useState } from "react";
+import { isAxiosError } from "axios";
 import {
     Modal,
     Button,
@@ -13,6 +14,7 @@ import {
 } from "@mantine/core";
 import { Container, Plus, X } from "lucide-react";
 import { notifications } from "@mantine/notifications";
+import { createContainer } from "@/api/container/containerService.ts";
 
 interface RunContainerModalProps {
     open: boolean;
@@ -63,14 +65,22 @@ export function RunContainerModal({ open, onOpenChange }: RunContainerModalProps
         environment: prev.environment.filter((_, i) => i !== index)
     }));
 
-    const handleRun = () => {
-        console.log("Running container with config:", containerConfig);
-        notifications.show({
-            title: "Container Started",
-            message: `Container ${containerConfig.name || containerConfig.image} is now running`,
-            color: "green",
-        });
-        onOpenChange(false);
+    const handleRun = async () => {
+        try {
+            await createContainer(containerConfig);
+            notifications.show({
+                title: "Container Started",
+                message: `Container ${containerConfig.name || containerConfig.image} is now running`,
+                color: "green",
+            });
+            onOpenChange(false);
+        } catch (error) {
+            notifications.show({
+                title: "Failed to run container",
+                message: isAxiosError(error) ? error.response?.data?.detail ?? error.message : String(error),
+                color: "red",
+            });
+        }
     };
 
     return (
@@ -2,6 +2,10 @@ import { Paper, Text, Group, Progress, Button, Stack } from "@mantine/core";
 import { StatusBadge } from "@/components/StatusBadge";
 import { Container, Image, HardDrive, Network, Play, Square, Cpu, MemoryStick } from "lucide-react";
 import {useState,useEffect} from "react";
+import { getContainers } from "@/api/container/containerService.ts";
+import { getImages } from "@/api/image/imageService.ts";
+import { getNetworks } from "@/api/network/networkService.ts";
+import { getVolumes } from "@/api/volume/volumeService.ts";
 type RecentContainer = {
     id: string;
     name: string;
@@ -20,14 +24,10 @@ const [stats, setStats] = useState({
 
 useEffect(() => {
     async function fetchStats() {
-        const containersRes = await fetch("http://localhost:9000/api/v1/containers");
-        const containersData = await containersRes.json();
-        const imagesRes = await fetch("http://localhost:9000/api/v1/images");
-        const imagesData = await imagesRes.json();
-        const networksRes = await fetch("http://localhost:9000/api/v1/networks");
-        const networksData = await networksRes.json();
-        const volumesRes = await fetch("http://localhost:9000/api/v1/volumes");
-        const volumesData = await volumesRes.json();
+        const containersData = await getContainers();
+        const imagesData = await getImages();
+        const networksData = await getNetworks();
+        const volumesData = await getVolumes({ usage: false });
         console.log(volumesData.volumes);
 
         setStats({
@@ -37,7 +37,7 @@ useEffect(() => {
                 stopped: containersData.filter((c: any) => c.State === "exited").length,
             },
             images: { total: imagesData.length },
-            volumes: { total: volumesData.Volumes.length }, // Update if you have a volumes API
+            volumes: { total: volumesData.volumes.length },
             networks: { total: networksData.length },
         });
         setContainers(containersData);
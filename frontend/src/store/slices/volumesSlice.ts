@@ -1,13 +1,26 @@
 import { createSlice, createAsyncThunk } from '@reduxjs/toolkit';
 import {getVolumes} from "@/api/volume/volumeService.ts";
 
-export interface Volume {
+export interface VolumeContainer {
     id: string;
+    name: string;
+    state: string;
+    destination: string;
+    readOnly: boolean;
+}
+
+export interface Volume {
     name: string;
     driver: string;
-    mountPoint: string;
-    created: string;
-    size: string;
+    scope: string;
+    mountpoint: string;
+    createdAt: string;
+    labels: Record<string, string> | null;
+    options: Record<string, string> | null;
+    // -1 when the daemon cannot tell
+    size: number;
+    status: 'in-use' | 'idle' | 'orphaned';
+    containers: VolumeContainer[];
 }
 
 interface VolumesState {
@@ -25,7 +38,8 @@ const initialState: VolumesState = {
 export const fetchVolumes = createAsyncThunk(
     'volumes/fetchVolumes',
     async () => {
-        return await getVolumes();
+        const list = await getVolumes();
+        return list.volumes;
     }
 );
 
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Nebula-work/docker-web/internal/docker"
+	"github.com/Nebula-work/docker-web/internal/tunnel"
+)
+
+// ConnectAgent accepts the tunnel WebSocket of an agent. The agent names its host in the
+// host query parameter and authenticates with the host's agent token as a bearer token.
+// While connected, the host's Docker API is served through the tunnel.
+func ConnectAgent(c *gin.Context, cfg Config) {
+	name := c.Query("host")
+	token, _ := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if err := cfg.Hosts.VerifyAgent(name, token); err != nil {
+		writeAPIError(c, http.StatusUnauthorized, "Agent authentication failed", "")
+		return
+	}
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+	sess := tunnel.New(conn, true)
+	defer sess.Close()
+	cli, err := docker.NewDialerClient(func(ctx context.Context) (net.Conn, error) { return sess.Open() })
+	if err != nil {
+		log.Printf("agent %s: %v", name, err)
+		return
+	}
+	defer cli.Close()
+	if err := cfg.Hosts.ConnectAgent(name, token, cli, func() { sess.Close() }); err != nil {
+		// the host was removed while the connection was being upgraded
+		return
+	}
+	log.Printf("agent %s connected from %s", name, c.ClientIP())
+	<-sess.Done()
+	cfg.Hosts.DisconnectAgent(name, cli)
+	if err := sess.Err(); err != nil && !errors.Is(err, tunnel.ErrClosed) {
+		log.Printf("agent %s disconnected: %v", name, err)
+	} else {
+		log.Printf("agent %s disconnected", name)
+	}
+}
@@ -0,0 +1,303 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Nebula-work/docker-web/internal/audit"
+	"github.com/Nebula-work/docker-web/internal/jobs"
+	"github.com/Nebula-work/docker-web/internal/utils"
+)
+
+const (
+	// ctxAuditTarget lets a handler name the resource it acted on when the route has no :id.
+	ctxAuditTarget = "auditTarget"
+	// ctxAuditJob holds the background job a request started, set by acceptJob.
+	ctxAuditJob = "auditJob"
+	// maxAuditBody is the largest JSON request body copied into an audit entry.
+	maxAuditBody = 64 * 1024
+	// maxAuditError bounds how much of an error response is kept to explain a failure.
+	maxAuditError = 4 * 1024
+)
+
+// credentialKeys are masked in audit entries whatever SECRET_ENV_PATTERNS says, as login,
+// user, registry and pull/push bodies carry passwords under these names.
+var credentialKeys = []string{"password", "passwd", "passphrase", "secret", "token", "credential"}
+
+// isAuditSecret reports whether values under key are kept out of the audit log.
+func isAuditSecret(key string, secrets *utils.SecretMatcher) bool {
+	lower := strings.ToLower(key)
+	for _, k := range credentialKeys {
+		if strings.Contains(lower, k) {
+			return true
+		}
+	}
+	return secrets.IsSecret(key)
+}
+
+func setAuditTarget(c *gin.Context, target string) {
+	c.Set(ctxAuditTarget, target)
+}
+
+// audited records the request in the audit log once the handler chain has finished,
+// including requests rejected by permission checks. It is a no-op without an audit log.
+func audited(cfg Config, action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if cfg.Audit == nil {
+			return
+		}
+		start := time.Now()
+		params := auditParams(c, cfg.SecretEnv)
+		w := &auditWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+
+		c.Next()
+
+		e := audit.Entry{
+			Time:       start.UTC(),
+			User:       c.GetString(ctxUser),
+			ClientIP:   c.ClientIP(),
+			Action:     action,
+			Target:     c.GetString(ctxAuditTarget),
+			Method:     c.Request.Method,
+			Path:       c.Request.URL.Path,
+			Params:     params,
+			Status:     c.Writer.Status(),
+			Result:     audit.ResultSuccess,
+			DurationMs: time.Since(start).Milliseconds(),
+		}
+		if e.Target == "" {
+			for _, key := range []string{"id", "name", "username", "host"} {
+				if v := c.Param(key); v != "" {
+					e.Target = v
+					break
+				}
+			}
+		}
+		if e.Status >= http.StatusBadRequest {
+			e.Result = audit.ResultFailure
+			e.Error = w.errorText()
+		}
+		v, _ := c.Get(ctxAuditJob)
+		job, _ := v.(*jobs.Job)
+		if job != nil && e.Result == audit.ResultSuccess {
+			e.Result = audit.ResultAccepted
+			e.Job = job.ID()
+		}
+		if err := cfg.Audit.Append(e); err != nil {
+			log.Printf("audit: %v", err)
+		}
+		if e.Result == audit.ResultAccepted {
+			go auditJobOutcome(cfg.Audit, e, job)
+		}
+	}
+}
+
+// auditJobOutcome appends the entry that closes an accepted request once its job has finished.
+func auditJobOutcome(l *audit.Log, accepted audit.Entry, job *jobs.Job) {
+	<-job.Done()
+	s := job.Snapshot()
+	e := accepted
+	// the request's parameters are already on the accepted entry
+	e.ID, e.Params = "", nil
+	e.Result = audit.ResultSuccess
+	if s.Status != jobs.StatusSucceeded {
+		e.Result = audit.ResultFailure
+		e.Error = s.Error
+	}
+	e.Time = s.FinishedAt.UTC()
+	e.DurationMs = s.FinishedAt.Sub(accepted.Time).Milliseconds()
+	if err := l.Append(e); err != nil {
+		log.Printf("audit: %v", err)
+	}
+}
+
+// auditParams collects route parameters, query parameters and a small JSON body, with
+// secret-looking values masked.
+func auditParams(c *gin.Context, secrets *utils.SecretMatcher) map[string]any {
+	params := map[string]any{}
+	for _, p := range c.Params {
+		params[p.Key] = p.Value
+	}
+	for k, v := range c.Request.URL.Query() {
+		if isAuditSecret(k, secrets) {
+			params[k] = utils.MaskedValue
+		} else if len(v) == 1 {
+			params[k] = v[0]
+		} else {
+			params[k] = v
+		}
+	}
+	if c.Request.Body != nil && strings.HasPrefix(c.ContentType(), "application/json") {
+		buf, err := io.ReadAll(io.LimitReader(c.Request.Body, maxAuditBody+1))
+		// put back what was read so the handler still sees the whole body
+		c.Request.Body = readCloser{io.MultiReader(bytes.NewReader(buf), c.Request.Body), c.Request.Body}
+		if err == nil && len(buf) <= maxAuditBody {
+			var body any
+			if json.Unmarshal(buf, &body) == nil {
+				params["body"] = maskSecrets(body, secrets)
+			}
+		}
+	}
+	if len(params) == 0 {
+		return nil
+	}
+	return params
+}
+
+// auditWriter keeps the start of error responses so the entry can say why a request failed.
+type auditWriter struct {
+	gin.ResponseWriter
+	body []byte
+}
+
+func (w *auditWriter) Write(b []byte) (int, error) {
+	if w.Status() >= http.StatusBadRequest && len(w.body) < maxAuditError {
+		w.body = append(w.body, b[:min(len(b), maxAuditError-len(w.body))]...)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *auditWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Unwrap lets http.ResponseController reach the underlying connection.
+func (w *auditWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// errorText extracts the message from either an APIError body or a {"error": ...} body.
+func (w *auditWriter) errorText() string {
+	var body struct {
+		APIError
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(w.body, &body) != nil {
+		return strings.TrimSpace(string(w.body))
+	}
+	switch {
+	case body.Error != "":
+		return body.Error
+	case body.Detail != "":
+		return body.Message + ": " + body.Detail
+	default:
+		return body.Message
+	}
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// maskSecrets masks values stored under credential or secret-looking keys, and the value
+// of {"key": ..., "value": ...} pairs whose key looks secret (as sent for env vars).
+func maskSecrets(v any, secrets *utils.SecretMatcher) any {
+	switch t := v.(type) {
+	case map[string]any:
+		if k, ok := t["key"].(string); ok && isAuditSecret(k, secrets) {
+			if _, ok := t["value"]; ok {
+				t["value"] = utils.MaskedValue
+			}
+		}
+		for k, inner := range t {
+			if isAuditSecret(k, secrets) {
+				t[k] = utils.MaskedValue
+			} else {
+				t[k] = maskSecrets(inner, secrets)
+			}
+		}
+		return t
+	case []any:
+		for i := range t {
+			t[i] = maskSecrets(t[i], secrets)
+		}
+		return t
+	default:
+		return v
+	}
+}
+
+// QueryAudit returns audit entries, newest first. Query parameters: user, action (prefix),
+// target, result, since, until (RFC 3339), limit (default 100, max 1000) and offset.
+func QueryAudit(c *gin.Context, cfg Config) {
+	f, err := auditFilter(c)
+	if err != nil {
+		writeAPIError(c, http.StatusBadRequest, "Invalid audit filter", err.Error())
+		return
+	}
+	f.Limit, f.Offset = 100, 0
+	if v := c.Query("limit"); v != "" {
+		if f.Limit, err = strconv.Atoi(v); err != nil || f.Limit < 1 || f.Limit > 1000 {
+			writeAPIError(c, http.StatusBadRequest, "Invalid audit filter", "limit must be between 1 and 1000")
+			return
+		}
+	}
+	if v := c.Query("offset"); v != "" {
+		if f.Offset, err = strconv.Atoi(v); err != nil || f.Offset < 0 {
+			writeAPIError(c, http.StatusBadRequest, "Invalid audit filter", "offset must be a non-negative number")
+			return
+		}
+	}
+	entries, total, err := cfg.Audit.Query(f)
+	if err != nil {
+		writeAPIError(c, http.StatusInternalServerError, "Failed to read audit log", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"total": total, "entries": entries})
+}
+
+// ExportAudit streams every matching entry as a CSV or NDJSON download (?format=csv|ndjson).
+func ExportAudit(c *gin.Context, cfg Config) {
+	f, err := auditFilter(c)
+	if err != nil {
+		writeAPIError(c, http.StatusBadRequest, "Invalid audit filter", err.Error())
+		return
+	}
+	format := c.DefaultQuery("format", "ndjson")
+	contentType := map[string]string{"csv": "text/csv", "ndjson": "application/x-ndjson"}[format]
+	if contentType == "" {
+		writeAPIError(c, http.StatusBadRequest, "Invalid export format", "format must be csv or ndjson")
+		return
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="audit-%s.%s"`, time.Now().UTC().Format("20060102-150405"), format))
+	c.Status(http.StatusOK)
+	if err := cfg.Audit.Export(c.Writer, format, f); err != nil {
+		log.Printf("audit export: %v", err)
+	}
+}
+
+func auditFilter(c *gin.Context) (audit.Filter, error) {
+	f := audit.Filter{
+		User:   c.Query("user"),
+		Action: c.Query("action"),
+		Target: c.Query("target"),
+		Result: c.Query("result"),
+	}
+	switch f.Result {
+	case "", audit.ResultSuccess, audit.ResultFailure, audit.ResultAccepted:
+	default:
+		return f, fmt.Errorf("result must be %s, %s or %s", audit.ResultSuccess, audit.ResultFailure, audit.ResultAccepted)
+	}
+	for name, dst := range map[string]*time.Time{"since": &f.Since, "until": &f.Until} {
+		if v := c.Query(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return f, fmt.Errorf("%s must be an RFC 3339 time", name)
+			}
+			*dst = t
+		}
+	}
+	return f, nil
+}
@@ -0,0 +1,204 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Nebula-work/docker-web/internal/auth"
+)
+
+// ctxUser holds the authenticated username on the gin context.
+const ctxUser = "user"
+
+type LoginRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword" binding:"required"`
+	NewPassword     string `json:"newPassword" binding:"required"`
+}
+
+type LoginResponse struct {
+	auth.TokenPair
+	User UserInfo `json:"user"`
+}
+
+// UserInfo is the public view of a user.
+type UserInfo struct {
+	Username  string    `json:"username"`
+	Role      auth.Role `json:"role"`
+	Selector  string    `json:"selector,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func newUserInfo(u auth.User) UserInfo {
+	return UserInfo{Username: u.Username, Role: u.Role, Selector: u.Selector, CreatedAt: u.CreatedAt}
+}
+
+func Login(c *gin.Context, cfg Config) {
+	var req LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeAPIError(c, http.StatusBadRequest, "Invalid login request", err.Error())
+		return
+	}
+	setAuditTarget(c, req.Username)
+	user, ok := authenticate(c, cfg, req.Username, req.Password, "Invalid username or password")
+	if !ok {
+		return
+	}
+	tokens, err := cfg.Tokens.Issue(user.Username)
+	if err != nil {
+		writeAPIError(c, http.StatusInternalServerError, "Failed to issue token", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, LoginResponse{TokenPair: tokens, User: newUserInfo(user)})
+}
+
+// RefreshToken exchanges a refresh token for a new token pair. The old refresh token is revoked,
+// and tokens issued before the user's last password change are refused.
+func RefreshToken(c *gin.Context, cfg Config) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeAPIError(c, http.StatusBadRequest, "Invalid refresh request", err.Error())
+		return
+	}
+	claims, err := cfg.Tokens.Refresh(req.RefreshToken)
+	if err != nil {
+		writeAPIError(c, http.StatusUnauthorized, "Invalid refresh token", "")
+		return
+	}
+	user, err := cfg.Users.Get(claims.Subject)
+	if err != nil || claims.IssuedAt == nil || user.IssuedBeforePasswordChange(claims.IssuedAt.Time) {
+		writeAPIError(c, http.StatusUnauthorized, "Invalid refresh token", "")
+		return
+	}
+	tokens, err := cfg.Tokens.Issue(user.Username)
+	if err != nil {
+		writeAPIError(c, http.StatusInternalServerError, "Failed to issue token", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, LoginResponse{TokenPair: tokens, User: newUserInfo(user)})
+}
+
+// Logout revokes the given refresh token. Access tokens stay valid until they expire.
+func Logout(c *gin.Context, cfg Config) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeAPIError(c, http.StatusBadRequest, "Invalid logout request", err.Error())
+		return
+	}
+	cfg.Tokens.Revoke(req.RefreshToken)
+	c.JSON(http.StatusOK, gin.H{"message": "logged out"})
+}
+
+func CurrentUser(c *gin.Context, cfg Config) {
+	user, err := cfg.Users.Get(c.GetString(ctxUser))
+	if err != nil {
+		writeAPIError(c, http.StatusUnauthorized, "Unknown user", "")
+		return
+	}
+	c.JSON(http.StatusOK, newUserInfo(user))
+}
+
+// ChangePassword sets the caller's password. Every refresh token issued to them is revoked,
+// so other sessions end when their access token expires, and the response carries a new
+// token pair for this one.
+func ChangePassword(c *gin.Context, cfg Config) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeAPIError(c, http.StatusBadRequest, "Invalid password change request", err.Error())
+		return
+	}
+	username := c.GetString(ctxUser)
+	user, ok := authenticate(c, cfg, username, req.CurrentPassword, "Current password is incorrect")
+	if !ok {
+		return
+	}
+	if err := cfg.Users.SetPassword(username, req.NewPassword); err != nil {
+		writeAPIError(c, http.StatusBadRequest, "Failed to change password", err.Error())
+		return
+	}
+	cfg.Tokens.RevokeUser(username)
+	tokens, err := cfg.Tokens.Issue(username)
+	if err != nil {
+		writeAPIError(c, http.StatusInternalServerError, "Failed to issue token", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, LoginResponse{TokenPair: tokens, User: newUserInfo(user)})
+}
+
+// authenticate checks a password, answering 429 while too many recent attempts for the user
+// have failed and 401 with message when it is wrong.
+func authenticate(c *gin.Context, cfg Config, username, password, message string) (auth.User, bool) {
+	if wait := cfg.Logins.Wait(username, c.ClientIP()); wait > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		writeAPIError(c, http.StatusTooManyRequests, "Too many failed attempts", "try again in "+wait.Round(time.Second).String())
+		return auth.User{}, false
+	}
+	user, err := cfg.Users.Authenticate(username, password)
+	if err != nil {
+		cfg.Logins.Fail(username, c.ClientIP())
+		writeAPIError(c, http.StatusUnauthorized, message, "")
+		return auth.User{}, false
+	}
+	cfg.Logins.Succeed(username, c.ClientIP())
+	return user, true
+}
+
+// RequireAuth rejects requests without a valid access token and stores the username on the context.
+func RequireAuth(cfg Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok || token == "" {
+			c.Header("WWW-Authenticate", `Bearer realm="docker-web"`)
+			writeAPIError(c, http.StatusUnauthorized, "Authentication required", "")
+			return
+		}
+		claims, err := cfg.Tokens.ParseAccess(token)
+		if err != nil {
+			c.Header("WWW-Authenticate", `Bearer realm="docker-web", error="invalid_token"`)
+			writeAPIError(c, http.StatusUnauthorized, "Invalid or expired token", "")
+			return
+		}
+		// looked up on every request so role changes and deletions apply immediately
+		user, err := cfg.Users.Get(claims.Subject)
+		if err != nil {
+			writeAPIError(c, http.StatusUnauthorized, "Unknown user", "")
+			return
+		}
+		c.Set(ctxUser, user.Username)
+		c.Set(ctxAccount, user)
+		c.Next()
+	}
+}
+
+// QueryTokenToHeader moves an access_token query parameter into the Authorization header.
+// Browsers cannot set headers on WebSocket and EventSource requests or download links, so those
+// clients pass the token in the URL instead. It must run before the request logger so the token is never logged.
+func QueryTokenToHeader() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		q := c.Request.URL.Query()
+		token := q.Get("access_token")
+		if token == "" {
+			c.Next()
+			return
+		}
+		q.Del("access_token")
+		c.Request.URL.RawQuery = q.Encode()
+		if c.GetHeader("Authorization") == "" {
+			c.Request.Header.Set("Authorization", "Bearer "+token)
+		}
+		c.Next()
+	}
+}
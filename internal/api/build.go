@@ -0,0 +1,253 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/build"
+	"github.com/gin-gonic/gin"
+
+	"github.com/Nebula-work/docker-web/internal/docker"
+	"github.com/Nebula-work/docker-web/internal/jobs"
+	"github.com/Nebula-work/docker-web/internal/utils"
+)
+
+const (
+	// maxBuildContextSize bounds uploaded build context archives.
+	maxBuildContextSize = 4 << 30
+	// maxBuildField bounds each non-file field of a multipart build request.
+	maxBuildField = 64 * 1024
+)
+
+// BuildOptions are the build settings shared by every kind of build request.
+type BuildOptions struct {
+	Tag       string            `json:"tag" binding:"required"`
+	BuildArgs map[string]string `json:"buildArgs"`
+	Target    string            `json:"target"`
+	Labels    map[string]string `json:"labels"`
+	NoCache   bool              `json:"noCache"`
+	Pull      bool              `json:"pull"`
+	Platform  string            `json:"platform"`
+}
+
+var platformPattern = regexp.MustCompile(`^[a-z0-9]+/[a-z0-9_]+(/[a-z0-9]+)?$`)
+
+func (o BuildOptions) validate() error {
+	if strings.TrimSpace(o.Tag) == "" {
+		return fmt.Errorf("tag is required")
+	}
+	if o.Platform != "" && !platformPattern.MatchString(o.Platform) {
+		return fmt.Errorf("platform %q must look like os/arch[/variant]", o.Platform)
+	}
+	for k := range o.BuildArgs {
+		if k == "" || strings.ContainsAny(k, "= \t\n") {
+			return fmt.Errorf("invalid build arg name %q", k)
+		}
+	}
+	return nil
+}
+
+// toDocker builds the daemon options; dockerfile is the Dockerfile's path inside the context.
+func (o BuildOptions) toDocker(dockerfile string) build.ImageBuildOptions {
+	args := make(map[string]*string, len(o.BuildArgs))
+	for k, v := range o.BuildArgs {
+		args[k] = &v
+	}
+	return build.ImageBuildOptions{
+		Tags:        []string{o.Tag},
+		Dockerfile:  dockerfile,
+		BuildArgs:   args,
+		Target:      o.Target,
+		Labels:      o.Labels,
+		NoCache:     o.NoCache,
+		PullParent:  o.Pull,
+		Platform:    o.Platform,
+		Remove:      true, // remove intermediate containers
+		ForceRemove: true,
+	}
+}
+
+// startBuild runs a build job. openContext is called inside the job, with the job's context,
+// to produce the context archive; cleanup, if set, runs when the job ends.
+func startBuild(c *gin.Context, cli docker.DockerAPI, cfg Config, options build.ImageBuildOptions, openContext func(ctx context.Context) (io.ReadCloser, error), cleanup func()) {
+	target := options.Tags[0]
+	setAuditTarget(c, target)
+	options.AuthConfigs = buildAuthConfigs(cfg)
+	job := cfg.Jobs.Start("build", target, jobOwner(c), buildJobTimeout, func(ctx context.Context, j *jobs.Job) error {
+		if cleanup != nil {
+			defer cleanup()
+		}
+		buildContext, err := openContext(ctx)
+		if err != nil {
+			return err
+		}
+		defer buildContext.Close()
+		res, err := cli.ImageBuild(ctx, buildContext, options)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		return j.ConsumeDaemonStream(res.Body)
+	})
+	acceptJob(c, job)
+}
+
+// buildFromUpload handles a multipart build request. The "context" part holds a tar,
+// compressed tar or zip archive; it is spooled to a temporary file rather than held in
+// memory. Other fields: tag, dockerfilePath, target, platform, noCache, pull, and
+// repeated buildArg and label fields in KEY=VALUE form.
+func buildFromUpload(c *gin.Context, cli docker.DockerAPI, cfg Config) {
+	// uploads may take longer than the server's default read timeout
+	_ = http.NewResponseController(c.Writer).SetReadDeadline(time.Time{})
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBuildContextSize)
+	mr, err := c.Request.MultipartReader()
+	if err != nil {
+		writeAPIError(c, http.StatusBadRequest, "Invalid build request", err.Error())
+		return
+	}
+	opts, dockerfile, spool, err := readBuildForm(mr)
+	if err != nil {
+		if spool != nil {
+			spool.Close()
+			os.Remove(spool.Name())
+		}
+		writeAPIError(c, http.StatusBadRequest, "Invalid build request", err.Error())
+		return
+	}
+	cleanup := func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}
+	if err := opts.validate(); err != nil {
+		cleanup()
+		writeAPIError(c, http.StatusBadRequest, "Invalid build request", err.Error())
+		return
+	}
+	startBuild(c, cli, cfg, opts.toDocker(dockerfile), func(context.Context) (io.ReadCloser, error) {
+		return utils.OpenBuildContext(spool)
+	}, cleanup)
+}
+
+// readBuildForm reads every part of a multipart build request. The returned file, if any,
+// is the spooled context archive and belongs to the caller even when err is set.
+func readBuildForm(mr *multipart.Reader) (BuildOptions, string, *os.File, error) {
+	opts := BuildOptions{BuildArgs: map[string]string{}, Labels: map[string]string{}}
+	dockerfile := "Dockerfile"
+	var spool *os.File
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return opts, "", spool, err
+		}
+		name := part.FormName()
+		if name == "context" {
+			if spool != nil {
+				return opts, "", spool, fmt.Errorf("more than one context part")
+			}
+			if spool, err = os.CreateTemp("", "build-context-*"); err != nil {
+				return opts, "", nil, err
+			}
+			if _, err := io.Copy(spool, part); err != nil {
+				return opts, "", spool, fmt.Errorf("reading context: %w", err)
+			}
+			continue
+		}
+		b, err := io.ReadAll(io.LimitReader(part, maxBuildField+1))
+		if err != nil {
+			return opts, "", spool, err
+		}
+		if len(b) > maxBuildField {
+			return opts, "", spool, fmt.Errorf("field %s is too large", name)
+		}
+		value := string(b)
+		switch name {
+		case "tag":
+			opts.Tag = value
+		case "dockerfilePath":
+			dockerfile = value
+		case "target":
+			opts.Target = value
+		case "platform":
+			opts.Platform = value
+		case "noCache", "pull":
+			flag, err := strconv.ParseBool(value)
+			if err != nil {
+				return opts, "", spool, fmt.Errorf("%s must be true or false", name)
+			}
+			if name == "noCache" {
+				opts.NoCache = flag
+			} else {
+				opts.Pull = flag
+			}
+		case "buildArg", "label":
+			k, v, ok := strings.Cut(value, "=")
+			if !ok || k == "" {
+				return opts, "", spool, fmt.Errorf("%s %q must be KEY=VALUE", name, value)
+			}
+			if name == "buildArg" {
+				opts.BuildArgs[k] = v
+			} else {
+				opts.Labels[k] = v
+			}
+		}
+	}
+	if spool == nil {
+		return opts, "", nil, fmt.Errorf("context archive is required")
+	}
+	return opts, dockerfile, spool, nil
+}
+
+// GitBuildRequest builds from a commit of a git repository. Repository is a remote URL or,
+// when the server allows it, the absolute path of a repository on the server.
+type GitBuildRequest struct {
+	Repository     string `json:"repository" binding:"required"`
+	Ref            string `json:"ref"`
+	Subdir         string `json:"subdir"`
+	DockerfilePath string `json:"dockerfilePath"`
+	BuildOptions
+}
+
+// BuildFromGit starts a build job that checks the commit out into a temporary directory
+// and sends the requested subdirectory, filtered by its .dockerignore, as the context.
+func BuildFromGit(c *gin.Context, cli docker.DockerAPI, cfg Config) {
+	var req GitBuildRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeAPIError(c, http.StatusBadRequest, "Invalid build request", err.Error())
+		return
+	}
+	src := utils.GitSource{Repository: req.Repository, Ref: req.Ref, Subdir: req.Subdir}
+	if req.DockerfilePath == "" {
+		req.DockerfilePath = "Dockerfile"
+	}
+	err := req.validate()
+	if err == nil {
+		err = src.Validate(cfg.GitRoots)
+	}
+	if err != nil {
+		writeAPIError(c, http.StatusBadRequest, "Invalid build request", err.Error())
+		return
+	}
+	dir, err := os.MkdirTemp("", "build-git-*")
+	if err != nil {
+		writeAPIError(c, http.StatusInternalServerError, "Failed to prepare build", err.Error())
+		return
+	}
+	startBuild(c, cli, cfg, req.toDocker(req.DockerfilePath), func(ctx context.Context) (io.ReadCloser, error) {
+		contextDir, err := utils.CheckoutGit(ctx, src, dir)
+		if err != nil {
+			return nil, err
+		}
+		return utils.TarBuildContext(contextDir, req.DockerfilePath)
+	}, func() { os.RemoveAll(dir) })
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"time"
+
+	"github.com/Nebula-work/docker-web/internal/audit"
+	"github.com/Nebula-work/docker-web/internal/auth"
+	"github.com/Nebula-work/docker-web/internal/backups"
+	"github.com/Nebula-work/docker-web/internal/credentials"
+	"github.com/Nebula-work/docker-web/internal/docker"
+	"github.com/Nebula-work/docker-web/internal/imagefs"
+	"github.com/Nebula-work/docker-web/internal/jobs"
+	"github.com/Nebula-work/docker-web/internal/utils"
+)
+
+// Config carries settings and shared services used by the route handlers.
+type Config struct {
+	// SecretEnv decides which container environment variables are masked in inspect responses.
+	SecretEnv *utils.SecretMatcher
+	// Jobs runs pulls, builds and prunes in the background.
+	Jobs *jobs.Manager
+	// Users and Tokens back authentication. When Tokens is nil the API is left unauthenticated.
+	Users  *auth.UserStore
+	Tokens *auth.TokenIssuer
+	// Logins throttles failed password checks.
+	Logins *auth.LoginThrottle
+	// Audit records mutating requests. Auditing is off when it is nil.
+	Audit *audit.Log
+	// Hosts are the Docker daemons the API can act on.
+	Hosts *docker.Registry
+	// Credentials are the stored registry logins used by pulls, pushes and builds.
+	Credentials *credentials.Store
+	// InsecureRegistries are registry hosts browsed over plain http.
+	InsecureRegistries []string
+	// GitRoots are the server directories whose repositories may be built from by path.
+	GitRoots []string
+	// BindRoots are the host directories non-admins may bind-mount into containers or back
+	// volumes with. Administrators may use any host path.
+	BindRoots []string
+	// ImageFS caches image filesystem analyses for the layer explorer.
+	ImageFS *imagefs.Cache
+	// Backups stores volume backups. Without it backups can only be downloaded.
+	Backups *backups.Store
+	// HelperImage is the image of the short-lived containers that read and write volumes.
+	HelperImage string
+}
+
+func (cfg *Config) setDefaults() {
+	if cfg.SecretEnv == nil {
+		cfg.SecretEnv = utils.NewSecretMatcher(nil)
+	}
+	if cfg.Hosts == nil {
+		cfg.Hosts, _ = docker.NewRegistry("")
+	}
+	if cfg.Credentials == nil {
+		cfg.Credentials, _ = credentials.Open("", auth.RandomSecret())
+	}
+	if cfg.Logins == nil {
+		cfg.Logins = auth.NewLoginThrottle(5, 20, 15*time.Minute)
+	}
+	if cfg.HelperImage == "" {
+		cfg.HelperImage = "busybox:stable"
+	}
+	if cfg.ImageFS == nil {
+		cfg.ImageFS = imagefs.NewCache(4)
+	}
+	if cfg.Jobs == nil {
+		cfg.Jobs = jobs.NewManager(time.Hour)
+	}
+}
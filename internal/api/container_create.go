@@ -0,0 +1,337 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/docker/go-connections/nat"
+	"github.com/gin-gonic/gin"
+
+	"github.com/Nebula-work/docker-web/internal/auth"
+	"github.com/Nebula-work/docker-web/internal/docker"
+	"github.com/Nebula-work/docker-web/internal/utils"
+)
+
+// PortMapping maps a host port (optionally prefixed with a bind IP) to a container port.
+type PortMapping struct {
+	Host      string `json:"host"`
+	Container string `json:"container"`
+	Protocol  string `json:"protocol"`
+}
+
+// VolumeMapping binds a host path or named volume to a path inside the container.
+type VolumeMapping struct {
+	Host      string `json:"host"`
+	Container string `json:"container"`
+	ReadOnly  bool   `json:"readOnly"`
+}
+
+type EnvVar struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// RunContainerRequest mirrors the form state of the Run Container modal.
+type RunContainerRequest struct {
+	Name         string            `json:"name"`
+	Image        string            `json:"image" binding:"required"`
+	Command      string            `json:"command"`
+	Ports        []PortMapping     `json:"ports"`
+	Volumes      []VolumeMapping   `json:"volumes"`
+	Environment  []EnvVar          `json:"environment"`
+	Detached     bool              `json:"detached"`
+	Interactive  bool              `json:"interactive"`
+	TTY          bool              `json:"tty"`
+	RemoveOnExit bool              `json:"removeOnExit"`
+	Labels       map[string]string `json:"labels"`
+}
+
+type RunContainerResponse struct {
+	ID       string   `json:"id"`
+	Pulled   bool     `json:"pulled"`
+	Warnings []string `json:"warnings"`
+}
+
+// CreateContainer creates and starts a container, pulling its image first if it is not present locally.
+func CreateContainer(c *gin.Context, cli docker.DockerAPI, cfg Config) {
+	var req RunContainerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeAPIError(c, http.StatusBadRequest, "Invalid container config", err.Error())
+		return
+	}
+	config, hostConfig, err := req.toDockerConfig()
+	if err != nil {
+		writeAPIError(c, http.StatusBadRequest, "Invalid container config", err.Error())
+		return
+	}
+	if !isAdmin(c, cfg) {
+		for _, v := range req.Volumes {
+			if path.IsAbs(v.Host) && !bindAllowed(v.Host, cfg.BindRoots) {
+				writeAPIError(c, http.StatusForbidden, "Permission denied", "only administrators may bind host path "+v.Host)
+				return
+			}
+		}
+	}
+
+	if user, ok := currentAccount(c); ok && user.Scoped(auth.ActionCreate) {
+		// scoped users may only create containers inside their own label scope
+		sel, err := auth.ParseSelector(user.Selector)
+		if err != nil {
+			writeAPIError(c, http.StatusForbidden, "Permission denied", "invalid label selector on account")
+			return
+		}
+		if config.Labels == nil {
+			config.Labels = map[string]string{}
+		}
+		for k, v := range sel.Defaults() {
+			if _, ok := config.Labels[k]; !ok {
+				config.Labels[k] = v
+			}
+		}
+		if !sel.Matches(config.Labels) {
+			writeAPIError(c, http.StatusForbidden, "Permission denied", "container labels are outside your label scope "+user.Selector)
+			return
+		}
+	}
+
+	target := req.Name
+	if target == "" {
+		target = config.Image
+	}
+	setAuditTarget(c, target)
+
+	ctx := c.Request.Context()
+	authStr, err := registryAuth(cfg, config.Image)
+	if err != nil {
+		writeAPIError(c, http.StatusBadRequest, "Invalid container config", err.Error())
+		return
+	}
+	// ensureImage pulls a missing image outside the request deadline; creating and starting
+	// the container afterwards get the time the request had left before the pull
+	deadline, bounded := ctx.Deadline()
+	left := time.Until(deadline)
+	pulled, err := ensureImage(ctx, cli, config.Image, authStr)
+	if err != nil {
+		writeAPIError(c, http.StatusBadGateway, "Failed to pull image", err.Error())
+		return
+	}
+	if pulled && bounded {
+		var cancel context.CancelFunc
+		ctx, cancel = detachDeadline(c.Request.Context(), left)
+		defer cancel()
+	}
+
+	resp, err := cli.ContainerCreate(ctx, config, hostConfig, nil, nil, req.Name)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if cerrdefs.IsConflict(err) {
+			status = http.StatusConflict
+		} else if cerrdefs.IsInvalidArgument(err) {
+			status = http.StatusBadRequest
+		}
+		writeAPIError(c, status, "Failed to create container", err.Error())
+		return
+	}
+	setAuditTarget(c, resp.ID)
+	if err := cli.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
+		// leave the created container in place so the failure can be inspected
+		writeAPIError(c, http.StatusInternalServerError, "Container created but failed to start", err.Error())
+		return
+	}
+
+	warnings := resp.Warnings
+	if warnings == nil {
+		warnings = []string{}
+	}
+	c.JSON(http.StatusCreated, RunContainerResponse{ID: resp.ID, Pulled: pulled, Warnings: warnings})
+}
+
+func (r *RunContainerRequest) toDockerConfig() (*container.Config, *container.HostConfig, error) {
+	img := strings.TrimSpace(r.Image)
+	if img == "" {
+		return nil, nil, fmt.Errorf("image is required")
+	}
+	cmd, err := utils.SplitCommand(r.Command)
+	if err != nil {
+		return nil, nil, fmt.Errorf("command: %w", err)
+	}
+
+	var specs []string
+	for _, p := range r.Ports {
+		if p.Host == "" && p.Container == "" {
+			continue // empty row left in the form
+		}
+		spec, err := portSpec(p)
+		if err != nil {
+			return nil, nil, err
+		}
+		specs = append(specs, spec)
+	}
+	exposed, bindings, err := nat.ParsePortSpecs(specs)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ports: %w", err)
+	}
+
+	var binds []string
+	for _, v := range r.Volumes {
+		if v.Host == "" && v.Container == "" {
+			continue
+		}
+		bind, err := bindSpec(v)
+		if err != nil {
+			return nil, nil, err
+		}
+		binds = append(binds, bind)
+	}
+
+	var env []string
+	for _, e := range r.Environment {
+		if e.Key == "" {
+			if e.Value != "" {
+				return nil, nil, fmt.Errorf("environment: value %q has no key", e.Value)
+			}
+			continue
+		}
+		if strings.ContainsAny(e.Key, "= \t\n") {
+			return nil, nil, fmt.Errorf("environment: invalid key %q", e.Key)
+		}
+		env = append(env, e.Key+"="+e.Value)
+	}
+
+	config := &container.Config{
+		Image:        img,
+		Cmd:          cmd,
+		Labels:       r.Labels,
+		Env:          env,
+		ExposedPorts: exposed,
+		Tty:          r.TTY,
+		OpenStdin:    r.Interactive,
+		AttachStdin:  r.Interactive && !r.Detached,
+		AttachStdout: !r.Detached,
+		AttachStderr: !r.Detached,
+	}
+	hostConfig := &container.HostConfig{
+		Binds:        binds,
+		PortBindings: bindings,
+		AutoRemove:   r.RemoveOnExit,
+	}
+	return config, hostConfig, nil
+}
+
+// portSpec turns a form row into the "ip:host:container/proto" syntax understood by nat.
+func portSpec(p PortMapping) (string, error) {
+	if p.Container == "" {
+		return "", fmt.Errorf("ports: container port is required (host %q)", p.Host)
+	}
+	proto := strings.ToLower(p.Protocol)
+	containerPort := p.Container
+	if i := strings.Index(containerPort, "/"); i >= 0 {
+		if proto == "" {
+			proto = containerPort[i+1:]
+		}
+		containerPort = containerPort[:i]
+	}
+	if proto == "" {
+		proto = "tcp"
+	}
+	if proto != "tcp" && proto != "udp" && proto != "sctp" {
+		return "", fmt.Errorf("ports: invalid protocol %q", proto)
+	}
+	if _, _, err := nat.ParsePortRangeToInt(containerPort); err != nil {
+		return "", fmt.Errorf("ports: invalid container port %q", p.Container)
+	}
+	host := p.Host
+	if host != "" {
+		hostPort := host
+		if i := strings.LastIndex(host, ":"); i >= 0 {
+			hostPort = host[i+1:]
+		}
+		if _, _, err := nat.ParsePortRangeToInt(hostPort); err != nil {
+			return "", fmt.Errorf("ports: invalid host port %q", p.Host)
+		}
+		if !strings.Contains(host, ":") {
+			host = ":" + host
+		}
+		return host + ":" + containerPort + "/" + proto, nil
+	}
+	return containerPort + "/" + proto, nil
+}
+
+// bindSpec validates a volume row and returns it in "source:target[:ro]" form.
+// The source may be an absolute host path or a named volume.
+func bindSpec(v VolumeMapping) (string, error) {
+	if v.Host == "" || v.Container == "" {
+		return "", fmt.Errorf("volumes: both host and container paths are required")
+	}
+	if !path.IsAbs(v.Container) {
+		return "", fmt.Errorf("volumes: container path %q must be absolute", v.Container)
+	}
+	if strings.Contains(v.Host, ":") || strings.Contains(v.Container, ":") {
+		return "", fmt.Errorf("volumes: paths must not contain ':'")
+	}
+	if !path.IsAbs(v.Host) && strings.ContainsAny(v.Host, "/\\") {
+		return "", fmt.Errorf("volumes: host path %q must be absolute or a volume name", v.Host)
+	}
+	bind := v.Host + ":" + path.Clean(v.Container)
+	if v.ReadOnly {
+		bind += ":ro"
+	}
+	return bind, nil
+}
+
+// bindAllowed reports whether the host path p lies under one of roots. The path is on the
+// daemon's host, so it is compared lexically; symlinks there cannot be resolved from here.
+func bindAllowed(p string, roots []string) bool {
+	p = path.Clean(p)
+	for _, root := range roots {
+		if !path.IsAbs(root) {
+			continue
+		}
+		root = path.Clean(root)
+		if p == root || strings.HasPrefix(p, strings.TrimSuffix(root, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// ensureImage pulls ref unless it already exists locally. It reports whether a pull happened.
+// The pull is not bound by ctx's deadline, only by its cancellation and pullJobTimeout.
+func ensureImage(ctx context.Context, cli docker.DockerAPI, ref string, registryAuth string) (bool, error) {
+	if _, err := cli.ImageInspect(ctx, ref); err == nil {
+		return false, nil
+	} else if !cerrdefs.IsNotFound(err) {
+		return false, err
+	}
+	ctx, cancel := detachDeadline(ctx, pullJobTimeout)
+	defer cancel()
+	reader, err := cli.ImagePull(ctx, ref, image.PullOptions{RegistryAuth: registryAuth})
+	if err != nil {
+		return false, err
+	}
+	defer reader.Close()
+	// the pull only completes once the progress stream is drained; errors arrive inside it
+	dec := json.NewDecoder(reader)
+	for {
+		var msg jsonmessage.JSONMessage
+		if err := dec.Decode(&msg); err != nil {
+			if err == io.EOF {
+				return true, nil
+			}
+			return false, err
+		}
+		if msg.Error != nil {
+			return false, msg.Error
+		}
+	}
+}
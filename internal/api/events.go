@@ -0,0 +1,135 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/gin-gonic/gin"
+
+	"github.com/Nebula-work/docker-web/internal/docker"
+)
+
+// eventsKeepAlive is how often an SSE comment is sent so idle proxies do not drop the connection.
+const eventsKeepAlive = 30 * time.Second
+
+var eventTypes = map[string]bool{
+	string(events.ContainerEventType): true,
+	string(events.ImageEventType):     true,
+	string(events.VolumeEventType):    true,
+	string(events.NetworkEventType):   true,
+	string(events.DaemonEventType):    true,
+	string(events.PluginEventType):    true,
+	string(events.BuilderEventType):   true,
+}
+
+// Event is a daemon event as sent to the UI.
+type Event struct {
+	Type       string            `json:"type"`
+	Action     string            `json:"action"`
+	ID         string            `json:"id"`
+	Name       string            `json:"name,omitempty"`
+	Scope      string            `json:"scope,omitempty"`
+	Attributes map[string]string `json:"attributes"`
+	Time       time.Time         `json:"time"`
+}
+
+// StreamEvents relays the daemon event stream as Server-Sent Events.
+//
+// Query parameters type, action, container, image and label filter the stream; each may be
+// repeated or given as a comma-separated list. since and until are passed through to the daemon.
+func StreamEvents(c *gin.Context, cli docker.DockerAPI) {
+	args, err := eventFilters(c)
+	if err != nil {
+		writeAPIError(c, http.StatusBadRequest, "Invalid event filter", err.Error())
+		return
+	}
+	for name, v := range map[string]string{"since": c.Query("since"), "until": c.Query("until")} {
+		if v != "" && !validLogTime(v) {
+			writeAPIError(c, http.StatusBadRequest, "Invalid event filter", name+" must be a time, unix timestamp or duration")
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+	msgs, errs := cli.Events(ctx, events.ListOptions{Filters: args, Since: c.Query("since"), Until: c.Query("until")})
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	ticker := time.NewTicker(eventsKeepAlive)
+	defer ticker.Stop()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case m := <-msgs:
+			// the "message" event name is what EventSource.onmessage receives
+			c.SSEvent("message", newEvent(m))
+		case err := <-errs:
+			if err != nil && err != io.EOF && ctx.Err() == nil {
+				c.SSEvent("error", gin.H{"message": err.Error()})
+			}
+			return false
+		case <-ticker.C:
+			_, _ = io.WriteString(w, ": keepalive\n\n")
+		case <-ctx.Done():
+			return false
+		}
+		return true
+	})
+}
+
+func newEvent(m events.Message) Event {
+	attrs := m.Actor.Attributes
+	if attrs == nil {
+		attrs = map[string]string{}
+	}
+	t := time.Unix(m.Time, 0)
+	if m.TimeNano != 0 {
+		t = time.Unix(0, m.TimeNano)
+	}
+	return Event{
+		Type:       string(m.Type),
+		Action:     string(m.Action),
+		ID:         m.Actor.ID,
+		Name:       attrs["name"],
+		Scope:      m.Scope,
+		Attributes: attrs,
+		Time:       t.UTC(),
+	}
+}
+
+// eventFilters maps query parameters onto daemon event filters.
+func eventFilters(c *gin.Context) (filters.Args, error) {
+	args := filters.NewArgs()
+	for param, key := range map[string]string{
+		"type":      "type",
+		"action":    "event",
+		"container": "container",
+		"image":     "image",
+		"label":     "label",
+	} {
+		for _, v := range queryList(c, param) {
+			if param == "type" && !eventTypes[v] {
+				return args, fmt.Errorf("unknown event type %q", v)
+			}
+			args.Add(key, v)
+		}
+	}
+	return args, nil
+}
+
+// queryList returns every value of a repeatable query parameter, also splitting comma-separated values.
+func queryList(c *gin.Context, key string) []string {
+	var out []string
+	for _, raw := range c.QueryArray(key) {
+		for _, v := range strings.Split(raw, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				out = append(out, v)
+			}
+		}
+	}
+	return out
+}
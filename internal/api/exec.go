@@ -0,0 +1,215 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"github.com/Nebula-work/docker-web/internal/docker"
+	"github.com/Nebula-work/docker-web/internal/utils"
+)
+
+// defaultShell prefers bash when the image has it and falls back to sh.
+var defaultShell = []string{"/bin/sh", "-c", "if command -v bash >/dev/null 2>&1; then exec bash; else exec sh; fi"}
+
+// execMessage is the JSON control frame exchanged over the exec websocket.
+// Clients send "input" and "resize"; the server sends "exit" and "error".
+type execMessage struct {
+	Type     string `json:"type"`
+	Data     string `json:"data,omitempty"`
+	Cols     uint   `json:"cols,omitempty"`
+	Rows     uint   `json:"rows,omitempty"`
+	ExitCode *int   `json:"exitCode,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
+
+// wsWriter serialises writes to a websocket connection, which only allows one concurrent writer.
+type wsWriter struct {
+	mu   sync.Mutex
+	conn *websocket.Conn
+}
+
+func (w *wsWriter) write(messageType int, data []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_ = w.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return w.conn.WriteMessage(messageType, data)
+}
+
+func (w *wsWriter) writeJSON(v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return w.write(websocket.TextMessage, b)
+}
+
+// binaryWriter adapts wsWriter to io.Writer, sending each write as a binary frame.
+type binaryWriter struct{ w *wsWriter }
+
+func (b binaryWriter) Write(p []byte) (int, error) {
+	if err := b.w.write(websocket.BinaryMessage, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// ExecContainer runs a command inside a container and bridges its stdio to a websocket.
+//
+// Query parameters: cmd (defaults to an interactive shell), user, workdir, tty (default true),
+// cols and rows for the initial terminal size. Output is sent as binary frames; stdin is
+// accepted either as binary frames or as {"type":"input"} JSON text frames, and
+// {"type":"resize","cols":N,"rows":N} resizes the TTY.
+func ExecContainer(c *gin.Context, cli docker.DockerAPI) {
+	cmd := defaultShell
+	if raw := c.Query("cmd"); raw != "" {
+		parsed, err := utils.SplitCommand(raw)
+		if err != nil || len(parsed) == 0 {
+			writeAPIError(c, http.StatusBadRequest, "Invalid command", "cmd must be a non-empty command line")
+			return
+		}
+		cmd = parsed
+	}
+	tty := c.DefaultQuery("tty", "true") != "false"
+	var consoleSize *[2]uint
+	if rows, cols := queryUint(c, "rows"), queryUint(c, "cols"); tty && rows > 0 && cols > 0 {
+		consoleSize = &[2]uint{rows, cols}
+	}
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("ws upgrade: %v", err)
+		return
+	}
+	defer conn.Close()
+	conn.SetReadLimit(512 * 1024)
+	_ = conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	conn.SetPongHandler(func(string) error { _ = conn.SetReadDeadline(time.Now().Add(60 * time.Second)); return nil })
+	ws := &wsWriter{conn: conn}
+
+	// the session outlives the HTTP request timeout, so it gets its own context
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	containerID := c.Param("id")
+	created, err := cli.ContainerExecCreate(ctx, containerID, container.ExecOptions{
+		Cmd:          cmd,
+		User:         c.Query("user"),
+		WorkingDir:   c.Query("workdir"),
+		Tty:          tty,
+		ConsoleSize:  consoleSize,
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		_ = ws.writeJSON(execMessage{Type: "error", Message: err.Error()})
+		return
+	}
+	hijacked, err := cli.ContainerExecAttach(ctx, created.ID, container.ExecAttachOptions{Tty: tty, ConsoleSize: consoleSize})
+	if err != nil {
+		_ = ws.writeJSON(execMessage{Type: "error", Message: err.Error()})
+		return
+	}
+	defer hijacked.Close()
+
+	// keepalive so the read deadline is refreshed while the terminal is idle
+	go func() {
+		ticker := time.NewTicker(30 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := ws.write(websocket.PingMessage, nil); err != nil {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	// client -> container stdin and resize requests
+	go func() {
+		defer cancel()
+		for {
+			msgType, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if msgType == websocket.BinaryMessage {
+				if _, err := hijacked.Conn.Write(data); err != nil {
+					return
+				}
+				continue
+			}
+			var msg execMessage
+			if err := json.Unmarshal(data, &msg); err != nil {
+				_ = ws.writeJSON(execMessage{Type: "error", Message: "invalid control message"})
+				continue
+			}
+			switch msg.Type {
+			case "input":
+				if _, err := io.WriteString(hijacked.Conn, msg.Data); err != nil {
+					return
+				}
+			case "resize":
+				if !tty || msg.Cols == 0 || msg.Rows == 0 {
+					continue
+				}
+				if err := cli.ContainerExecResize(ctx, created.ID, container.ResizeOptions{Height: msg.Rows, Width: msg.Cols}); err != nil {
+					log.Printf("exec resize: %v", err)
+				}
+			}
+		}
+	}()
+
+	// container stdout/stderr -> client
+	out := binaryWriter{w: ws}
+	done := make(chan error, 1)
+	go func() {
+		var err error
+		if tty {
+			_, err = io.Copy(out, hijacked.Reader)
+		} else {
+			_, err = stdcopy.StdCopy(out, out, hijacked.Reader)
+		}
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil && err != io.EOF {
+			log.Printf("exec stream: %v", err)
+		}
+	case <-ctx.Done():
+		return
+	}
+
+	inspectCtx, inspectCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer inspectCancel()
+	if info, err := cli.ContainerExecInspect(inspectCtx, created.ID); err == nil {
+		exitCode := info.ExitCode
+		_ = ws.writeJSON(execMessage{Type: "exit", ExitCode: &exitCode})
+	}
+	_ = ws.write(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+}
+
+func queryUint(c *gin.Context, key string) uint {
+	v, err := strconv.ParseUint(c.Query(key), 10, 16)
+	if err != nil {
+		return 0
+	}
+	return uint(v)
+}
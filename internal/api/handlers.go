@@ -1,26 +1,23 @@
 package api
 
 import (
-	"archive/tar"
 	"bytes"
 	"context"
-	"encoding/base64"
-	"encoding/json"
 	"io"
 	"log"
 	"net/http"
 	"time"
 
-	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/api/types/network"
-	"github.com/docker/docker/api/types/registry"
-	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 
 	"github.com/Nebula-work/docker-web/internal/docker"
+	"github.com/Nebula-work/docker-web/internal/jobs"
+	"github.com/Nebula-work/docker-web/internal/utils"
 )
 
 var upgrader = websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
@@ -78,8 +75,15 @@ func RemoveContainer(c *gin.Context, cli docker.DockerAPI) {
 	c.JSON(http.StatusOK, gin.H{"message": "removed"})
 }
 
-// StreamContainerLogs streams logs over websocket
+// StreamContainerLogs streams logs over websocket as JSON LogFrame messages.
+// Non-TTY output is demultiplexed so stdout and stderr can be told apart.
 func StreamContainerLogs(c *gin.Context, cli docker.DockerAPI) {
+	opts, keepTimestamps, err := parseLogsOptions(c)
+	if err != nil {
+		writeAPIError(c, http.StatusBadRequest, "Invalid log options", err.Error())
+		return
+	}
+
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		log.Printf("ws upgrade: %v", err)
@@ -91,58 +95,52 @@ func StreamContainerLogs(c *gin.Context, cli docker.DockerAPI) {
 	conn.SetReadLimit(512 * 1024)
 	_ = conn.SetReadDeadline(time.Now().Add(60 * time.Second))
 	conn.SetPongHandler(func(string) error { _ = conn.SetReadDeadline(time.Now().Add(60 * time.Second)); return nil })
+	ws := &wsWriter{conn: conn}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	containerID := c.Param("id")
-	logReader, err := cli.ContainerLogs(ctx, containerID, container.LogsOptions{ShowStdout: true, ShowStderr: true, Follow: true, Timestamps: false})
+	info, err := cli.ContainerInspect(ctx, containerID)
 	if err != nil {
-		conn.WriteMessage(websocket.TextMessage, []byte("error: cannot get logs"))
+		_ = ws.writeJSON(gin.H{"error": "cannot inspect container", "detail": err.Error()})
+		return
+	}
+	logReader, err := cli.ContainerLogs(ctx, containerID, opts)
+	if err != nil {
+		_ = ws.writeJSON(gin.H{"error": "cannot get logs", "detail": err.Error()})
 		return
 	}
 	defer logReader.Close()
 
-	// writer goroutine that serializes writes
-	writeCh := make(chan []byte)
-	go func() {
-		for msg := range writeCh {
-			_ = conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			if err := conn.WriteMessage(websocket.TextMessage, msg); err != nil {
-				break
-			}
-		}
-	}()
-
 	// read goroutine to detect client close / pongs
 	go func() {
 		for {
 			if _, _, err := conn.ReadMessage(); err != nil {
 				cancel()
+				logReader.Close()
 				break
 			}
 		}
 	}()
 
-	buf := make([]byte, 2048)
-	for {
-		n, err := logReader.Read(buf)
-		if err != nil {
-			if err != io.EOF {
-				log.Printf("log read err: %v", err)
-			}
-			break
-		}
-		// copy because buf will be reused
-		b := make([]byte, n)
-		copy(b, buf[:n])
-		select {
-		case writeCh <- b:
-		case <-ctx.Done():
-			break
-		}
+	emit := func(f LogFrame) error { return ws.writeJSON(f) }
+	stdout := &logFrameWriter{stream: "stdout", keepTimestamps: keepTimestamps, emit: emit}
+	stderr := &logFrameWriter{stream: "stderr", keepTimestamps: keepTimestamps, emit: emit}
+	if info.Config != nil && info.Config.Tty {
+		// a TTY merges both streams and has no multiplex headers
+		_, err = io.Copy(stdout, logReader)
+	} else {
+		_, err = stdcopy.StdCopy(stdout, stderr, logReader)
+	}
+	if err != nil && ctx.Err() == nil {
+		log.Printf("log read err: %v", err)
+	}
+	_ = stdout.Flush()
+	_ = stderr.Flush()
+	if ctx.Err() == nil {
+		_ = ws.write(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
 	}
-	close(writeCh)
 }
 
 func ListImages(c *gin.Context, cli docker.DockerAPI) {
@@ -159,94 +157,71 @@ type AuthConfig struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 }
+
+// PullRequest pulls an image. Auth overrides the stored credentials for this pull.
 type PullRequest struct {
 	Image string      `json:"image" binding:"required"`
 	Auth  *AuthConfig `json:"auth"`
 }
 
-func PullImage(c *gin.Context, cli docker.DockerAPI) {
+// PullImage starts a background pull job and returns it; progress is available from the jobs endpoints.
+func PullImage(c *gin.Context, cli docker.DockerAPI, cfg Config) {
 	var req PullRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "bad request"})
 		return
 	}
-	ctx := c.Request.Context()
+	setAuditTarget(c, req.Image)
 	opts := image.PullOptions{}
-	if req.Auth != nil && req.Auth.Username != "" {
-		authConfig := registry.AuthConfig{
-			Username: req.Auth.Username,
-			Password: req.Auth.Password,
-		}
-		encodedJSON, err := json.Marshal(authConfig)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode auth config"})
-			return
-		}
-		authStr := base64.URLEncoding.EncodeToString(encodedJSON)
-		opts.RegistryAuth = authStr
-	}
-	reader, err := cli.ImagePull(ctx, req.Image, opts)
+	authStr, err := requestAuth(cfg, req.Image, req.Auth)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	defer reader.Close()
-	c.Stream(func(w io.Writer) bool { _, err := io.Copy(w, reader); return err == nil })
+	opts.RegistryAuth = authStr
+	job := cfg.Jobs.Start("pull", req.Image, jobOwner(c), pullJobTimeout, func(ctx context.Context, j *jobs.Job) error {
+		reader, err := cli.ImagePull(ctx, req.Image, opts)
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		return j.ConsumeDaemonStream(reader)
+	})
+	acceptJob(c, job)
 }
 
+// BuildRequest builds from a single Dockerfile with an empty context.
 type BuildRequest struct {
 	Dockerfile string `json:"dockerfile" binding:"required"`
-	Tag        string `json:"tag" binding:"required"`
+	BuildOptions
 }
 
-func BuildImage(c *gin.Context, cli docker.DockerAPI) {
+// BuildImage starts a background build job and returns it; progress is available from the jobs endpoints.
+// A multipart request builds from an uploaded context archive instead, see buildFromUpload.
+func BuildImage(c *gin.Context, cli docker.DockerAPI, cfg Config) {
+	if c.ContentType() == "multipart/form-data" {
+		buildFromUpload(c, cli, cfg)
+		return
+	}
 	var req BuildRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-
-	// Create in-memory tar with the Dockerfile
-	var buf bytes.Buffer
-	tw := tar.NewWriter(&buf)
-	hdr := &tar.Header{
-		Name: "Dockerfile",
-		Mode: 0600,
-		Size: int64(len(req.Dockerfile)),
-	}
-	if err := tw.WriteHeader(hdr); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write tar header"})
-		return
-	}
-	if _, err := tw.Write([]byte(req.Dockerfile)); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write Dockerfile"})
-		return
-	}
-	if err := tw.Close(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to close tar"})
+	if err := req.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	dockerBuildContext := bytes.NewReader(buf.Bytes())
-
-	options := types.ImageBuildOptions{
-		Tags:       []string{req.Tag},
-		Dockerfile: "Dockerfile",
-		Remove:     true, // remove intermediate containers
-	}
-
-	res, err := cli.ImageBuild(context.Background(), dockerBuildContext, options)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	// Create in-memory tar with the Dockerfile
+	var buf bytes.Buffer
+	if err := utils.WriteDockerfileTar(&buf, req.Dockerfile); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write build context"})
 		return
 	}
-	defer res.Body.Close()
-
-	// Stream build output to client
-	c.Stream(func(w io.Writer) bool {
-		_, err := io.Copy(w, res.Body)
-		return err == nil
-	})
+	startBuild(c, cli, cfg, req.toDocker("Dockerfile"), func(context.Context) (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(buf.Bytes())), nil
+	}, nil)
 }
 
 func RemoveImage(c *gin.Context, cli docker.DockerAPI) {
@@ -258,27 +233,13 @@ func RemoveImage(c *gin.Context, cli docker.DockerAPI) {
 	c.JSON(http.StatusOK, gin.H{"message": "removed"})
 }
 
-func ListVolumes(c *gin.Context, cli docker.DockerAPI) {
-	ctx := c.Request.Context()
-	volumes, err := cli.VolumeList(ctx, volume.ListOptions{})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list volumes"})
-	}
-	c.JSON(http.StatusOK, volumes)
-}
-func CreateVolume(c *gin.Context, cli docker.DockerAPI) {
-	ctx := c.Request.Context()
-	name := c.Param("name")
-	if _, err := cli.VolumeCreate(ctx, volume.CreateOptions{Name: name}); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-	}
-	c.JSON(http.StatusOK, gin.H{"message": "created"})
-}
 func RemoveVolume(c *gin.Context, cli docker.DockerAPI) {
 	ctx := c.Request.Context()
 	name := c.Param("name")
 	if err := cli.VolumeRemove(ctx, name, false); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		// a volume still used by a container is a conflict
+		writeVolumeError(c, err, "Failed to remove volume")
+		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "removed"})
 }
@@ -309,6 +270,7 @@ func CreateNetwork(c *gin.Context, cli docker.DockerAPI) {
 		return
 	}
 
+	setAuditTarget(c, networkName)
 	resp, err := cli.NetworkCreate(context.Background(), networkName, req)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Nebula-work/docker-web/internal/docker"
+)
+
+// ctxDocker holds the docker.DockerAPI of the host a request acts on.
+const ctxDocker = "docker"
+
+// useHost selects the Docker host named by the :host parameter, or the default host on
+// routes without one, for hostClient to return.
+func useHost(cfg Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.Param("host")
+		cli, err := cfg.Hosts.Client(name)
+		if errors.Is(err, docker.ErrHostNotFound) {
+			if name == "" {
+				writeAPIError(c, http.StatusServiceUnavailable, "No default Docker host", "")
+			} else {
+				writeAPIError(c, http.StatusNotFound, "Host not found", name)
+			}
+			return
+		}
+		if err != nil {
+			writeAPIError(c, http.StatusBadGateway, "Host unavailable", err.Error())
+			return
+		}
+		c.Set(ctxDocker, cli)
+	}
+}
+
+// hostClient returns the client selected by useHost.
+func hostClient(c *gin.Context) docker.DockerAPI {
+	return c.MustGet(ctxDocker).(docker.DockerAPI)
+}
+
+func ListHosts(c *gin.Context, cfg Config) {
+	c.JSON(http.StatusOK, cfg.Hosts.List())
+}
+
+// GetHost checks the host's health now and returns it.
+func GetHost(c *gin.Context, cfg Config) {
+	info, err := cfg.Hosts.Check(c.Request.Context(), c.Param("host"))
+	if err != nil {
+		writeHostError(c, err, "Failed to check host")
+		return
+	}
+	c.JSON(http.StatusOK, info)
+}
+
+type AddHostRequest struct {
+	docker.Endpoint
+	// Agent registers a host served by the agent binary; Host and the TLS files are ignored.
+	Agent bool `json:"agent"`
+}
+
+// AddAgentResponse carries the token for a new agent host. It is only shown once.
+type AddAgentResponse struct {
+	docker.HostInfo
+	AgentToken string `json:"agentToken"`
+}
+
+// AddHost registers a new endpoint. The host is saved even if it is not reachable yet;
+// the response reports its health.
+func AddHost(c *gin.Context, cfg Config) {
+	var req AddHostRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeAPIError(c, http.StatusBadRequest, "Invalid host", err.Error())
+		return
+	}
+	setAuditTarget(c, req.Name)
+	if req.Agent {
+		info, token, err := cfg.Hosts.AddAgent(req.Name)
+		if err != nil {
+			writeHostError(c, err, "Failed to add host")
+			return
+		}
+		c.JSON(http.StatusCreated, AddAgentResponse{HostInfo: info, AgentToken: token})
+		return
+	}
+	info, err := cfg.Hosts.Add(req.Endpoint)
+	if err != nil {
+		writeHostError(c, err, "Failed to add host")
+		return
+	}
+	c.JSON(http.StatusCreated, info)
+}
+
+func RemoveHost(c *gin.Context, cfg Config) {
+	if err := cfg.Hosts.Remove(c.Param("host")); err != nil {
+		writeHostError(c, err, "Failed to remove host")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "removed"})
+}
+
+func writeHostError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, docker.ErrHostNotFound):
+		writeAPIError(c, http.StatusNotFound, "Host not found", c.Param("host"))
+	case errors.Is(err, docker.ErrHostExists), errors.Is(err, docker.ErrHostFixed):
+		writeAPIError(c, http.StatusConflict, message, err.Error())
+	default:
+		writeAPIError(c, http.StatusBadRequest, message, err.Error())
+	}
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/gin-gonic/gin"
+
+	"github.com/Nebula-work/docker-web/internal/docker"
+)
+
+// maxImageArchiveSize bounds an uploaded image archive.
+const maxImageArchiveSize = 64 << 30
+
+// unsafeFilename matches the characters replaced when an image name becomes a file name.
+var unsafeFilename = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// ExportImages streams `docker save` output for :id and any further ?image= references as
+// one tar archive, gzip-compressed with ?gzip=true. Images exported by tag keep their tags
+// when loaded again; images exported by ID do not.
+func ExportImages(c *gin.Context, cli docker.DockerAPI) {
+	refs := append([]string{c.Param("id")}, c.QueryArray("image")...)
+	setAuditTarget(c, strings.Join(refs, ","))
+	// errors can only be reported before the archive starts, so check every image first
+	for _, ref := range refs {
+		if _, err := cli.ImageInspect(c.Request.Context(), ref); err != nil {
+			writeImageError(c, err, "Failed to export image "+ref)
+			return
+		}
+	}
+	reader, err := cli.ImageSave(c.Request.Context(), refs)
+	if err != nil {
+		writeImageError(c, err, "Failed to export images")
+		return
+	}
+	defer reader.Close()
+
+	compress := c.Query("gzip") == "true"
+	name := archiveName(refs)
+	contentType := "application/x-tar"
+	if compress {
+		name += ".gz"
+		contentType = "application/gzip"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, name))
+	c.Status(http.StatusOK)
+
+	var w io.Writer = c.Writer
+	var zw *gzip.Writer
+	if compress {
+		zw = gzip.NewWriter(c.Writer)
+		w = zw
+	}
+	if _, err := io.Copy(w, reader); err != nil {
+		if c.Request.Context().Err() == nil {
+			log.Printf("image export: %v", err)
+		}
+		return
+	}
+	if zw != nil {
+		_ = zw.Close()
+	}
+}
+
+// archiveName is the download file name for an export, e.g. "nginx_1.27.tar".
+func archiveName(refs []string) string {
+	name := strings.Trim(unsafeFilename.ReplaceAllString(strings.TrimPrefix(refs[0], "sha256:"), "_"), "_.")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	if name == "" {
+		name = "images"
+	}
+	if len(refs) > 1 {
+		name += fmt.Sprintf("-and-%d-more", len(refs)-1)
+	}
+	return name + ".tar"
+}
+
+// LoadResult lists what an image load added. Images saved by ID have no tags and only
+// show up in IDs.
+type LoadResult struct {
+	Tags []string `json:"tags"`
+	IDs  []string `json:"ids"`
+}
+
+// LoadImages passes an uploaded `docker save` archive (plain or compressed) straight to
+// the daemon without buffering it. The archive is sent as multipart/form-data in an
+// "image" file part.
+func LoadImages(c *gin.Context, cli docker.DockerAPI) {
+	// uploads may take longer than the server's default read timeout
+	_ = http.NewResponseController(c.Writer).SetReadDeadline(time.Time{})
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImageArchiveSize)
+	mr, err := c.Request.MultipartReader()
+	if err != nil {
+		writeAPIError(c, http.StatusBadRequest, "Invalid load request", err.Error())
+		return
+	}
+	part, err := mr.NextPart()
+	for err == nil && part.FormName() != "image" {
+		part, err = mr.NextPart()
+	}
+	if err != nil {
+		writeAPIError(c, http.StatusBadRequest, "Invalid load request", "missing image file part")
+		return
+	}
+	setAuditTarget(c, part.FileName())
+	res, err := cli.ImageLoad(c.Request.Context(), part)
+	if err != nil {
+		writeAPIError(c, http.StatusInternalServerError, "Failed to load images", err.Error())
+		return
+	}
+	defer res.Body.Close()
+	result, err := readLoadOutput(res.Body)
+	if err != nil {
+		writeAPIError(c, http.StatusBadRequest, "Failed to load images", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// readLoadOutput collects the "Loaded image: ..." and "Loaded image ID: ..." lines of the
+// daemon's load stream.
+func readLoadOutput(r io.Reader) (LoadResult, error) {
+	result := LoadResult{Tags: []string{}, IDs: []string{}}
+	dec := json.NewDecoder(r)
+	for {
+		var msg jsonmessage.JSONMessage
+		if err := dec.Decode(&msg); err != nil {
+			if errors.Is(err, io.EOF) {
+				return result, nil
+			}
+			return result, err
+		}
+		if msg.Error != nil {
+			return result, errors.New(msg.Error.Message)
+		}
+		if msg.ErrorMessage != "" {
+			return result, errors.New(msg.ErrorMessage)
+		}
+		line := strings.TrimSpace(msg.Stream)
+		if id, ok := strings.CutPrefix(line, "Loaded image ID: "); ok {
+			result.IDs = append(result.IDs, id)
+		} else if tag, ok := strings.CutPrefix(line, "Loaded image: "); ok {
+			result.Tags = append(result.Tags, tag)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package api
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types/image"
+	"github.com/gin-gonic/gin"
+
+	"github.com/Nebula-work/docker-web/internal/docker"
+	"github.com/Nebula-work/docker-web/internal/utils"
+)
+
+type ImageDetails struct {
+	ID            string          `json:"id"`
+	RepoTags      []string        `json:"repoTags"`
+	RepoDigests   []string        `json:"repoDigests"`
+	Parent        string          `json:"parent"`
+	Comment       string          `json:"comment"`
+	Created       string          `json:"created"`
+	Author        string          `json:"author"`
+	DockerVersion string          `json:"dockerVersion"`
+	Architecture  string          `json:"architecture"`
+	Variant       string          `json:"variant"`
+	OS            string          `json:"os"`
+	Size          int64           `json:"size"`
+	Config        ImageConfigInfo `json:"config"`
+	// Layers are the diff IDs of the root filesystem, base layer first.
+	Layers        []string `json:"layers"`
+	SecretsMasked bool     `json:"secretsMasked"`
+}
+
+type ImageConfigInfo struct {
+	User         string            `json:"user"`
+	Env          []EnvEntry        `json:"env"`
+	Cmd          []string          `json:"cmd"`
+	Entrypoint   []string          `json:"entrypoint"`
+	Shell        []string          `json:"shell"`
+	WorkingDir   string            `json:"workingDir"`
+	Labels       map[string]string `json:"labels"`
+	ExposedPorts []string          `json:"exposedPorts"`
+	Volumes      []string          `json:"volumes"`
+	StopSignal   string            `json:"stopSignal"`
+	Healthcheck  []string          `json:"healthcheck"`
+	OnBuild      []string          `json:"onBuild"`
+}
+
+// InspectImage returns normalised inspect data for an image. Environment variables are
+// masked like in InspectContainer, since images often carry build-time secrets.
+func InspectImage(c *gin.Context, cli docker.DockerAPI, cfg Config) {
+	reveal := c.Query("reveal") == "true"
+	if reveal && !c.GetBool(ctxRevealSecrets) {
+		writeAPIError(c, http.StatusForbidden, "Not allowed to reveal secrets", "")
+		return
+	}
+	info, err := cli.ImageInspect(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		writeImageError(c, err, "Failed to inspect image")
+		return
+	}
+	var secrets *utils.SecretMatcher
+	if !reveal {
+		secrets = cfg.SecretEnv
+	}
+	c.JSON(http.StatusOK, newImageDetails(info, secrets))
+}
+
+// newImageDetails converts inspect data into ImageDetails. A nil matcher leaves env values as-is.
+func newImageDetails(info image.InspectResponse, secrets *utils.SecretMatcher) ImageDetails {
+	d := ImageDetails{
+		ID:            info.ID,
+		RepoTags:      nonNil(info.RepoTags),
+		RepoDigests:   nonNil(info.RepoDigests),
+		Parent:        info.Parent,
+		Comment:       info.Comment,
+		Created:       info.Created,
+		Author:        info.Author,
+		DockerVersion: info.DockerVersion,
+		Architecture:  info.Architecture,
+		Variant:       info.Variant,
+		OS:            info.Os,
+		Size:          info.Size,
+		Layers:        nonNil(info.RootFS.Layers),
+		SecretsMasked: secrets != nil,
+		Config: ImageConfigInfo{
+			Env: []EnvEntry{}, Cmd: []string{}, Entrypoint: []string{}, Shell: []string{},
+			ExposedPorts: []string{}, Volumes: []string{}, Healthcheck: []string{}, OnBuild: []string{},
+		},
+	}
+	if cfg := info.Config; cfg != nil {
+		d.Config.User = cfg.User
+		d.Config.Env = envEntries(cfg.Env, secrets)
+		d.Config.Cmd = nonNil(cfg.Cmd)
+		d.Config.Entrypoint = nonNil(cfg.Entrypoint)
+		d.Config.Shell = nonNil(cfg.Shell)
+		d.Config.WorkingDir = cfg.WorkingDir
+		d.Config.Labels = cfg.Labels
+		d.Config.StopSignal = cfg.StopSignal
+		d.Config.OnBuild = nonNil(cfg.OnBuild)
+		if hc := cfg.Healthcheck; hc != nil {
+			d.Config.Healthcheck = nonNil(hc.Test)
+		}
+		for p := range cfg.ExposedPorts {
+			d.Config.ExposedPorts = append(d.Config.ExposedPorts, p)
+		}
+		sort.Strings(d.Config.ExposedPorts)
+		for v := range cfg.Volumes {
+			d.Config.Volumes = append(d.Config.Volumes, v)
+		}
+		sort.Strings(d.Config.Volumes)
+	}
+	return d
+}
+
+// ImageLayer is one step of an image's history.
+type ImageLayer struct {
+	ID        string `json:"id"`
+	Created   string `json:"created"`
+	CreatedBy string `json:"createdBy"`
+	// Instruction is CreatedBy without the shell wrapper the builder records, e.g. "RUN apk add curl".
+	Instruction string   `json:"instruction"`
+	Comment     string   `json:"comment"`
+	Tags        []string `json:"tags"`
+	Size        int64    `json:"size"`
+	// Percent is the layer's share of the image size.
+	Percent float64 `json:"percent"`
+	// Empty steps only changed metadata (ENV, CMD, LABEL...) and add no filesystem layer.
+	Empty bool `json:"empty"`
+}
+
+type ImageHistory struct {
+	Size          int64        `json:"size"`
+	Layers        []ImageLayer `json:"layers"`
+	SecretsMasked bool         `json:"secretsMasked"`
+}
+
+// GetImageHistory returns the build steps of an image, newest first, with their layer sizes.
+// Build arguments and other NAME=value words with secret-looking names are masked in the
+// steps like env vars in InspectImage, unless ?reveal=true is passed by a caller allowed to
+// see secrets.
+func GetImageHistory(c *gin.Context, cli docker.DockerAPI, cfg Config) {
+	reveal := c.Query("reveal") == "true"
+	if reveal && !c.GetBool(ctxRevealSecrets) {
+		writeAPIError(c, http.StatusForbidden, "Not allowed to reveal secrets", "")
+		return
+	}
+	items, err := cli.ImageHistory(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		writeImageError(c, err, "Failed to get image history")
+		return
+	}
+	h := ImageHistory{Layers: make([]ImageLayer, 0, len(items)), SecretsMasked: !reveal}
+	for _, it := range items {
+		h.Size += it.Size
+	}
+	for _, it := range items {
+		l := ImageLayer{
+			ID:          it.ID,
+			Created:     time.Unix(it.Created, 0).UTC().Format(time.RFC3339),
+			CreatedBy:   it.CreatedBy,
+			Instruction: instruction(it.CreatedBy),
+			Comment:     it.Comment,
+			Tags:        nonNil(it.Tags),
+			Size:        it.Size,
+			Empty:       it.Size == 0,
+		}
+		if h.Size > 0 {
+			l.Percent = float64(it.Size) * 100 / float64(h.Size)
+		}
+		if !reveal {
+			l.CreatedBy = cfg.SecretEnv.MaskAssignments(maskBuildArgs(l.CreatedBy, cfg.SecretEnv))
+			l.Instruction = instruction(l.CreatedBy)
+		}
+		h.Layers = append(h.Layers, l)
+	}
+	c.JSON(http.StatusOK, h)
+}
+
+// instruction recovers the Dockerfile instruction from a history CreatedBy value. The
+// classic builder records "/bin/sh -c #(nop) CMD [...]" for metadata steps and
+// "/bin/sh -c apk add ..." for RUN; BuildKit records "RUN /bin/sh -c apk add ... # buildkit".
+// RUN steps that used build arguments start with them, as in "|1 VERSION=1.2 /bin/sh -c ...".
+func instruction(createdBy string) string {
+	s := strings.TrimSpace(createdBy)
+	s = strings.TrimSuffix(s, "# buildkit")
+	s = strings.TrimSpace(s)
+	rest, run := strings.CutPrefix(s, "RUN ")
+	if _, cmd, ok := splitBuildArgs(rest); ok {
+		// only RUN steps record build arguments
+		rest, run = cmd, true
+	}
+	if cmd, ok := strings.CutPrefix(rest, "/bin/sh -c "); ok {
+		if nop, ok := strings.CutPrefix(cmd, "#(nop) "); ok && !run {
+			return strings.TrimSpace(nop)
+		}
+		return "RUN " + cmd
+	}
+	if run {
+		return "RUN " + rest
+	}
+	return rest
+}
+
+// buildArgCount matches the "|N " the builder records before the N build arguments of a
+// RUN step.
+var buildArgCount = regexp.MustCompile(`^\|(\d+) `)
+
+// shellCommand matches the shell a RUN command starts with, such as " /bin/sh -c ".
+var shellCommand = regexp.MustCompile(` /\S+ -c `)
+
+// buildArgName matches the start of each NAME=value build argument.
+var buildArgName = regexp.MustCompile(`(?:^| )([A-Za-z_][A-Za-z0-9_]*)=`)
+
+// splitBuildArgs splits a RUN step into its "|N NAME=value..." build arguments and the
+// command after them; ok is false when there are none. Values are not quoted in history and
+// may contain spaces, so the command is found by the shell it starts with. Without one, the
+// arguments are taken to be N words and cmd may hold the end of a value.
+func splitBuildArgs(s string) (args, cmd string, ok bool) {
+	m := buildArgCount.FindStringSubmatch(s)
+	if m == nil {
+		return "", s, false
+	}
+	n, err := strconv.Atoi(m[1])
+	if err != nil {
+		return "", s, false
+	}
+	rest := s[len(m[0]):]
+	if loc := shellCommand.FindStringIndex(rest); loc != nil {
+		return s[:len(m[0])+loc[0]], rest[loc[0]+1:], true
+	}
+	fields := strings.SplitN(rest, " ", n+1)
+	if len(fields) < n {
+		return "", s, false
+	}
+	if len(fields) == n {
+		return s, "", true
+	}
+	return s[:len(s)-len(fields[n])-1], fields[n], true
+}
+
+// maskBuildArgs masks the build arguments of a RUN step from the first one with a secret
+// name up to the command, so a value with spaces is hidden whole along with any arguments
+// after it. Without a shell marking where the command starts, everything after that
+// argument is masked.
+func maskBuildArgs(createdBy string, secrets *utils.SecretMatcher) string {
+	run := ""
+	s := createdBy
+	if rest, ok := strings.CutPrefix(s, "RUN "); ok {
+		run, s = "RUN ", rest
+	}
+	args, cmd, ok := splitBuildArgs(s)
+	if !ok {
+		return createdBy
+	}
+	loc := shellCommand.FindStringIndex(" " + cmd)
+	shell := loc != nil && loc[0] == 0
+	for _, m := range buildArgName.FindAllStringSubmatchIndex(args, -1) {
+		name := args[m[2]:m[3]]
+		if !secrets.IsSecret(name) {
+			continue
+		}
+		masked := run + args[:m[3]] + "=" + utils.MaskedValue
+		if shell {
+			masked += " " + cmd
+		}
+		return masked
+	}
+	return createdBy
+}
+
+func writeImageError(c *gin.Context, err error, message string) {
+	status := http.StatusInternalServerError
+	if cerrdefs.IsNotFound(err) {
+		status = http.StatusNotFound
+	}
+	writeAPIError(c, status, message, err.Error())
+}
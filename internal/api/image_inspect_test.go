@@ -0,0 +1,94 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/Nebula-work/docker-web/internal/utils"
+)
+
+func TestImageHistoryMasking(t *testing.T) {
+	secrets := utils.NewSecretMatcher(nil)
+	tests := []struct {
+		name, createdBy, wantCreatedBy, wantInstruction string
+	}{
+		{
+			"classic metadata step",
+			"/bin/sh -c #(nop)  CMD [\"nginx\"]",
+			"/bin/sh -c #(nop)  CMD [\"nginx\"]",
+			"CMD [\"nginx\"]",
+		},
+		{
+			"buildkit run",
+			"RUN /bin/sh -c apk add curl # buildkit",
+			"RUN /bin/sh -c apk add curl # buildkit",
+			"RUN apk add curl",
+		},
+		{
+			"plain build arg",
+			"|1 VERSION=1.2 /bin/sh -c make",
+			"|1 VERSION=1.2 /bin/sh -c make",
+			"RUN make",
+		},
+		{
+			"secret build arg",
+			"|2 VERSION=1.2 TOKEN=abc /bin/sh -c make",
+			"|2 VERSION=1.2 TOKEN=******** /bin/sh -c make",
+			"RUN make",
+		},
+		{
+			"secret build arg with a space",
+			"|1 TOKEN=abc def /bin/sh -c make",
+			"|1 TOKEN=******** /bin/sh -c make",
+			"RUN make",
+		},
+		{
+			"arguments after a secret with a space",
+			"RUN |2 API_KEY=abc def VERSION=1.2 /bin/sh -c make # buildkit",
+			"RUN |2 API_KEY=******** /bin/sh -c make # buildkit",
+			"RUN make",
+		},
+		{
+			"custom shell",
+			"|1 PASSWORD=a b c /bin/bash -c make",
+			"|1 PASSWORD=******** /bin/bash -c make",
+			"RUN /bin/bash -c make",
+		},
+		{
+			"no shell",
+			"RUN |1 TOKEN=abc def make install",
+			"RUN |1 TOKEN=********",
+			"RUN ",
+		},
+		{
+			"secret assignment in the command",
+			"|1 VERSION=1.2 /bin/sh -c DB_PASSWORD=hunter2 ./migrate",
+			"|1 VERSION=1.2 /bin/sh -c DB_PASSWORD=******** ./migrate",
+			"RUN DB_PASSWORD=******** ./migrate",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			createdBy := secrets.MaskAssignments(maskBuildArgs(tt.createdBy, secrets))
+			if createdBy != tt.wantCreatedBy {
+				t.Errorf("masked createdBy = %q, want %q", createdBy, tt.wantCreatedBy)
+			}
+			if got := instruction(createdBy); got != tt.wantInstruction {
+				t.Errorf("instruction(%q) = %q, want %q", createdBy, got, tt.wantInstruction)
+			}
+		})
+	}
+}
+
+func TestInstructionStripsBuildArgs(t *testing.T) {
+	tests := []struct{ createdBy, want string }{
+		{"|1 MSG=hello world /bin/sh -c echo $MSG", "RUN echo $MSG"},
+		{"|0 /bin/sh -c true", "RUN true"},
+		{"RUN |1 A=b make # buildkit", "RUN make"},
+		{"|x A=b /bin/sh -c true", "|x A=b /bin/sh -c true"},
+	}
+	for _, tt := range tests {
+		if got := instruction(tt.createdBy); got != tt.want {
+			t.Errorf("instruction(%q) = %q, want %q", tt.createdBy, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Nebula-work/docker-web/internal/docker"
+	"github.com/Nebula-work/docker-web/internal/imagefs"
+	"github.com/Nebula-work/docker-web/internal/jobs"
+)
+
+// ImageFilesystem is the layer-by-layer analysis of an image's filesystem.
+type ImageFilesystem struct {
+	ID         string               `json:"id"`
+	TotalSize  int64                `json:"totalSize"`
+	WastedSize int64                `json:"wastedSize"`
+	Efficiency float64              `json:"efficiency"`
+	Layers     []FilesystemLayer    `json:"layers"`
+	Wasted     []imagefs.WastedFile `json:"wasted"`
+}
+
+type FilesystemLayer struct {
+	imagefs.Layer
+	Instruction string `json:"instruction"`
+}
+
+// ImageFiles is a directory listing of an image as it is after Layer is applied.
+type ImageFiles struct {
+	Layer   int                 `json:"layer"`
+	Path    string              `json:"path"`
+	Entries []imagefs.FileEntry `json:"entries"`
+}
+
+// GetImageLayers returns the per-layer change counts and wasted space of an image. The
+// image is exported and analysed in a background job on first use; until it finishes the
+// job is returned with 202 and the request can be repeated once it has succeeded.
+func GetImageLayers(c *gin.Context, cli docker.DockerAPI, cfg Config) {
+	img, ok := analyzedImage(c, cli, cfg)
+	if !ok {
+		return
+	}
+	fs := ImageFilesystem{
+		ID:         img.ID,
+		TotalSize:  img.TotalSize,
+		WastedSize: img.WastedSize,
+		Efficiency: img.Efficiency,
+		Layers:     make([]FilesystemLayer, len(img.Layers)),
+		Wasted:     img.Wasted,
+	}
+	for i, l := range img.Layers {
+		fs.Layers[i] = FilesystemLayer{Layer: l, Instruction: instruction(l.CreatedBy)}
+	}
+	c.JSON(http.StatusOK, fs)
+}
+
+// GetImageFiles lists a directory of an image at a layer (?layer=, default the top one).
+// With ?changes=true only paths that layer touched are listed.
+func GetImageFiles(c *gin.Context, cli docker.DockerAPI, cfg Config) {
+	img, ok := analyzedImage(c, cli, cfg)
+	if !ok {
+		return
+	}
+	layer := len(img.Layers) - 1
+	if v := c.Query("layer"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n >= len(img.Layers) {
+			writeAPIError(c, http.StatusBadRequest, "Invalid layer", "layer must be between 0 and "+strconv.Itoa(len(img.Layers)-1))
+			return
+		}
+		layer = n
+	}
+	dir := c.DefaultQuery("path", "/")
+	entries, err := img.List(layer, dir, c.Query("changes") == "true")
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, imagefs.ErrNotFound) {
+			status = http.StatusNotFound
+		} else if errors.Is(err, imagefs.ErrNotDir) {
+			status = http.StatusBadRequest
+		}
+		writeAPIError(c, status, "Failed to list image files", err.Error()+": "+dir)
+		return
+	}
+	c.JSON(http.StatusOK, ImageFiles{Layer: layer, Path: dir, Entries: entries})
+}
+
+// analyzedImage returns the cached analysis of the image in :id. When there is none yet it
+// replies with the job producing it and returns false. An analysis that failed recently is
+// reported as such rather than retried.
+func analyzedImage(c *gin.Context, cli docker.DockerAPI, cfg Config) (*imagefs.Image, bool) {
+	info, err := cli.ImageInspect(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		writeImageError(c, err, "Failed to inspect image")
+		return nil, false
+	}
+	// image IDs are content digests, so an analysis is valid for the same image on any host
+	id := info.ID
+	if img, ok := cfg.ImageFS.Get(id); ok {
+		return img, true
+	}
+	running := func(jobID string) bool {
+		j, err := cfg.Jobs.Get(jobID)
+		return err == nil && j.Snapshot().Status == jobs.StatusRunning
+	}
+	jobID := cfg.ImageFS.Pending(id, running, func() string {
+		return cfg.Jobs.Start("analyze", id, jobs.Owner{}, analyzeJobTimeout, func(ctx context.Context, j *jobs.Job) error {
+			img, err := analyzeImage(ctx, cli, id, j)
+			if err != nil && !errors.Is(err, context.Canceled) {
+				cfg.ImageFS.Fail(id, j.ID())
+			} else {
+				cfg.ImageFS.Finish(id, img)
+			}
+			return err
+		}).ID()
+	})
+	job, err := cfg.Jobs.Get(jobID)
+	if err != nil {
+		writeAPIError(c, http.StatusInternalServerError, "Failed to start image analysis", err.Error())
+		return nil, false
+	}
+	// the job may have finished between the cache check and now
+	if img, ok := cfg.ImageFS.Get(id); ok {
+		return img, true
+	}
+	if s := job.Snapshot(); s.Status == jobs.StatusFailed {
+		writeAPIError(c, http.StatusBadGateway, "Image analysis failed", s.Error)
+		return nil, false
+	}
+	c.JSON(http.StatusAccepted, job.Snapshot())
+	return nil, false
+}
+
+func analyzeImage(ctx context.Context, cli docker.DockerAPI, id string, j *jobs.Job) (*imagefs.Image, error) {
+	j.Publish(jobs.Event{Type: "log", Message: "Exporting image " + id})
+	reader, err := cli.ImageSave(ctx, []string{id})
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	img, err := imagefs.Analyze(reader)
+	if err != nil {
+		return nil, err
+	}
+	j.Publish(jobs.Event{Type: "log", Message: "Analysed " + strconv.Itoa(len(img.Layers)) + " layers"})
+	j.SetResult("id", id)
+	return img, nil
+}
@@ -0,0 +1,310 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-connections/nat"
+	"github.com/gin-gonic/gin"
+
+	"github.com/Nebula-work/docker-web/internal/docker"
+	"github.com/Nebula-work/docker-web/internal/utils"
+)
+
+// ctxRevealSecrets is set to true on the gin context for callers allowed to see unmasked secrets.
+const ctxRevealSecrets = "revealSecrets"
+
+type ContainerDetails struct {
+	ID            string               `json:"id"`
+	Name          string               `json:"name"`
+	Image         string               `json:"image"`
+	ImageID       string               `json:"imageId"`
+	Created       string               `json:"created"`
+	Platform      string               `json:"platform"`
+	Driver        string               `json:"driver"`
+	RestartCount  int                  `json:"restartCount"`
+	State         ContainerStateInfo   `json:"state"`
+	Config        ContainerConfigInfo  `json:"config"`
+	HostConfig    ContainerHostInfo    `json:"hostConfig"`
+	Mounts        []MountInfo          `json:"mounts"`
+	Network       ContainerNetworkInfo `json:"network"`
+	SecretsMasked bool                 `json:"secretsMasked"`
+}
+
+type ContainerStateInfo struct {
+	Status     string      `json:"status"`
+	Running    bool        `json:"running"`
+	Paused     bool        `json:"paused"`
+	Restarting bool        `json:"restarting"`
+	OOMKilled  bool        `json:"oomKilled"`
+	Dead       bool        `json:"dead"`
+	Pid        int         `json:"pid"`
+	ExitCode   int         `json:"exitCode"`
+	Error      string      `json:"error"`
+	StartedAt  string      `json:"startedAt"`
+	FinishedAt string      `json:"finishedAt"`
+	Health     *HealthInfo `json:"health"`
+}
+
+type HealthInfo struct {
+	Status        string            `json:"status"`
+	FailingStreak int               `json:"failingStreak"`
+	Log           []HealthCheckInfo `json:"log"`
+}
+
+type HealthCheckInfo struct {
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	ExitCode int    `json:"exitCode"`
+	Output   string `json:"output"`
+}
+
+type ContainerConfigInfo struct {
+	Hostname     string            `json:"hostname"`
+	User         string            `json:"user"`
+	Env          []EnvEntry        `json:"env"`
+	Cmd          []string          `json:"cmd"`
+	Entrypoint   []string          `json:"entrypoint"`
+	WorkingDir   string            `json:"workingDir"`
+	Labels       map[string]string `json:"labels"`
+	ExposedPorts []string          `json:"exposedPorts"`
+	Tty          bool              `json:"tty"`
+	OpenStdin    bool              `json:"openStdin"`
+	StopSignal   string            `json:"stopSignal"`
+}
+
+type EnvEntry struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Masked bool   `json:"masked"`
+}
+
+type ContainerHostInfo struct {
+	NetworkMode    string            `json:"networkMode"`
+	RestartPolicy  string            `json:"restartPolicy"`
+	MaxRetries     int               `json:"maxRetries"`
+	Privileged     bool              `json:"privileged"`
+	AutoRemove     bool              `json:"autoRemove"`
+	ReadonlyRootfs bool              `json:"readonlyRootfs"`
+	Binds          []string          `json:"binds"`
+	PortBindings   []PortBindingInfo `json:"portBindings"`
+	Memory         int64             `json:"memory"`
+	NanoCPUs       int64             `json:"nanoCpus"`
+	CPUShares      int64             `json:"cpuShares"`
+	CapAdd         []string          `json:"capAdd"`
+	CapDrop        []string          `json:"capDrop"`
+	ExtraHosts     []string          `json:"extraHosts"`
+	LogDriver      string            `json:"logDriver"`
+	LogOptions     map[string]string `json:"logOptions"`
+}
+
+type PortBindingInfo struct {
+	ContainerPort string `json:"containerPort"`
+	HostIP        string `json:"hostIp"`
+	HostPort      string `json:"hostPort"`
+}
+
+type MountInfo struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Driver      string `json:"driver"`
+	Mode        string `json:"mode"`
+	RW          bool   `json:"rw"`
+	Propagation string `json:"propagation"`
+}
+
+type ContainerNetworkInfo struct {
+	IPAddress  string            `json:"ipAddress"`
+	Gateway    string            `json:"gateway"`
+	MacAddress string            `json:"macAddress"`
+	Ports      []PortBindingInfo `json:"ports"`
+	Networks   []EndpointInfo    `json:"networks"`
+}
+
+type EndpointInfo struct {
+	Name              string   `json:"name"`
+	NetworkID         string   `json:"networkId"`
+	EndpointID        string   `json:"endpointId"`
+	IPAddress         string   `json:"ipAddress"`
+	IPPrefixLen       int      `json:"ipPrefixLen"`
+	Gateway           string   `json:"gateway"`
+	GlobalIPv6Address string   `json:"globalIpv6Address"`
+	IPv6Gateway       string   `json:"ipv6Gateway"`
+	MacAddress        string   `json:"macAddress"`
+	Aliases           []string `json:"aliases"`
+}
+
+// InspectContainer returns normalised inspect data for a container. Environment variables whose
+// names match the configured secret patterns are masked unless ?reveal=true is passed by a caller
+// allowed to see secrets.
+func InspectContainer(c *gin.Context, cli docker.DockerAPI, cfg Config) {
+	reveal := c.Query("reveal") == "true"
+	if reveal && !c.GetBool(ctxRevealSecrets) {
+		writeAPIError(c, http.StatusForbidden, "Not allowed to reveal secrets", "")
+		return
+	}
+	info, err := cli.ContainerInspect(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if cerrdefs.IsNotFound(err) {
+			status = http.StatusNotFound
+		}
+		writeAPIError(c, status, "Failed to inspect container", err.Error())
+		return
+	}
+	var secrets *utils.SecretMatcher
+	if !reveal {
+		secrets = cfg.SecretEnv
+	}
+	c.JSON(http.StatusOK, newContainerDetails(info, secrets))
+}
+
+// newContainerDetails converts inspect data into ContainerDetails. A nil matcher leaves env values as-is.
+func newContainerDetails(info container.InspectResponse, secrets *utils.SecretMatcher) ContainerDetails {
+	d := ContainerDetails{
+		Mounts:        []MountInfo{},
+		SecretsMasked: secrets != nil,
+	}
+	if base := info.ContainerJSONBase; base != nil {
+		d.ID = base.ID
+		d.Name = strings.TrimPrefix(base.Name, "/")
+		d.ImageID = base.Image
+		d.Created = base.Created
+		d.Platform = base.Platform
+		d.Driver = base.Driver
+		d.RestartCount = base.RestartCount
+		if s := base.State; s != nil {
+			d.State = ContainerStateInfo{
+				Status: s.Status, Running: s.Running, Paused: s.Paused, Restarting: s.Restarting,
+				OOMKilled: s.OOMKilled, Dead: s.Dead, Pid: s.Pid, ExitCode: s.ExitCode,
+				Error: s.Error, StartedAt: s.StartedAt, FinishedAt: s.FinishedAt,
+			}
+			if h := s.Health; h != nil {
+				d.State.Health = &HealthInfo{Status: h.Status, FailingStreak: h.FailingStreak, Log: []HealthCheckInfo{}}
+				for _, r := range h.Log {
+					if r == nil {
+						continue
+					}
+					d.State.Health.Log = append(d.State.Health.Log, HealthCheckInfo{
+						Start: r.Start.Format(time.RFC3339Nano), End: r.End.Format(time.RFC3339Nano),
+						ExitCode: r.ExitCode, Output: r.Output,
+					})
+				}
+			}
+		}
+		if hc := base.HostConfig; hc != nil {
+			d.HostConfig = ContainerHostInfo{
+				NetworkMode:    string(hc.NetworkMode),
+				RestartPolicy:  string(hc.RestartPolicy.Name),
+				MaxRetries:     hc.RestartPolicy.MaximumRetryCount,
+				Privileged:     hc.Privileged,
+				AutoRemove:     hc.AutoRemove,
+				ReadonlyRootfs: hc.ReadonlyRootfs,
+				Binds:          nonNil(hc.Binds),
+				PortBindings:   portBindings(hc.PortBindings),
+				Memory:         hc.Memory,
+				NanoCPUs:       hc.NanoCPUs,
+				CPUShares:      hc.CPUShares,
+				CapAdd:         nonNil([]string(hc.CapAdd)),
+				CapDrop:        nonNil([]string(hc.CapDrop)),
+				ExtraHosts:     nonNil(hc.ExtraHosts),
+				LogDriver:      hc.LogConfig.Type,
+				LogOptions:     hc.LogConfig.Config,
+			}
+		}
+	}
+	if cfg := info.Config; cfg != nil {
+		d.Image = cfg.Image
+		d.Config = ContainerConfigInfo{
+			Hostname:     cfg.Hostname,
+			User:         cfg.User,
+			Env:          envEntries(cfg.Env, secrets),
+			Cmd:          nonNil([]string(cfg.Cmd)),
+			Entrypoint:   nonNil([]string(cfg.Entrypoint)),
+			WorkingDir:   cfg.WorkingDir,
+			Labels:       cfg.Labels,
+			ExposedPorts: []string{},
+			Tty:          cfg.Tty,
+			OpenStdin:    cfg.OpenStdin,
+			StopSignal:   cfg.StopSignal,
+		}
+		for p := range cfg.ExposedPorts {
+			d.Config.ExposedPorts = append(d.Config.ExposedPorts, string(p))
+		}
+		sort.Strings(d.Config.ExposedPorts)
+	}
+	for _, m := range info.Mounts {
+		d.Mounts = append(d.Mounts, MountInfo{
+			Type: string(m.Type), Name: m.Name, Source: m.Source, Destination: m.Destination,
+			Driver: m.Driver, Mode: m.Mode, RW: m.RW, Propagation: string(m.Propagation),
+		})
+	}
+	d.Network = ContainerNetworkInfo{Ports: []PortBindingInfo{}, Networks: []EndpointInfo{}}
+	if ns := info.NetworkSettings; ns != nil {
+		d.Network.IPAddress = ns.IPAddress
+		d.Network.Gateway = ns.Gateway
+		d.Network.MacAddress = ns.MacAddress
+		d.Network.Ports = portBindings(ns.Ports)
+		for name, ep := range ns.Networks {
+			if ep == nil {
+				continue
+			}
+			d.Network.Networks = append(d.Network.Networks, EndpointInfo{
+				Name: name, NetworkID: ep.NetworkID, EndpointID: ep.EndpointID,
+				IPAddress: ep.IPAddress, IPPrefixLen: ep.IPPrefixLen, Gateway: ep.Gateway,
+				GlobalIPv6Address: ep.GlobalIPv6Address, IPv6Gateway: ep.IPv6Gateway,
+				MacAddress: ep.MacAddress, Aliases: nonNil(ep.Aliases),
+			})
+		}
+		sort.Slice(d.Network.Networks, func(i, j int) bool { return d.Network.Networks[i].Name < d.Network.Networks[j].Name })
+	}
+	return d
+}
+
+func envEntries(env []string, secrets *utils.SecretMatcher) []EnvEntry {
+	out := make([]EnvEntry, 0, len(env))
+	for _, kv := range env {
+		k, v, _ := strings.Cut(kv, "=")
+		e := EnvEntry{Key: k, Value: v}
+		if secrets != nil && secrets.IsSecret(k) {
+			e.Value = utils.MaskedValue
+			e.Masked = true
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+// portBindings flattens a PortMap into a sorted list; unpublished ports appear with an empty host side.
+func portBindings(pm nat.PortMap) []PortBindingInfo {
+	out := []PortBindingInfo{}
+	for port, bindings := range pm {
+		if len(bindings) == 0 {
+			out = append(out, PortBindingInfo{ContainerPort: string(port)})
+			continue
+		}
+		for _, b := range bindings {
+			out = append(out, PortBindingInfo{ContainerPort: string(port), HostIP: b.HostIP, HostPort: b.HostPort})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].ContainerPort != out[j].ContainerPort {
+			return out[i].ContainerPort < out[j].ContainerPort
+		}
+		return out[i].HostIP < out[j].HostIP
+	})
+	return out
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
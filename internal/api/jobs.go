@@ -0,0 +1,145 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Nebula-work/docker-web/internal/jobs"
+)
+
+// Per-kind limits for background jobs; they replace the request timeout, which no longer applies.
+const (
+	pullJobTimeout    = 30 * time.Minute
+	pushJobTimeout    = 30 * time.Minute
+	buildJobTimeout   = 60 * time.Minute
+	pruneJobTimeout   = 15 * time.Minute
+	analyzeJobTimeout = 30 * time.Minute
+	backupJobTimeout  = 60 * time.Minute
+	restoreJobTimeout = 60 * time.Minute
+	copyJobTimeout    = 120 * time.Minute
+)
+
+// acceptJob answers a request that started job with 202 and the job's snapshot, and hands the
+// job to the audit middleware so its outcome is recorded when it finishes.
+func acceptJob(c *gin.Context, job *jobs.Job) {
+	c.Set(ctxAuditJob, job)
+	c.JSON(http.StatusAccepted, job.Snapshot())
+}
+
+// jobOwner records the caller as the owner of a job they start.
+func jobOwner(c *gin.Context) jobs.Owner {
+	user, ok := currentAccount(c)
+	if !ok {
+		return jobs.Owner{}
+	}
+	return jobs.Owner{User: user.Username, Selector: user.Selector}
+}
+
+// canAccessJob reports whether the caller may follow or cancel a job started by owner.
+// Administrators may access every job; other users the jobs they started and those of users
+// limited to the same label selector. Jobs without an owner are shared by everyone.
+func canAccessJob(c *gin.Context, cfg Config, owner jobs.Owner) bool {
+	if owner == (jobs.Owner{}) || isAdmin(c, cfg) {
+		return true
+	}
+	user, ok := currentAccount(c)
+	if !ok {
+		return false
+	}
+	return owner.User == user.Username || (user.Selector != "" && owner.Selector == user.Selector)
+}
+
+// accessibleJob returns the :id job, answering 404 when it does not exist or the caller may
+// not access it, so other users' jobs are not revealed.
+func accessibleJob(c *gin.Context, cfg Config) (*jobs.Job, bool) {
+	j, err := cfg.Jobs.Get(c.Param("id"))
+	if err != nil || !canAccessJob(c, cfg, j.Owner()) {
+		writeAPIError(c, http.StatusNotFound, "Job not found", "")
+		return nil, false
+	}
+	return j, true
+}
+
+// ListJobs lists the jobs the caller may access, newest first.
+func ListJobs(c *gin.Context, cfg Config) {
+	all := cfg.Jobs.List()
+	out := make([]jobs.Snapshot, 0, len(all))
+	for _, s := range all {
+		if canAccessJob(c, cfg, s.Owner) {
+			out = append(out, s)
+		}
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+func GetJob(c *gin.Context, cfg Config) {
+	j, ok := accessibleJob(c, cfg)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, j.Snapshot())
+}
+
+// StreamJob replays a job's retained events and then follows it as Server-Sent Events until it
+// finishes, so a job can be re-attached to from any tab. A final "job" event carries the snapshot.
+func StreamJob(c *gin.Context, cfg Config) {
+	j, ok := accessibleJob(c, cfg)
+	if !ok {
+		return
+	}
+	past, live, unsubscribe := j.Subscribe()
+	defer unsubscribe()
+
+	ctx := c.Request.Context()
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Stream(func(w io.Writer) bool {
+		if len(past) > 0 {
+			for _, e := range past {
+				c.SSEvent("message", e)
+			}
+			past = nil
+			return true
+		}
+		select {
+		case e, ok := <-live:
+			if ok {
+				c.SSEvent("message", e)
+				return true
+			}
+			// closed: either the job finished or this subscriber fell behind
+			select {
+			case <-j.Done():
+			default:
+				c.SSEvent("error", gin.H{"message": "subscriber too slow, reconnect to resume"})
+				return false
+			}
+			c.SSEvent("job", j.Snapshot())
+			return false
+		case <-ctx.Done():
+			return false
+		}
+	})
+}
+
+func CancelJob(c *gin.Context, cfg Config) {
+	j, ok := accessibleJob(c, cfg)
+	if !ok {
+		return
+	}
+	err := cfg.Jobs.Cancel(j.ID())
+	switch {
+	case errors.Is(err, jobs.ErrNotFound):
+		writeAPIError(c, http.StatusNotFound, "Job not found", "")
+	case errors.Is(err, jobs.ErrFinished):
+		writeAPIError(c, http.StatusConflict, "Job already finished", "")
+	case err != nil:
+		writeAPIError(c, http.StatusInternalServerError, "Failed to cancel job", err.Error())
+	default:
+		c.JSON(http.StatusAccepted, gin.H{"message": "cancelling"})
+	}
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/gin-gonic/gin"
+)
+
+// maxLogLine caps how much of an unterminated line is buffered before it is flushed as a frame.
+const maxLogLine = 64 * 1024
+
+// LogFrame is one log line sent to the client.
+type LogFrame struct {
+	Stream    string `json:"stream"`
+	Timestamp string `json:"timestamp,omitempty"`
+	Line      string `json:"line"`
+}
+
+// logFrameWriter splits a container output stream into lines and emits one LogFrame per line.
+// The daemon is always asked for timestamps, which prefix every line and are parsed off here.
+type logFrameWriter struct {
+	stream         string
+	keepTimestamps bool
+	emit           func(LogFrame) error
+	buf            []byte
+}
+
+func (w *logFrameWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if err := w.send(w.buf[:i]); err != nil {
+			return 0, err
+		}
+		w.buf = w.buf[i+1:]
+	}
+	if len(w.buf) > maxLogLine {
+		if err := w.Flush(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush emits any buffered partial line.
+func (w *logFrameWriter) Flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	err := w.send(w.buf)
+	w.buf = w.buf[:0]
+	return err
+}
+
+func (w *logFrameWriter) send(line []byte) error {
+	frame := LogFrame{Stream: w.stream}
+	text := strings.TrimSuffix(string(line), "\r")
+	if ts, rest, ok := strings.Cut(text, " "); ok {
+		if _, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+			text = rest
+			if w.keepTimestamps {
+				frame.Timestamp = ts
+			}
+		}
+	}
+	frame.Line = text
+	return w.emit(frame)
+}
+
+// parseLogsOptions builds daemon log options from the tail, since, until, timestamps and follow query parameters.
+// It returns the options and whether timestamps should be included in frames.
+func parseLogsOptions(c *gin.Context) (container.LogsOptions, bool, error) {
+	opts := container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Timestamps: true,
+		Follow:     c.DefaultQuery("follow", "true") != "false",
+		Tail:       c.DefaultQuery("tail", "all"),
+		Since:      c.Query("since"),
+		Until:      c.Query("until"),
+	}
+	if opts.Tail != "all" {
+		if n, err := strconv.Atoi(opts.Tail); err != nil || n < 0 {
+			return opts, false, fmt.Errorf("tail must be a non-negative number or \"all\"")
+		}
+	}
+	for name, v := range map[string]string{"since": opts.Since, "until": opts.Until} {
+		if v != "" && !validLogTime(v) {
+			return opts, false, fmt.Errorf("%s must be an RFC 3339 time, a unix timestamp or a duration such as 10m", name)
+		}
+	}
+	return opts, c.DefaultQuery("timestamps", "true") != "false", nil
+}
+
+// validLogTime accepts the same formats as the daemon's since/until filters.
+func validLogTime(v string) bool {
+	if _, err := time.ParseDuration(v); err == nil {
+		return true
+	}
+	if _, err := strconv.ParseFloat(v, 64); err == nil {
+		return true
+	}
+	for _, layout := range []string{time.RFC3339Nano, time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"} {
+		if _, err := time.Parse(layout, v); err == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -2,26 +2,87 @@ package api
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-// MaxBodySize returns middleware that limits request body size
+// uploadRoutes accept multipart archive uploads, which the handlers stream to disk or the
+// daemon under their own limits.
+var uploadRoutes = []string{
+	"/images/build", "/images/load",
+	"/volumes/:name/restore", "/volumes/:name/files/upload",
+}
+
+// MaxBodySize returns middleware that limits request body size.
+// Multipart requests to uploadRoutes are left to their handlers.
 func MaxBodySize(n int64) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, n)
+		if c.ContentType() != "multipart/form-data" || !matchesRoute(c.FullPath(), uploadRoutes) {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, n)
+		}
 		c.Next()
 	}
 }
 
-// RequestTimeout sets a per-request timeout using context with deadline
+// transferRoutes move image and volume archives, which can take as long as the data takes
+// to copy.
+var transferRoutes = []string{
+	"/images/:id/export", "/images/load",
+	"/volumes/:name/backup", "/volumes/:name/restore", "/volume-backups/:volume/:backup",
+	"/volumes/:name/files/download", "/volumes/:name/files/upload",
+}
+
+// streamRoutes answer with Server-Sent Events or upgrade to a WebSocket, and last until the
+// client disconnects.
+var streamRoutes = []string{
+	"/containers/stats", "/containers/:id/stats", "/events", "/jobs/:id/stream",
+	"/containers/:id/logs", "/containers/:id/exec", "/agent/connect",
+}
+
+// RequestTimeout sets a per-request timeout using context with deadline.
+// Streaming routes are long-lived by design and are left untouched; they end when the client
+// disconnects. So are archive transfers.
 func RequestTimeout(d time.Duration) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		route := c.FullPath()
+		if matchesRoute(route, streamRoutes) || matchesRoute(route, transferRoutes) {
+			c.Next()
+			return
+		}
 		ctx, cancel := context.WithTimeout(c.Request.Context(), d)
 		defer cancel()
 		c.Request = c.Request.WithContext(ctx)
 		c.Next()
 	}
 }
+
+// detachDeadline returns a context with ctx's values that ends after timeout or when ctx is
+// cancelled, as when the client goes away, but not when ctx's deadline passes. It lets work
+// that can outlast the request timeout, such as pulling a missing image, finish.
+func detachDeadline(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	detached, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	stop := context.AfterFunc(ctx, func() {
+		if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			cancel()
+		}
+	})
+	return detached, func() {
+		stop()
+		cancel()
+	}
+}
+
+// matchesRoute reports whether route, as returned by gin's FullPath, is one of routes on
+// the default host or a named one.
+func matchesRoute(route string, routes []string) bool {
+	for _, r := range routes {
+		if strings.HasSuffix(route, r) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/versions"
+	"github.com/gin-gonic/gin"
+
+	"github.com/Nebula-work/docker-web/internal/docker"
+)
+
+type NetworkDetails struct {
+	ID         string            `json:"id"`
+	Name       string            `json:"name"`
+	Driver     string            `json:"driver"`
+	Scope      string            `json:"scope"`
+	Created    string            `json:"created"`
+	Internal   bool              `json:"internal"`
+	Attachable bool              `json:"attachable"`
+	Ingress    bool              `json:"ingress"`
+	EnableIPv4 bool              `json:"enableIpv4"`
+	EnableIPv6 bool              `json:"enableIpv6"`
+	IPAM       NetworkIPAM       `json:"ipam"`
+	Options    map[string]string `json:"options"`
+	Labels     map[string]string `json:"labels"`
+	// ConfigFrom names the config-only network this one takes its configuration from.
+	ConfigFrom string             `json:"configFrom"`
+	Containers []NetworkContainer `json:"containers"`
+}
+
+type NetworkIPAM struct {
+	Driver  string            `json:"driver"`
+	Options map[string]string `json:"options"`
+	Subnets []SubnetInfo      `json:"subnets"`
+}
+
+type SubnetInfo struct {
+	Subnet  string `json:"subnet"`
+	IPRange string `json:"ipRange"`
+	Gateway string `json:"gateway"`
+	// AuxAddresses are addresses reserved from the subnet, by name.
+	AuxAddresses map[string]string `json:"auxAddresses"`
+}
+
+// NetworkContainer is a container connected to a network. Addresses are in CIDR notation
+// and only known while the container runs, as stopped containers have no endpoint.
+type NetworkContainer struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	State       string   `json:"state"`
+	EndpointID  string   `json:"endpointId"`
+	IPv4Address string   `json:"ipv4Address"`
+	IPv6Address string   `json:"ipv6Address"`
+	MacAddress  string   `json:"macAddress"`
+	Aliases     []string `json:"aliases"`
+}
+
+// InspectNetwork returns a network's configuration and every container connected to it,
+// running or stopped, with the addresses of the running ones. :id is a network ID, ID
+// prefix or name.
+func InspectNetwork(c *gin.Context, cli docker.DockerAPI) {
+	ctx := c.Request.Context()
+	info, err := cli.NetworkInspect(ctx, c.Param("id"), network.InspectOptions{})
+	if err != nil {
+		status := http.StatusInternalServerError
+		if cerrdefs.IsNotFound(err) {
+			status = http.StatusNotFound
+		}
+		writeAPIError(c, status, "Failed to inspect network", err.Error())
+		return
+	}
+	// the network only lists endpoints, which stopped containers do not have
+	containers, err := cli.ContainerList(ctx, container.ListOptions{All: true, Filters: filters.NewArgs(filters.Arg("network", info.ID))})
+	if err != nil {
+		writeAPIError(c, http.StatusInternalServerError, "Failed to list network containers", err.Error())
+		return
+	}
+
+	d := newNetworkDetails(info, cli.ClientVersion())
+	seen := map[string]bool{}
+	for _, ct := range containers {
+		nc := NetworkContainer{ID: ct.ID, State: ct.State, Aliases: []string{}}
+		if len(ct.Names) > 0 {
+			nc.Name = strings.TrimPrefix(ct.Names[0], "/")
+		}
+		if ct.NetworkSettings != nil {
+			if ep := ct.NetworkSettings.Networks[info.Name]; ep != nil {
+				nc.Aliases = nonNil(ep.Aliases)
+			}
+		}
+		if ep, ok := info.Containers[ct.ID]; ok {
+			nc.EndpointID = ep.EndpointID
+			nc.IPv4Address = ep.IPv4Address
+			nc.IPv6Address = ep.IPv6Address
+			nc.MacAddress = ep.MacAddress
+		}
+		seen[ct.ID] = true
+		d.Containers = append(d.Containers, nc)
+	}
+	// endpoints without a local container, such as swarm load balancers, are listed as they are
+	for id, ep := range info.Containers {
+		if seen[id] {
+			continue
+		}
+		d.Containers = append(d.Containers, NetworkContainer{
+			ID: id, Name: ep.Name, EndpointID: ep.EndpointID,
+			IPv4Address: ep.IPv4Address, IPv6Address: ep.IPv6Address, MacAddress: ep.MacAddress,
+			Aliases: []string{},
+		})
+	}
+	sort.Slice(d.Containers, func(i, j int) bool { return d.Containers[i].Name < d.Containers[j].Name })
+	c.JSON(http.StatusOK, d)
+}
+
+// newNetworkDetails converts inspect data fetched over API version apiVersion.
+func newNetworkDetails(info network.Inspect, apiVersion string) NetworkDetails {
+	d := NetworkDetails{
+		ID:         info.ID,
+		Name:       info.Name,
+		Driver:     info.Driver,
+		Scope:      info.Scope,
+		Created:    info.Created.Format(time.RFC3339Nano),
+		Internal:   info.Internal,
+		Attachable: info.Attachable,
+		Ingress:    info.Ingress,
+		EnableIPv4: info.EnableIPv4,
+		EnableIPv6: info.EnableIPv6,
+		IPAM: NetworkIPAM{
+			Driver:  info.IPAM.Driver,
+			Options: info.IPAM.Options,
+			Subnets: []SubnetInfo{},
+		},
+		Options:    info.Options,
+		Labels:     info.Labels,
+		ConfigFrom: info.ConfigFrom.Network,
+		Containers: []NetworkContainer{},
+	}
+	// daemons older than API 1.47 do not report EnableIPv4, but IPv4 was always on there
+	if versions.LessThan(apiVersion, "1.47") {
+		d.EnableIPv4 = true
+	}
+	for _, cfg := range info.IPAM.Config {
+		d.IPAM.Subnets = append(d.IPAM.Subnets, SubnetInfo{
+			Subnet: cfg.Subnet, IPRange: cfg.IPRange, Gateway: cfg.Gateway, AuxAddresses: cfg.AuxAddress,
+		})
+	}
+	return d
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/docker/docker/api/types/build"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/gin-gonic/gin"
+
+	"github.com/Nebula-work/docker-web/internal/docker"
+	"github.com/Nebula-work/docker-web/internal/jobs"
+)
+
+type PruneRequest struct {
+	Containers bool `json:"containers"`
+	Images     bool `json:"images"`
+	Volumes    bool `json:"volumes"`
+	Networks   bool `json:"networks"`
+	BuildCache bool `json:"buildCache"`
+	// AllImages removes every unused image instead of only dangling ones.
+	AllImages bool `json:"allImages"`
+	// AllVolumes includes unused named volumes, not just anonymous ones.
+	AllVolumes bool `json:"allVolumes"`
+	// Until limits pruning to objects created before this timestamp or duration.
+	Until string `json:"until"`
+	// Labels limits pruning to objects carrying these labels ("key" or "key=value").
+	Labels []string `json:"labels"`
+}
+
+// PruneSystem starts a background job that removes unused objects of the requested kinds.
+func PruneSystem(c *gin.Context, cli docker.DockerAPI, cfg Config) {
+	var req PruneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeAPIError(c, http.StatusBadRequest, "Invalid prune request", err.Error())
+		return
+	}
+	if !req.Containers && !req.Images && !req.Volumes && !req.Networks && !req.BuildCache {
+		writeAPIError(c, http.StatusBadRequest, "Invalid prune request", "select at least one kind of object to prune")
+		return
+	}
+	if req.Until != "" && !validLogTime(req.Until) {
+		writeAPIError(c, http.StatusBadRequest, "Invalid prune request", "until must be a time, unix timestamp or duration")
+		return
+	}
+
+	var kinds []string
+	for _, k := range []struct {
+		name string
+		on   bool
+	}{{"containers", req.Containers}, {"networks", req.Networks}, {"volumes", req.Volumes}, {"images", req.Images}, {"buildCache", req.BuildCache}} {
+		if k.on {
+			kinds = append(kinds, k.name)
+		}
+	}
+	job := cfg.Jobs.Start("prune", strings.Join(kinds, ","), jobOwner(c), pruneJobTimeout, func(ctx context.Context, j *jobs.Job) error {
+		return runPrune(ctx, cli, req, j)
+	})
+	acceptJob(c, job)
+}
+
+func runPrune(ctx context.Context, cli docker.DockerAPI, req PruneRequest, j *jobs.Job) error {
+	base := func() filters.Args {
+		args := filters.NewArgs()
+		if req.Until != "" {
+			args.Add("until", req.Until)
+		}
+		for _, l := range req.Labels {
+			args.Add("label", l)
+		}
+		return args
+	}
+	var reclaimed uint64
+	report := func(kind string, deleted int, space uint64) {
+		reclaimed += space
+		j.SetResult(kind, gin.H{"deleted": deleted, "spaceReclaimed": space})
+		j.Publish(jobs.Event{Type: "log", Message: fmt.Sprintf("%s: removed %d, reclaimed %d bytes", kind, deleted, space)})
+	}
+
+	if req.Containers {
+		r, err := cli.ContainersPrune(ctx, base())
+		if err != nil {
+			return fmt.Errorf("containers: %w", err)
+		}
+		report("containers", len(r.ContainersDeleted), r.SpaceReclaimed)
+	}
+	if req.Networks {
+		r, err := cli.NetworksPrune(ctx, base())
+		if err != nil {
+			return fmt.Errorf("networks: %w", err)
+		}
+		report("networks", len(r.NetworksDeleted), 0)
+	}
+	if req.Volumes {
+		args := filters.NewArgs()
+		for _, l := range req.Labels {
+			args.Add("label", l)
+		}
+		if req.AllVolumes {
+			args.Add("all", "true")
+		}
+		r, err := cli.VolumesPrune(ctx, args)
+		if err != nil {
+			return fmt.Errorf("volumes: %w", err)
+		}
+		report("volumes", len(r.VolumesDeleted), r.SpaceReclaimed)
+	}
+	if req.Images {
+		args := base()
+		args.Add("dangling", fmt.Sprint(!req.AllImages))
+		r, err := cli.ImagesPrune(ctx, args)
+		if err != nil {
+			return fmt.Errorf("images: %w", err)
+		}
+		report("images", len(r.ImagesDeleted), r.SpaceReclaimed)
+	}
+	if req.BuildCache {
+		// the build cache has no labels, so only the until filter applies
+		args := filters.NewArgs()
+		if req.Until != "" {
+			args.Add("until", req.Until)
+		}
+		r, err := cli.BuildCachePrune(ctx, build.CachePruneOptions{All: req.AllImages, Filters: args})
+		if err != nil {
+			return fmt.Errorf("build cache: %w", err)
+		}
+		report("buildCache", len(r.CachesDeleted), r.SpaceReclaimed)
+	}
+	j.SetResult("spaceReclaimed", reclaimed)
+	return nil
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"net/http"
+
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/gin-gonic/gin"
+
+	"github.com/Nebula-work/docker-web/internal/auth"
+)
+
+// ctxAccount holds the authenticated auth.User on the gin context.
+const ctxAccount = "account"
+
+// currentAccount returns the authenticated user, if authentication is enabled.
+func currentAccount(c *gin.Context) (auth.User, bool) {
+	v, ok := c.Get(ctxAccount)
+	if !ok {
+		return auth.User{}, false
+	}
+	u, ok := v.(auth.User)
+	return u, ok
+}
+
+// authorize rejects callers whose role does not grant action. It is a no-op when
+// authentication is disabled.
+func authorize(cfg Config, action auth.Action) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		permit(c, cfg, action)
+	}
+}
+
+// permit checks the caller's role against action, aborting with 403 when it is not granted.
+// It also records whether the caller may reveal secrets, as everyone may when authentication
+// is disabled.
+func permit(c *gin.Context, cfg Config, action auth.Action) bool {
+	if cfg.Tokens == nil {
+		c.Set(ctxRevealSecrets, true)
+		return true
+	}
+	user, ok := currentAccount(c)
+	if !ok || !user.Role.Can(action) {
+		writeAPIError(c, http.StatusForbidden, "Permission denied", "role does not allow "+string(action))
+		return false
+	}
+	c.Set(ctxRevealSecrets, user.Role.Can(auth.ActionSecrets))
+	return true
+}
+
+// isAdmin reports whether the caller holds the admin action, as everyone does when
+// authentication is disabled. Unlike permit it does not write a response.
+func isAdmin(c *gin.Context, cfg Config) bool {
+	if cfg.Tokens == nil {
+		return true
+	}
+	user, ok := currentAccount(c)
+	return ok && user.Role.Can(auth.ActionAdmin)
+}
+
+// authorizeContainer is authorize for routes acting on the :id container. Users with a label
+// selector may only act on containers whose labels match it.
+func authorizeContainer(cfg Config, action auth.Action) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !permit(c, cfg, action) {
+			return
+		}
+		user, ok := currentAccount(c)
+		if !ok || !user.Scoped(action) {
+			return
+		}
+		sel, err := auth.ParseSelector(user.Selector)
+		if err != nil {
+			writeAPIError(c, http.StatusForbidden, "Permission denied", "invalid label selector on account")
+			return
+		}
+		info, err := hostClient(c).ContainerInspect(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			status := http.StatusInternalServerError
+			if cerrdefs.IsNotFound(err) {
+				status = http.StatusNotFound
+			}
+			writeAPIError(c, status, "Failed to inspect container", err.Error())
+			return
+		}
+		var labels map[string]string
+		if info.Config != nil {
+			labels = info.Config.Labels
+		}
+		if !sel.Matches(labels) {
+			writeAPIError(c, http.StatusForbidden, "Permission denied", "container is outside your label scope "+user.Selector)
+			return
+		}
+	}
+}
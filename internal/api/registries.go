@@ -0,0 +1,198 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/registry"
+	"github.com/gin-gonic/gin"
+
+	"github.com/Nebula-work/docker-web/internal/credentials"
+	"github.com/Nebula-work/docker-web/internal/docker"
+	"github.com/Nebula-work/docker-web/internal/jobs"
+)
+
+// RegistryLoginRequest signs in to a registry; an empty Registry means Docker Hub.
+type RegistryLoginRequest struct {
+	Registry string `json:"registry"`
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+func ListRegistries(c *gin.Context, cfg Config) {
+	c.JSON(http.StatusOK, cfg.Credentials.List())
+}
+
+// LoginRegistry checks the credentials against the registry through the Docker daemon and
+// stores them only if the registry accepts them. When the registry hands out an identity
+// token it is stored instead of the password.
+func LoginRegistry(c *gin.Context, cli docker.DockerAPI, cfg Config) {
+	var req RegistryLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeAPIError(c, http.StatusBadRequest, "Invalid login", err.Error())
+		return
+	}
+	name := credentials.NormalizeRegistry(req.Registry)
+	setAuditTarget(c, name)
+	res, err := cli.RegistryLogin(c.Request.Context(), registry.AuthConfig{
+		Username:      req.Username,
+		Password:      req.Password,
+		ServerAddress: credentials.ServerAddress(name),
+	})
+	if err != nil {
+		status := http.StatusBadGateway
+		if cerrdefs.IsUnauthorized(err) || cerrdefs.IsPermissionDenied(err) {
+			status = http.StatusBadRequest
+		}
+		writeAPIError(c, status, "Registry login failed", err.Error())
+		return
+	}
+	cred := credentials.Credential{Registry: name, Username: req.Username, Password: req.Password}
+	if res.IdentityToken != "" {
+		cred.Password, cred.IdentityToken = "", res.IdentityToken
+	}
+	summary, err := cfg.Credentials.Set(cred)
+	if err != nil {
+		writeAPIError(c, http.StatusInternalServerError, "Failed to store credentials", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, summary)
+}
+
+func LogoutRegistry(c *gin.Context, cfg Config) {
+	name := credentials.NormalizeRegistry(c.Param("registry"))
+	setAuditTarget(c, name)
+	if err := cfg.Credentials.Delete(name); err != nil {
+		if errors.Is(err, credentials.ErrNotFound) {
+			writeAPIError(c, http.StatusNotFound, "Registry not found", name)
+			return
+		}
+		writeAPIError(c, http.StatusInternalServerError, "Failed to remove credentials", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "removed"})
+}
+
+func authConfig(cred credentials.Credential) registry.AuthConfig {
+	return registry.AuthConfig{
+		Username:      cred.Username,
+		Password:      cred.Password,
+		IdentityToken: cred.IdentityToken,
+		ServerAddress: credentials.ServerAddress(cred.Registry),
+	}
+}
+
+// registryAuth returns the encoded stored credentials for the registry of ref, or "" when
+// there are none so the daemon tries anonymously.
+func registryAuth(cfg Config, ref string) (string, error) {
+	cred, err := cfg.Credentials.ForImage(ref)
+	if errors.Is(err, credentials.ErrNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return registry.EncodeAuthConfig(authConfig(cred))
+}
+
+// buildAuthConfigs hands every stored login to a build, which may pull base images from
+// any registry.
+func buildAuthConfigs(cfg Config) map[string]registry.AuthConfig {
+	all := cfg.Credentials.All()
+	out := make(map[string]registry.AuthConfig, len(all))
+	for _, cred := range all {
+		out[credentials.ServerAddress(cred.Registry)] = authConfig(cred)
+	}
+	return out
+}
+
+// TagRequest adds a reference to an image, e.g. {"repository": "ghcr.io/org/app", "tag": "1.0"}.
+type TagRequest struct {
+	Repository string `json:"repository" binding:"required"`
+	Tag        string `json:"tag"`
+}
+
+func TagImage(c *gin.Context, cli docker.DockerAPI) {
+	var req TagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeAPIError(c, http.StatusBadRequest, "Invalid tag", err.Error())
+		return
+	}
+	target := req.Repository
+	if req.Tag != "" {
+		target += ":" + req.Tag
+	}
+	if _, err := reference.ParseNormalizedNamed(target); err != nil {
+		writeAPIError(c, http.StatusBadRequest, "Invalid tag", err.Error())
+		return
+	}
+	if err := cli.ImageTag(c.Request.Context(), c.Param("id"), target); err != nil {
+		status := http.StatusInternalServerError
+		if cerrdefs.IsNotFound(err) {
+			status = http.StatusNotFound
+		} else if cerrdefs.IsInvalidArgument(err) {
+			status = http.StatusBadRequest
+		}
+		writeAPIError(c, status, "Failed to tag image", err.Error())
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"image": target})
+}
+
+// PushRequest pushes a tagged image. Auth overrides the stored credentials for this push.
+type PushRequest struct {
+	Image string      `json:"image" binding:"required"`
+	Auth  *AuthConfig `json:"auth"`
+}
+
+// PushImage starts a background push job and returns it; the finished job's result holds
+// the pushed digest.
+func PushImage(c *gin.Context, cli docker.DockerAPI, cfg Config) {
+	var req PushRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeAPIError(c, http.StatusBadRequest, "Invalid push request", err.Error())
+		return
+	}
+	setAuditTarget(c, req.Image)
+	named, err := reference.ParseNormalizedNamed(req.Image)
+	if err != nil {
+		writeAPIError(c, http.StatusBadRequest, "Invalid push request", err.Error())
+		return
+	}
+	// pushing a bare name would push every tag of the repository
+	ref := reference.TagNameOnly(named).String()
+	opts := image.PushOptions{}
+	if opts.RegistryAuth, err = requestAuth(cfg, ref, req.Auth); err != nil {
+		writeAPIError(c, http.StatusInternalServerError, "Failed to encode auth config", err.Error())
+		return
+	}
+	job := cfg.Jobs.Start("push", ref, jobOwner(c), pushJobTimeout, func(ctx context.Context, j *jobs.Job) error {
+		reader, err := cli.ImagePush(ctx, ref, opts)
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		return j.ConsumeDaemonStream(reader)
+	})
+	acceptJob(c, job)
+}
+
+// requestAuth encodes the credentials sent with a request, falling back to the stored ones.
+func requestAuth(cfg Config, ref string, auth *AuthConfig) (string, error) {
+	if auth == nil || auth.Username == "" {
+		return registryAuth(cfg, ref)
+	}
+	registryName, err := credentials.RegistryOf(ref)
+	if err != nil {
+		return "", err
+	}
+	return registry.EncodeAuthConfig(registry.AuthConfig{
+		Username:      auth.Username,
+		Password:      auth.Password,
+		ServerAddress: credentials.ServerAddress(registryName),
+	})
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Nebula-work/docker-web/internal/credentials"
+	"github.com/Nebula-work/docker-web/internal/registryclient"
+)
+
+// registryClient returns a client for the :registry parameter using its stored login, if any.
+func registryClient(c *gin.Context, cfg Config) *registryclient.Client {
+	name := credentials.NormalizeRegistry(c.Param("registry"))
+	var cred *credentials.Credential
+	if stored, err := cfg.Credentials.Get(name); err == nil {
+		cred = &stored
+	}
+	return registryclient.New(name, cred, slices.Contains(cfg.InsecureRegistries, name))
+}
+
+// pageParams reads the n and last query parameters of a paginated registry listing.
+func pageParams(c *gin.Context) (int, string, bool) {
+	n := 0
+	if v := c.Query("n"); v != "" {
+		var err error
+		if n, err = strconv.Atoi(v); err != nil || n < 1 || n > 1000 {
+			writeAPIError(c, http.StatusBadRequest, "Invalid page size", "n must be between 1 and 1000")
+			return 0, "", false
+		}
+	}
+	return n, c.Query("last"), true
+}
+
+// ListRepositories returns a page of the registry's catalog.
+func ListRepositories(c *gin.Context, cfg Config) {
+	n, last, ok := pageParams(c)
+	if !ok {
+		return
+	}
+	page, err := registryClient(c, cfg).Repositories(c.Request.Context(), n, last)
+	if err != nil {
+		writeRegistryError(c, err, "Failed to list repositories")
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// ListRepositoryTags returns a page of the tags of the ?repository= repository.
+func ListRepositoryTags(c *gin.Context, cfg Config) {
+	repo := c.Query("repository")
+	if repo == "" {
+		writeAPIError(c, http.StatusBadRequest, "Repository is required", "")
+		return
+	}
+	n, last, ok := pageParams(c)
+	if !ok {
+		return
+	}
+	page, err := registryClient(c, cfg).Tags(c.Request.Context(), repo, n, last)
+	if err != nil {
+		writeRegistryError(c, err, "Failed to list tags")
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// GetRegistryManifest returns the manifest of ?repository= at ?reference= (a tag or digest,
+// default latest), including the digest of each platform of a multi-platform image.
+func GetRegistryManifest(c *gin.Context, cfg Config) {
+	repo := c.Query("repository")
+	if repo == "" {
+		writeAPIError(c, http.StatusBadRequest, "Repository is required", "")
+		return
+	}
+	ref := c.DefaultQuery("reference", "latest")
+	m, err := registryClient(c, cfg).Manifest(c.Request.Context(), repo, ref)
+	if err != nil {
+		writeRegistryError(c, err, "Failed to get manifest")
+		return
+	}
+	c.JSON(http.StatusOK, m)
+}
+
+// DeleteRegistryTag deletes ?tag= from ?repository=. Registries delete whole manifests, so
+// other tags of the same digest disappear too; the response names the deleted digest.
+func DeleteRegistryTag(c *gin.Context, cfg Config) {
+	repo, tag := c.Query("repository"), c.Query("tag")
+	if repo == "" || tag == "" {
+		writeAPIError(c, http.StatusBadRequest, "Repository and tag are required", "")
+		return
+	}
+	setAuditTarget(c, credentials.NormalizeRegistry(c.Param("registry"))+"/"+repo+":"+tag)
+	digest, err := registryClient(c, cfg).DeleteTag(c.Request.Context(), repo, tag)
+	if err != nil {
+		writeRegistryError(c, err, "Failed to delete tag")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"digest": digest})
+}
+
+func writeRegistryError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, registryclient.ErrInvalid):
+		writeAPIError(c, http.StatusBadRequest, message, err.Error())
+	case errors.Is(err, registryclient.ErrNotFound):
+		writeAPIError(c, http.StatusNotFound, message, err.Error())
+	case errors.Is(err, registryclient.ErrUnauthorized):
+		writeAPIError(c, http.StatusForbidden, message, err.Error())
+	case errors.Is(err, registryclient.ErrUnsupported):
+		writeAPIError(c, http.StatusMethodNotAllowed, message, err.Error())
+	default:
+		writeAPIError(c, http.StatusBadGateway, message, err.Error())
+	}
+}
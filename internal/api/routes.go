@@ -1,32 +1,136 @@
 package api
 
 import (
-	"github.com/Nebula-work/docker-web/internal/docker"
+	"github.com/Nebula-work/docker-web/internal/auth"
 	"github.com/gin-gonic/gin"
 )
 
-func RegisterRoutes(rg *gin.RouterGroup, cli docker.DockerAPI) {
-	// container routes
-	rg.GET("/containers", func(c *gin.Context) { ListContainers(c, cli) })
-	rg.POST("/containers/:id/start", func(c *gin.Context) { StartContainer(c, cli) })
-	rg.POST("/containers/:id/stop", func(c *gin.Context) { StopContainer(c, cli) })
-	rg.POST("/containers/:id/restart", func(c *gin.Context) { RestartContainer(c, cli) })
-	rg.DELETE("/containers/:id", func(c *gin.Context) { RemoveContainer(c, cli) })
-	rg.GET("/containers/:id/logs", func(c *gin.Context) { StreamContainerLogs(c, cli) })
-
-	// images
-	rg.GET("/images", func(c *gin.Context) { ListImages(c, cli) })
-	rg.POST("/images/pull", func(c *gin.Context) { PullImage(c, cli) })
-	rg.POST("/images/build", func(c *gin.Context) { BuildImage(c, cli) })
-	rg.DELETE("/images/:id", func(c *gin.Context) { RemoveImage(c, cli) })
-
-	// volumes
-	rg.GET("/volumes", func(c *gin.Context) { ListVolumes(c, cli) })
-	rg.POST("/volumes", func(c *gin.Context) { CreateVolume(c, cli) })
-	rg.DELETE("/volumes/:id", func(c *gin.Context) { RemoveVolume(c, cli) })
-
-	// networks
-	rg.GET("/networks", func(c *gin.Context) { ListNetworks(c, cli) })
-	rg.POST("/networks", func(c *gin.Context) { CreateNetwork(c, cli) })
-	rg.DELETE("/networks/:id", func(c *gin.Context) { RemoveNetwork(c, cli) })
+func RegisterRoutes(rg *gin.RouterGroup, cfg Config) {
+	cfg.setDefaults()
+	admin := authorize(cfg, auth.ActionAdmin)
+
+	// agents authenticate with their own host token
+	rg.GET("/agent/connect", func(c *gin.Context) { ConnectAgent(c, cfg) })
+
+	// authentication; everything registered after this block requires a valid access token
+	if cfg.Tokens != nil {
+		rg.POST("/auth/login", audited(cfg, "auth.login"), func(c *gin.Context) { Login(c, cfg) })
+		rg.POST("/auth/refresh", func(c *gin.Context) { RefreshToken(c, cfg) })
+		rg.POST("/auth/logout", func(c *gin.Context) { Logout(c, cfg) })
+		rg = rg.Group("", RequireAuth(cfg))
+		rg.GET("/auth/me", func(c *gin.Context) { CurrentUser(c, cfg) })
+		rg.POST("/auth/password", audited(cfg, "auth.password"), func(c *gin.Context) { ChangePassword(c, cfg) })
+
+		// user management
+		rg.GET("/users", admin, func(c *gin.Context) { ListUsers(c, cfg) })
+		rg.POST("/users", audited(cfg, "user.create"), admin, func(c *gin.Context) { CreateUser(c, cfg) })
+		rg.PUT("/users/:username", audited(cfg, "user.update"), admin, func(c *gin.Context) { UpdateUser(c, cfg) })
+		rg.DELETE("/users/:username", audited(cfg, "user.delete"), admin, func(c *gin.Context) { DeleteUser(c, cfg) })
+	}
+
+	// permission checks; container-scoped variants also enforce the caller's label selector
+	view := authorize(cfg, auth.ActionView)
+	create := authorize(cfg, auth.ActionCreate)
+	build := authorize(cfg, auth.ActionBuild)
+	remove := authorize(cfg, auth.ActionRemove)
+	operate := authorize(cfg, auth.ActionOperate)
+	networkChange := authorize(cfg, auth.ActionNetwork)
+	operateContainer := authorizeContainer(cfg, auth.ActionOperate)
+	execContainer := authorizeContainer(cfg, auth.ActionExec)
+	removeContainer := authorizeContainer(cfg, auth.ActionRemove)
+
+	// background jobs
+	rg.GET("/jobs", view, func(c *gin.Context) { ListJobs(c, cfg) })
+	rg.GET("/jobs/:id", view, func(c *gin.Context) { GetJob(c, cfg) })
+	rg.GET("/jobs/:id/stream", view, func(c *gin.Context) { StreamJob(c, cfg) })
+	rg.DELETE("/jobs/:id", audited(cfg, "job.cancel"), operate, func(c *gin.Context) { CancelJob(c, cfg) })
+
+	// audit log
+	if cfg.Audit != nil {
+		rg.GET("/audit", admin, func(c *gin.Context) { QueryAudit(c, cfg) })
+		rg.GET("/audit/export", admin, func(c *gin.Context) { ExportAudit(c, cfg) })
+	}
+
+	// docker hosts
+	rg.GET("/hosts", view, func(c *gin.Context) { ListHosts(c, cfg) })
+	rg.POST("/hosts", audited(cfg, "host.add"), admin, func(c *gin.Context) { AddHost(c, cfg) })
+	rg.GET("/hosts/:host", view, func(c *gin.Context) { GetHost(c, cfg) })
+	rg.DELETE("/hosts/:host", audited(cfg, "host.remove"), admin, func(c *gin.Context) { RemoveHost(c, cfg) })
+
+	// registry credentials
+	rg.GET("/registries", view, func(c *gin.Context) { ListRegistries(c, cfg) })
+	rg.DELETE("/registries/:registry", audited(cfg, "registry.logout"), admin, func(c *gin.Context) { LogoutRegistry(c, cfg) })
+
+	// remote registry browsing reaches arbitrary hosts like a pull does, so it needs the same right
+	rg.GET("/registries/:registry/repositories", create, func(c *gin.Context) { ListRepositories(c, cfg) })
+	rg.GET("/registries/:registry/tags", create, func(c *gin.Context) { ListRepositoryTags(c, cfg) })
+	rg.GET("/registries/:registry/manifest", create, func(c *gin.Context) { GetRegistryManifest(c, cfg) })
+	rg.DELETE("/registries/:registry/tags", audited(cfg, "registry.untag"), remove, func(c *gin.Context) { DeleteRegistryTag(c, cfg) })
+
+	// stored volume backups live on this server, not on a Docker host
+	if cfg.Backups != nil {
+		rg.GET("/volume-backups", view, func(c *gin.Context) { ListVolumeBackups(c, cfg) })
+		rg.GET("/volume-backups/:volume/:backup", create, func(c *gin.Context) { DownloadVolumeBackup(c, cfg) })
+		rg.DELETE("/volume-backups/:volume/:backup", audited(cfg, "volume.backup.remove"), remove, func(c *gin.Context) { DeleteVolumeBackup(c, cfg) })
+	}
+
+	// daemon routes act on the default host, or on a named one under /hosts/:host
+	for _, dr := range []*gin.RouterGroup{rg.Group("", useHost(cfg)), rg.Group("/hosts/:host", useHost(cfg))} {
+		// container routes
+		dr.GET("/containers", view, func(c *gin.Context) { ListContainers(c, hostClient(c)) })
+		dr.POST("/containers", audited(cfg, "container.create"), create, func(c *gin.Context) { CreateContainer(c, hostClient(c), cfg) })
+		dr.GET("/containers/stats", view, func(c *gin.Context) { StreamAllContainerStats(c, hostClient(c)) })
+		dr.POST("/containers/:id/start", audited(cfg, "container.start"), operateContainer, func(c *gin.Context) { StartContainer(c, hostClient(c)) })
+		dr.POST("/containers/:id/stop", audited(cfg, "container.stop"), operateContainer, func(c *gin.Context) { StopContainer(c, hostClient(c)) })
+		dr.POST("/containers/:id/restart", audited(cfg, "container.restart"), operateContainer, func(c *gin.Context) { RestartContainer(c, hostClient(c)) })
+		dr.GET("/containers/:id", view, func(c *gin.Context) { InspectContainer(c, hostClient(c), cfg) })
+		dr.DELETE("/containers/:id", audited(cfg, "container.remove"), removeContainer, func(c *gin.Context) { RemoveContainer(c, hostClient(c)) })
+		dr.GET("/containers/:id/logs", view, func(c *gin.Context) { StreamContainerLogs(c, hostClient(c)) })
+		dr.GET("/containers/:id/exec", audited(cfg, "container.exec"), execContainer, func(c *gin.Context) { ExecContainer(c, hostClient(c)) })
+		dr.GET("/containers/:id/stats", view, func(c *gin.Context) { StreamContainerStats(c, hostClient(c)) })
+
+		// images
+		dr.GET("/images", view, func(c *gin.Context) { ListImages(c, hostClient(c)) })
+		dr.GET("/images/:id", view, func(c *gin.Context) { InspectImage(c, hostClient(c), cfg) })
+		dr.GET("/images/:id/history", view, func(c *gin.Context) { GetImageHistory(c, hostClient(c), cfg) })
+		dr.GET("/images/:id/layers", view, func(c *gin.Context) { GetImageLayers(c, hostClient(c), cfg) })
+		dr.GET("/images/:id/files", view, func(c *gin.Context) { GetImageFiles(c, hostClient(c), cfg) })
+		dr.POST("/images/pull", audited(cfg, "image.pull"), create, func(c *gin.Context) { PullImage(c, hostClient(c), cfg) })
+		dr.POST("/images/build", audited(cfg, "image.build"), build, func(c *gin.Context) { BuildImage(c, hostClient(c), cfg) })
+		dr.POST("/images/build/git", audited(cfg, "image.build"), build, func(c *gin.Context) { BuildFromGit(c, hostClient(c), cfg) })
+		dr.POST("/images/push", audited(cfg, "image.push"), build, func(c *gin.Context) { PushImage(c, hostClient(c), cfg) })
+		// an export carries everything baked into the image, so it needs more than view
+		dr.GET("/images/:id/export", audited(cfg, "image.export"), create, func(c *gin.Context) { ExportImages(c, hostClient(c)) })
+		dr.POST("/images/load", audited(cfg, "image.load"), create, func(c *gin.Context) { LoadImages(c, hostClient(c)) })
+		dr.POST("/images/:id/tag", audited(cfg, "image.tag"), build, func(c *gin.Context) { TagImage(c, hostClient(c)) })
+		dr.DELETE("/images/:id", audited(cfg, "image.remove"), remove, func(c *gin.Context) { RemoveImage(c, hostClient(c)) })
+
+		// registry logins are checked by the daemon that will use them
+		dr.POST("/registries/login", audited(cfg, "registry.login"), admin, func(c *gin.Context) { LoginRegistry(c, hostClient(c), cfg) })
+
+		// volumes
+		dr.GET("/volumes", view, func(c *gin.Context) { ListVolumes(c, hostClient(c)) })
+		dr.POST("/volumes", audited(cfg, "volume.create"), create, func(c *gin.Context) { CreateVolume(c, hostClient(c), cfg) })
+		dr.DELETE("/volumes/:name", audited(cfg, "volume.remove"), remove, func(c *gin.Context) { RemoveVolume(c, hostClient(c)) })
+		dr.POST("/volumes/:name/backup", audited(cfg, "volume.backup"), create, func(c *gin.Context) { BackupVolume(c, hostClient(c), cfg) })
+		// a restore overwrites whatever the volume holds
+		dr.POST("/volumes/:name/restore", audited(cfg, "volume.restore"), remove, func(c *gin.Context) { RestoreVolume(c, hostClient(c), cfg) })
+		dr.POST("/volumes/:name/copy", audited(cfg, "volume.copy"), create, func(c *gin.Context) { CopyVolume(c, hostClient(c), cfg) })
+		dr.GET("/volumes/:name/files", create, func(c *gin.Context) { ListVolumeFiles(c, hostClient(c), cfg) })
+		dr.GET("/volumes/:name/files/download", create, func(c *gin.Context) { DownloadVolumeFiles(c, hostClient(c), cfg) })
+		dr.POST("/volumes/:name/files/upload", audited(cfg, "volume.files.upload"), create, func(c *gin.Context) { UploadVolumeFiles(c, hostClient(c), cfg) })
+		dr.DELETE("/volumes/:name/files", audited(cfg, "volume.files.remove"), remove, func(c *gin.Context) { DeleteVolumeFiles(c, hostClient(c), cfg) })
+
+		// networks
+		dr.GET("/networks", view, func(c *gin.Context) { ListNetworks(c, hostClient(c)) })
+		dr.GET("/networks/:id", view, func(c *gin.Context) { InspectNetwork(c, hostClient(c)) })
+		dr.POST("/networks", audited(cfg, "network.create"), networkChange, func(c *gin.Context) { CreateNetwork(c, hostClient(c)) })
+		dr.DELETE("/networks/:id", audited(cfg, "network.remove"), networkChange, func(c *gin.Context) { RemoveNetwork(c, hostClient(c)) })
+
+		// system
+		dr.POST("/system/prune", audited(cfg, "system.prune"), remove, func(c *gin.Context) { PruneSystem(c, hostClient(c), cfg) })
+
+		// daemon events
+		dr.GET("/events", view, func(c *gin.Context) { StreamEvents(c, hostClient(c)) })
+	}
 }
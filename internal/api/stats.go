@@ -0,0 +1,156 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/gin-gonic/gin"
+
+	"github.com/Nebula-work/docker-web/internal/docker"
+)
+
+// statsRefreshInterval controls how often the all-containers stream looks for started or stopped containers.
+const statsRefreshInterval = 5 * time.Second
+
+// StreamContainerStats streams computed resource usage for one container as Server-Sent Events.
+// With ?stream=false a single sample is returned as JSON instead.
+func StreamContainerStats(c *gin.Context, cli docker.DockerAPI) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+	stream := c.DefaultQuery("stream", "true") != "false"
+
+	resp, err := cli.ContainerStats(ctx, id, stream)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if cerrdefs.IsNotFound(err) {
+			status = http.StatusNotFound
+		}
+		writeAPIError(c, status, "Failed to get container stats", err.Error())
+		return
+	}
+	defer resp.Body.Close()
+	dec := json.NewDecoder(resp.Body)
+
+	if !stream {
+		var raw container.StatsResponse
+		if err := dec.Decode(&raw); err != nil {
+			writeAPIError(c, http.StatusInternalServerError, "Failed to decode container stats", err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, docker.ComputeStats(&raw))
+		return
+	}
+
+	c.Stream(func(w io.Writer) bool {
+		var raw container.StatsResponse
+		if err := dec.Decode(&raw); err != nil {
+			if err != io.EOF && ctx.Err() == nil {
+				c.SSEvent("error", gin.H{"message": err.Error()})
+			}
+			return false
+		}
+		c.SSEvent("stats", docker.ComputeStats(&raw))
+		return true
+	})
+}
+
+// StreamAllContainerStats streams computed resource usage for every running container as
+// Server-Sent Events. Containers that start later are picked up, and a "gone" event is sent
+// for containers that stop.
+func StreamAllContainerStats(c *gin.Context, cli docker.DockerAPI) {
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+
+	samples := make(chan docker.Stats, 16)
+	gone := make(chan string, 16)
+	var (
+		mu      sync.Mutex
+		running = map[string]struct{}{}
+		wg      sync.WaitGroup
+	)
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	// follow forwards samples until the daemon ends the stream, which happens when the container stops
+	follow := func(id string) {
+		defer wg.Done()
+		resp, err := cli.ContainerStats(ctx, id, true)
+		if err == nil {
+			dec := json.NewDecoder(resp.Body)
+			for {
+				var raw container.StatsResponse
+				if err := dec.Decode(&raw); err != nil {
+					break
+				}
+				select {
+				case samples <- docker.ComputeStats(&raw):
+				case <-ctx.Done():
+				}
+				if ctx.Err() != nil {
+					break
+				}
+			}
+			resp.Body.Close()
+		}
+		mu.Lock()
+		delete(running, id)
+		mu.Unlock()
+		select {
+		case gone <- id:
+		case <-ctx.Done():
+		}
+	}
+
+	refresh := func() error {
+		list, err := cli.ContainerList(ctx, container.ListOptions{
+			Filters: filters.NewArgs(filters.Arg("status", "running")),
+		})
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, ctr := range list {
+			if _, ok := running[ctr.ID]; ok {
+				continue
+			}
+			running[ctr.ID] = struct{}{}
+			wg.Add(1)
+			go follow(ctr.ID)
+		}
+		return nil
+	}
+
+	if err := refresh(); err != nil {
+		writeAPIError(c, http.StatusInternalServerError, "Failed to list containers", err.Error())
+		return
+	}
+
+	ticker := time.NewTicker(statsRefreshInterval)
+	defer ticker.Stop()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case s := <-samples:
+			c.SSEvent("stats", s)
+		case id := <-gone:
+			c.SSEvent("gone", gin.H{"id": id})
+		case <-ticker.C:
+			if err := refresh(); err != nil {
+				log.Printf("stats refresh: %v", err)
+			}
+		case <-ctx.Done():
+			return false
+		}
+		return true
+	})
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Nebula-work/docker-web/internal/auth"
+)
+
+type CreateUserRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	Role     string `json:"role" binding:"required"`
+	Selector string `json:"selector"`
+}
+
+type UpdateUserRequest struct {
+	Role     string `json:"role" binding:"required"`
+	Selector string `json:"selector"`
+	// Password resets the user's password when set.
+	Password string `json:"password"`
+}
+
+func ListUsers(c *gin.Context, cfg Config) {
+	users := cfg.Users.List()
+	out := make([]UserInfo, 0, len(users))
+	for _, u := range users {
+		out = append(out, newUserInfo(u))
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+func CreateUser(c *gin.Context, cfg Config) {
+	var req CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeAPIError(c, http.StatusBadRequest, "Invalid user", err.Error())
+		return
+	}
+	setAuditTarget(c, req.Username)
+	user, err := cfg.Users.Create(req.Username, req.Password, auth.Role(req.Role), req.Selector)
+	if errors.Is(err, auth.ErrUserExists) {
+		writeAPIError(c, http.StatusConflict, "User already exists", "")
+		return
+	}
+	if err != nil {
+		writeAPIError(c, http.StatusBadRequest, "Failed to create user", err.Error())
+		return
+	}
+	c.JSON(http.StatusCreated, newUserInfo(user))
+}
+
+func UpdateUser(c *gin.Context, cfg Config) {
+	var req UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeAPIError(c, http.StatusBadRequest, "Invalid user", err.Error())
+		return
+	}
+	user, err := cfg.Users.Update(c.Param("username"), auth.Role(req.Role), req.Selector, req.Password)
+	if !writeUserStoreError(c, err, "Failed to update user") {
+		return
+	}
+	if req.Password != "" {
+		cfg.Tokens.RevokeUser(user.Username)
+	}
+	c.JSON(http.StatusOK, newUserInfo(user))
+}
+
+func DeleteUser(c *gin.Context, cfg Config) {
+	if !writeUserStoreError(c, cfg.Users.Delete(c.Param("username")), "Failed to delete user") {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "deleted"})
+}
+
+// writeUserStoreError maps user store errors onto responses and reports whether err was nil.
+func writeUserStoreError(c *gin.Context, err error, message string) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, auth.ErrUserNotFound):
+		writeAPIError(c, http.StatusNotFound, "User not found", "")
+	case errors.Is(err, auth.ErrLastAdmin):
+		writeAPIError(c, http.StatusConflict, message, err.Error())
+	default:
+		writeAPIError(c, http.StatusBadRequest, message, err.Error())
+	}
+	return false
+}
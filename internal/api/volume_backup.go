@@ -0,0 +1,256 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/gin-gonic/gin"
+
+	"github.com/Nebula-work/docker-web/internal/backups"
+	"github.com/Nebula-work/docker-web/internal/docker"
+	"github.com/Nebula-work/docker-web/internal/jobs"
+)
+
+// maxVolumeArchiveSize bounds an uploaded volume archive.
+const maxVolumeArchiveSize = 64 << 30
+
+// BackupVolume archives a volume's contents as tar.gz. With ?download=true the archive is
+// streamed back as the response; otherwise a background job stores it in the backup
+// directory and its result names the stored backup.
+func BackupVolume(c *gin.Context, cli docker.DockerAPI, cfg Config) {
+	name := c.Param("name")
+	setAuditTarget(c, name)
+	if _, err := cli.VolumeInspect(c.Request.Context(), name); err != nil {
+		writeVolumeError(c, err, "Failed to back up volume")
+		return
+	}
+
+	if c.Query("download") == "true" {
+		ctx := c.Request.Context()
+		helper, err := newVolumeHelper(ctx, cli, cfg, name, true)
+		if err != nil {
+			writeAPIError(c, http.StatusInternalServerError, "Failed to back up volume", err.Error())
+			return
+		}
+		defer helper.remove()
+		c.Header("Content-Type", "application/gzip")
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s%s"`, name, time.Now().UTC().Format("20060102-150405"), backups.Ext))
+		c.Status(http.StatusOK)
+		if _, err := helper.writeArchive(ctx, c.Writer, true); err != nil && ctx.Err() == nil {
+			log.Printf("volume backup %s: %v", name, err)
+		}
+		return
+	}
+
+	if cfg.Backups == nil {
+		writeAPIError(c, http.StatusBadRequest, "No backup directory configured", "use ?download=true")
+		return
+	}
+	job := cfg.Jobs.Start("backup", name, jobOwner(c), backupJobTimeout, func(ctx context.Context, j *jobs.Job) error {
+		helper, err := newVolumeHelper(ctx, cli, cfg, name, true)
+		if err != nil {
+			return err
+		}
+		defer helper.remove()
+		w, err := cfg.Backups.Create(name)
+		if err != nil {
+			return err
+		}
+		stats, err := helper.writeArchive(ctx, w, true)
+		if err != nil {
+			w.Abort()
+			return err
+		}
+		b, err := w.Commit()
+		if err != nil {
+			return err
+		}
+		j.Publish(jobs.Event{Type: "log", Message: fmt.Sprintf("Archived %d files (%d bytes) into %s", stats.Files, stats.Bytes, b.Name)})
+		j.SetResult("backup", b.Name)
+		j.SetResult("size", b.Size)
+		j.SetResult("files", stats.Files)
+		return nil
+	})
+	acceptJob(c, job)
+}
+
+// RestoreRequest restores a stored backup. Volume is the volume the backup was taken
+// from and defaults to the one being restored.
+type RestoreRequest struct {
+	Backup  string `json:"backup" binding:"required"`
+	Volume  string `json:"volume"`
+	Replace bool   `json:"replace"`
+}
+
+type RestoreResult struct {
+	Volume   string `json:"volume"`
+	Created  bool   `json:"created"`
+	Replaced bool   `json:"replaced"`
+}
+
+// RestoreVolume extracts an archive into a volume, creating the volume if it does not
+// exist. The archive is either uploaded as multipart/form-data in an "archive" file part,
+// which is streamed to the daemon and restored before the response (add ?replace=true to
+// empty the volume first), or named in a RestoreRequest body, which restores a stored
+// backup in a background job. Files in the volume that are not in the archive are kept
+// unless the volume is emptied first.
+func RestoreVolume(c *gin.Context, cli docker.DockerAPI, cfg Config) {
+	name := c.Param("name")
+	setAuditTarget(c, name)
+	if !volumeName.MatchString(name) {
+		writeAPIError(c, http.StatusBadRequest, "Invalid restore request", fmt.Sprintf("invalid volume name %q", name))
+		return
+	}
+
+	if c.ContentType() == "multipart/form-data" {
+		// uploads may take longer than the server's default read timeout
+		_ = http.NewResponseController(c.Writer).SetReadDeadline(time.Time{})
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxVolumeArchiveSize)
+		mr, err := c.Request.MultipartReader()
+		if err != nil {
+			writeAPIError(c, http.StatusBadRequest, "Invalid restore request", err.Error())
+			return
+		}
+		part, err := mr.NextPart()
+		for err == nil && part.FormName() != "archive" {
+			part, err = mr.NextPart()
+		}
+		if err != nil {
+			writeAPIError(c, http.StatusBadRequest, "Invalid restore request", "missing archive file part")
+			return
+		}
+		replace, _ := strconv.ParseBool(c.Query("replace"))
+		result, err := restoreVolume(c.Request.Context(), cli, cfg, name, part, replace)
+		if err != nil {
+			writeRestoreError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, result)
+		return
+	}
+
+	var req RestoreRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeAPIError(c, http.StatusBadRequest, "Invalid restore request", err.Error())
+		return
+	}
+	if cfg.Backups == nil {
+		writeAPIError(c, http.StatusBadRequest, "No backup directory configured", "upload the archive instead")
+		return
+	}
+	if req.Volume == "" {
+		req.Volume = name
+	}
+	f, b, err := cfg.Backups.Open(req.Volume, req.Backup)
+	if err != nil {
+		writeBackupError(c, err)
+		return
+	}
+	job := cfg.Jobs.Start("restore", name, jobOwner(c), restoreJobTimeout, func(ctx context.Context, j *jobs.Job) error {
+		defer f.Close()
+		j.Publish(jobs.Event{Type: "log", Message: fmt.Sprintf("Restoring %s/%s (%d bytes)", b.Volume, b.Name, b.Size)})
+		result, err := restoreVolume(ctx, cli, cfg, name, f, req.Replace)
+		if err != nil {
+			return err
+		}
+		j.SetResult("volume", result.Volume)
+		j.SetResult("created", result.Created)
+		return nil
+	})
+	acceptJob(c, job)
+}
+
+// errBadArchive wraps archive errors reported by the daemon, which are the client's to fix.
+var errBadArchive = errors.New("invalid archive")
+
+func restoreVolume(ctx context.Context, cli docker.DockerAPI, cfg Config, name string, archive io.Reader, replace bool) (RestoreResult, error) {
+	result := RestoreResult{Volume: name, Replaced: replace}
+	if _, err := cli.VolumeInspect(ctx, name); cerrdefs.IsNotFound(err) {
+		if _, err := cli.VolumeCreate(ctx, volume.CreateOptions{Name: name, Driver: "local"}); err != nil {
+			return result, err
+		}
+		result.Created = true
+	} else if err != nil {
+		return result, err
+	}
+
+	var cmd []string
+	if replace {
+		cmd = emptyVolumeCmd
+	}
+	helper, err := newVolumeHelper(ctx, cli, cfg, name, false, cmd...)
+	if err != nil {
+		return result, err
+	}
+	defer helper.remove()
+	if replace && !result.Created {
+		if _, err := helper.run(ctx); err != nil {
+			return result, fmt.Errorf("empty volume: %w", err)
+		}
+	}
+	if err := helper.readArchive(ctx, archive); err != nil {
+		if cerrdefs.IsInvalidArgument(err) {
+			return result, fmt.Errorf("%w: %v", errBadArchive, err)
+		}
+		return result, err
+	}
+	return result, nil
+}
+
+func writeRestoreError(c *gin.Context, err error) {
+	if errors.Is(err, errBadArchive) {
+		writeAPIError(c, http.StatusBadRequest, "Failed to restore volume", err.Error())
+		return
+	}
+	writeAPIError(c, http.StatusInternalServerError, "Failed to restore volume", err.Error())
+}
+
+// ListVolumeBackups lists stored backups, newest first, optionally for one ?volume=.
+func ListVolumeBackups(c *gin.Context, cfg Config) {
+	list, err := cfg.Backups.List(c.Query("volume"))
+	if err != nil {
+		writeBackupError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func DownloadVolumeBackup(c *gin.Context, cfg Config) {
+	f, b, err := cfg.Backups.Open(c.Param("volume"), c.Param("backup"))
+	if err != nil {
+		writeBackupError(c, err)
+		return
+	}
+	defer f.Close()
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, b.Name))
+	http.ServeContent(c.Writer, c.Request, b.Name, b.CreatedAt, f)
+}
+
+func DeleteVolumeBackup(c *gin.Context, cfg Config) {
+	setAuditTarget(c, c.Param("volume")+"/"+c.Param("backup"))
+	if err := cfg.Backups.Remove(c.Param("volume"), c.Param("backup")); err != nil {
+		writeBackupError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "removed"})
+}
+
+func writeBackupError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, backups.ErrNotFound), errors.Is(err, os.ErrNotExist):
+		writeAPIError(c, http.StatusNotFound, "Backup not found", err.Error())
+	case errors.Is(err, backups.ErrInvalidName):
+		writeAPIError(c, http.StatusBadRequest, "Invalid backup name", err.Error())
+	default:
+		writeAPIError(c, http.StatusInternalServerError, "Failed to read backups", err.Error())
+	}
+}
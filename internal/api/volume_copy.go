@@ -0,0 +1,174 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/gin-gonic/gin"
+
+	"github.com/Nebula-work/docker-web/internal/auth"
+	"github.com/Nebula-work/docker-web/internal/docker"
+	"github.com/Nebula-work/docker-web/internal/jobs"
+)
+
+// CopyVolumeRequest copies a volume. Host is the configured Docker host to copy to and
+// defaults to the source volume's host. Name is the new volume's name and defaults to the
+// source's, so a copy on the same host needs one. Labels default to the source's labels.
+type CopyVolumeRequest struct {
+	Name    string            `json:"name"`
+	Host    string            `json:"host"`
+	Labels  map[string]string `json:"labels"`
+	Replace bool              `json:"replace"`
+}
+
+// CopyVolume copies a volume's contents into a new "local" volume, on the same host or on
+// another configured one, in a background "copy" job. The archive is streamed from the
+// source daemon to the target daemon through this server without being stored. Copying
+// into an existing volume is a conflict unless Replace is set, which empties it first and
+// needs the remove permission.
+func CopyVolume(c *gin.Context, cli docker.DockerAPI, cfg Config) {
+	name := c.Param("name")
+	setAuditTarget(c, name)
+	var req CopyVolumeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeAPIError(c, http.StatusBadRequest, "Invalid copy request", err.Error())
+		return
+	}
+	srcHost := c.Param("host")
+	if srcHost == "" {
+		srcHost = cfg.Hosts.Default()
+	}
+	if req.Host == "" {
+		req.Host = srcHost
+	}
+	if req.Name == "" {
+		req.Name = name
+	}
+	if !volumeName.MatchString(req.Name) {
+		writeAPIError(c, http.StatusBadRequest, "Invalid copy request", fmt.Sprintf("invalid volume name %q", req.Name))
+		return
+	}
+	if req.Host == srcHost && req.Name == name {
+		writeAPIError(c, http.StatusBadRequest, "Invalid copy request", "a copy on the same host needs a new name")
+		return
+	}
+	if req.Replace && !permit(c, cfg, auth.ActionRemove) {
+		return
+	}
+	setAuditTarget(c, fmt.Sprintf("%s -> %s/%s", name, req.Host, req.Name))
+
+	dst := cli
+	if req.Host != srcHost {
+		var err error
+		dst, err = cfg.Hosts.Client(req.Host)
+		if errors.Is(err, docker.ErrHostNotFound) {
+			writeAPIError(c, http.StatusNotFound, "Host not found", req.Host)
+			return
+		}
+		if err != nil {
+			writeAPIError(c, http.StatusBadGateway, "Host unavailable", err.Error())
+			return
+		}
+	}
+	ctx := c.Request.Context()
+	src, err := cli.VolumeInspect(ctx, name)
+	if err != nil {
+		writeVolumeError(c, err, "Failed to copy volume")
+		return
+	}
+	exists := true
+	if _, err := dst.VolumeInspect(ctx, req.Name); cerrdefs.IsNotFound(err) {
+		exists = false
+	} else if err != nil {
+		writeAPIError(c, http.StatusInternalServerError, "Failed to copy volume", err.Error())
+		return
+	} else if !req.Replace {
+		writeAPIError(c, http.StatusConflict, "Volume already exists", req.Host+"/"+req.Name)
+		return
+	}
+	if req.Labels == nil {
+		req.Labels = src.Labels
+	}
+
+	job := cfg.Jobs.Start("copy", name, jobOwner(c), copyJobTimeout, func(ctx context.Context, j *jobs.Job) error {
+		if !exists {
+			if _, err := dst.VolumeCreate(ctx, volume.CreateOptions{Name: req.Name, Driver: "local", Labels: req.Labels}); err != nil {
+				return fmt.Errorf("create %s: %w", req.Name, err)
+			}
+		}
+		// compressing only pays off when the archive crosses to another daemon
+		stats, err := copyVolume(ctx, cli, dst, cfg, name, req.Name, exists && req.Replace, req.Host != srcHost)
+		if err != nil {
+			if !exists {
+				// leave nothing behind, so the copy can simply be retried
+				rmCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+				defer cancel()
+				_ = dst.VolumeRemove(rmCtx, req.Name, true)
+			}
+			return err
+		}
+		j.Publish(jobs.Event{Type: "log", Message: fmt.Sprintf("Copied %d files (%d bytes) to %s/%s", stats.Files, stats.Bytes, req.Host, req.Name)})
+		j.SetResult("host", req.Host)
+		j.SetResult("volume", req.Name)
+		j.SetResult("files", stats.Files)
+		j.SetResult("bytes", stats.Bytes)
+		return nil
+	})
+	acceptJob(c, job)
+}
+
+// copyVolume streams the contents of volume from on src into volume to on dst, which must
+// exist, emptying it first if empty is set.
+func copyVolume(ctx context.Context, src, dst docker.DockerAPI, cfg Config, from, to string, empty, compress bool) (archiveStats, error) {
+	reader, err := newVolumeHelper(ctx, src, cfg, from, true)
+	if err != nil {
+		return archiveStats{}, err
+	}
+	defer reader.remove()
+	var cmd []string
+	if empty {
+		cmd = emptyVolumeCmd
+	}
+	writer, err := newVolumeHelper(ctx, dst, cfg, to, false, cmd...)
+	if err != nil {
+		return archiveStats{}, err
+	}
+	defer writer.remove()
+	if empty {
+		if _, err := writer.run(ctx); err != nil {
+			return archiveStats{}, fmt.Errorf("empty volume: %w", err)
+		}
+	}
+
+	type archived struct {
+		stats archiveStats
+		err   error
+	}
+	done := make(chan archived, 1)
+	pr, pw := io.Pipe()
+	go func() {
+		stats, err := reader.writeArchive(ctx, pw, compress)
+		pw.CloseWithError(err)
+		done <- archived{stats, err}
+	}()
+	err = writer.readArchive(ctx, pr)
+	// unblock the reader if the target daemon gave up early; its pipe writes then fail with
+	// the target's error, or io.ErrClosedPipe when the target stopped reading without one
+	pr.CloseWithError(err)
+	res := <-done
+	writeFailed := errors.Is(res.err, io.ErrClosedPipe) || (err != nil && errors.Is(res.err, err))
+	// a failed read surfaces on the target too, but its own error says more
+	if res.err != nil && !writeFailed {
+		return res.stats, fmt.Errorf("read %s: %w", from, res.err)
+	}
+	if err != nil {
+		return res.stats, fmt.Errorf("write %s: %w", to, err)
+	}
+	return res.stats, nil
+}
@@ -0,0 +1,469 @@
+package api
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types/container"
+	"github.com/gin-gonic/gin"
+
+	"github.com/Nebula-work/docker-web/internal/docker"
+	"github.com/Nebula-work/docker-web/internal/imagefs"
+)
+
+// maxVolumeListing bounds the entries returned for one directory.
+const maxVolumeListing = 5000
+
+// Exit statuses of the helper scripts below.
+const (
+	exitNotFound  = 3
+	exitNotDir    = 4
+	exitTruncated = 5
+)
+
+// listDirScript prints every entry of directory $1, dot files included, as three
+// NUL-terminated fields: "<hex mode> <size> <mtime> <uid> <gid>", the name and the symlink
+// target. It stops after $2 entries. Only stat -c options shared by busybox and GNU
+// coreutils are used, so any helper image works.
+const listDirScript = `[ -e "$1" ] || [ -L "$1" ] || exit 3
+[ -d "$1" ] && [ ! -L "$1" ] || exit 4
+cd "$1" || exit 1
+n=0
+for f in .[!.]* ..?* *; do
+	[ -e "$f" ] || [ -L "$f" ] || continue
+	[ "$n" -lt "$2" ] || exit 5
+	n=$((n+1))
+	l=
+	[ -L "$f" ] && l=$(readlink -- "$f")
+	printf '%s\0%s\0%s\0' "$(stat -c '%f %s %Y %u %g' -- "$f")" "$f" "$l"
+done`
+
+// removePathScript deletes $1, failing if there is nothing to delete.
+const removePathScript = `[ -e "$1" ] || [ -L "$1" ] || exit 3
+rm -rf -- "$1"`
+
+// VolumeFile is one entry of a volume directory listing.
+type VolumeFile struct {
+	Name       string       `json:"name"`
+	Path       string       `json:"path"`
+	Type       imagefs.Kind `json:"type"`
+	Size       int64        `json:"size"`
+	Mode       uint32       `json:"mode"`
+	UID        int          `json:"uid"`
+	GID        int          `json:"gid"`
+	ModifiedAt time.Time    `json:"modifiedAt"`
+	LinkTarget string       `json:"linkTarget,omitempty"`
+}
+
+// VolumeFiles lists one directory of a volume, directories first. Truncated is set when
+// the directory has more than maxVolumeListing entries and only some are listed.
+type VolumeFiles struct {
+	Volume    string       `json:"volume"`
+	Path      string       `json:"path"`
+	Entries   []VolumeFile `json:"entries"`
+	Truncated bool         `json:"truncated"`
+}
+
+// volumePath cleans a ?path= query value into an absolute path inside the volume, "/"
+// being the volume root.
+func volumePath(p string) string {
+	return path.Clean("/" + p)
+}
+
+// helperPath is where p, as returned by volumePath, is found inside a helper.
+func helperPath(p string) string {
+	return path.Join(helperMount, p)
+}
+
+// inspectedVolume checks the volume named in the route exists before a helper mounts it,
+// as mounting an unknown volume would quietly create it. It writes the error response
+// itself and reports whether the handler can go on.
+func inspectedVolume(c *gin.Context, cli docker.DockerAPI, message string) (string, bool) {
+	name := c.Param("name")
+	if _, err := cli.VolumeInspect(c.Request.Context(), name); err != nil {
+		writeVolumeError(c, err, message)
+		return name, false
+	}
+	return name, true
+}
+
+// ListVolumeFiles lists the directory ?path= (default "/") of a volume. The volume does
+// not need to be mounted by any container: a short-lived helper container lists it.
+func ListVolumeFiles(c *gin.Context, cli docker.DockerAPI, cfg Config) {
+	name, ok := inspectedVolume(c, cli, "Failed to list volume files")
+	if !ok {
+		return
+	}
+	dir := volumePath(c.Query("path"))
+	ctx := c.Request.Context()
+	helper, err := newVolumeHelper(ctx, cli, cfg, name, true,
+		"sh", "-c", listDirScript, "sh", helperPath(dir), strconv.Itoa(maxVolumeListing))
+	if err != nil {
+		writeAPIError(c, http.StatusInternalServerError, "Failed to list volume files", err.Error())
+		return
+	}
+	defer helper.remove()
+
+	out, err := helper.run(ctx)
+	truncated := false
+	var exit *helperExitError
+	if errors.As(err, &exit) {
+		switch exit.Status {
+		case exitNotFound:
+			writeAPIError(c, http.StatusNotFound, "Path not found", dir)
+			return
+		case exitNotDir:
+			writeAPIError(c, http.StatusBadRequest, "Not a directory", dir)
+			return
+		case exitTruncated:
+			truncated, err = true, nil
+		}
+	}
+	if err != nil {
+		writeAPIError(c, http.StatusInternalServerError, "Failed to list volume files", err.Error())
+		return
+	}
+	entries, err := parseListing(out, dir)
+	if err != nil {
+		writeAPIError(c, http.StatusInternalServerError, "Failed to list volume files", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, VolumeFiles{Volume: name, Path: dir, Entries: entries, Truncated: truncated})
+}
+
+// parseListing reads the output of listDirScript for directory dir.
+func parseListing(out []byte, dir string) ([]VolumeFile, error) {
+	if len(out) > 0 && out[len(out)-1] != 0 {
+		return nil, fmt.Errorf("unexpected helper output")
+	}
+	fields := bytes.Split(out, []byte{0})
+	// the output ends with a NUL, leaving an empty last field
+	fields = fields[:len(fields)-1]
+	if len(fields)%3 != 0 {
+		return nil, fmt.Errorf("unexpected helper output")
+	}
+	entries := make([]VolumeFile, 0, len(fields)/3)
+	for i := 0; i < len(fields); i += 3 {
+		var rawMode, mtime int64
+		f := VolumeFile{Name: string(fields[i+1]), LinkTarget: string(fields[i+2])}
+		if _, err := fmt.Sscanf(string(fields[i]), "%x %d %d %d %d", &rawMode, &f.Size, &mtime, &f.UID, &f.GID); err != nil {
+			return nil, fmt.Errorf("unexpected stat output %q", fields[i])
+		}
+		f.Path = path.Join(dir, f.Name)
+		f.Mode = uint32(rawMode) & 07777
+		f.ModifiedAt = time.Unix(mtime, 0).UTC()
+		switch rawMode & 0170000 {
+		case 0040000:
+			f.Type = imagefs.KindDir
+		case 0100000:
+			f.Type = imagefs.KindFile
+		case 0120000:
+			f.Type = imagefs.KindSymlink
+		default:
+			f.Type = imagefs.KindOther
+		}
+		if f.Type == imagefs.KindDir {
+			// a directory's own size says nothing about its contents
+			f.Size = 0
+		}
+		entries = append(entries, f)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if di, dj := entries[i].Type == imagefs.KindDir, entries[j].Type == imagefs.KindDir; di != dj {
+			return di
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	return entries, nil
+}
+
+// DownloadVolumeFiles downloads ?path= from a volume: a regular file as itself, anything
+// else, directories included, as a tar archive named after it.
+func DownloadVolumeFiles(c *gin.Context, cli docker.DockerAPI, cfg Config) {
+	name, ok := inspectedVolume(c, cli, "Failed to download volume files")
+	if !ok {
+		return
+	}
+	p := volumePath(c.Query("path"))
+	ctx := c.Request.Context()
+	helper, err := newVolumeHelper(ctx, cli, cfg, name, true)
+	if err != nil {
+		writeAPIError(c, http.StatusInternalServerError, "Failed to download volume files", err.Error())
+		return
+	}
+	defer helper.remove()
+
+	rc, stat, err := cli.CopyFromContainer(ctx, helper.id, helperPath(p))
+	if err != nil {
+		if cerrdefs.IsNotFound(err) {
+			writeAPIError(c, http.StatusNotFound, "Path not found", p)
+			return
+		}
+		writeVolumeError(c, err, "Failed to download volume files")
+		return
+	}
+	defer rc.Close()
+	tr := tar.NewReader(rc)
+
+	if stat.Mode.IsRegular() {
+		hdr, err := tr.Next()
+		if err != nil {
+			writeAPIError(c, http.StatusInternalServerError, "Failed to download volume files", err.Error())
+			return
+		}
+		c.Header("Content-Type", "application/octet-stream")
+		c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": stat.Name}))
+		c.Header("Content-Length", strconv.FormatInt(hdr.Size, 10))
+		c.Status(http.StatusOK)
+		if _, err := io.Copy(c.Writer, tr); err != nil && ctx.Err() == nil {
+			log.Printf("volume download %s:%s: %v", name, p, err)
+		}
+		return
+	}
+
+	// the daemon names entries after the copied path; the volume root is named after the volume
+	base := stat.Name
+	if p == "/" {
+		base = name
+	}
+	c.Header("Content-Type", "application/x-tar")
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": base + ".tar"}))
+	c.Status(http.StatusOK)
+	if err := renameArchive(c.Writer, tr, stat.Name, base); err != nil && ctx.Err() == nil {
+		log.Printf("volume download %s:%s: %v", name, p, err)
+	}
+}
+
+// renameArchive copies a tar archive, moving entries under from to to.
+func renameArchive(w io.Writer, tr *tar.Reader, from, to string) error {
+	tw := tar.NewWriter(w)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return tw.Close()
+		}
+		if err != nil {
+			return err
+		}
+		if from != to {
+			hdr.Name = renameEntry(hdr.Name, from, to)
+			if hdr.Typeflag == tar.TypeLink {
+				hdr.Linkname = renameEntry(hdr.Linkname, from, to)
+			}
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+	}
+}
+
+func renameEntry(name, from, to string) string {
+	if rest, ok := strings.CutPrefix(name, from); ok && (rest == "" || rest[0] == '/') {
+		return to + rest
+	}
+	return name
+}
+
+// VolumeUpload lists the files written by an upload.
+type VolumeUpload struct {
+	Volume string   `json:"volume"`
+	Path   string   `json:"path"`
+	Files  []string `json:"files"`
+	Bytes  int64    `json:"bytes"`
+}
+
+// UploadVolumeFiles writes the "file" parts of a multipart/form-data upload into the
+// existing directory ?path= of a volume, replacing files of the same name. Files are
+// owned by ?uid= and ?gid= (default root) with mode 0644.
+func UploadVolumeFiles(c *gin.Context, cli docker.DockerAPI, cfg Config) {
+	name, ok := inspectedVolume(c, cli, "Failed to upload volume files")
+	if !ok {
+		return
+	}
+	dir := volumePath(c.Query("path"))
+	setAuditTarget(c, name+":"+dir)
+	uid, err := queryID(c, "uid")
+	if err != nil {
+		writeAPIError(c, http.StatusBadRequest, "Invalid upload request", err.Error())
+		return
+	}
+	gid, err := queryID(c, "gid")
+	if err != nil {
+		writeAPIError(c, http.StatusBadRequest, "Invalid upload request", err.Error())
+		return
+	}
+
+	// uploads may take longer than the server's default read timeout
+	_ = http.NewResponseController(c.Writer).SetReadDeadline(time.Time{})
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxVolumeArchiveSize)
+	mr, err := c.Request.MultipartReader()
+	if err != nil {
+		writeAPIError(c, http.StatusBadRequest, "Invalid upload request", err.Error())
+		return
+	}
+	// tar headers need each file's size up front, which multipart parts do not give, so
+	// the files are spooled to disk before being sent to the daemon
+	spool, err := os.MkdirTemp("", "volume-upload-*")
+	if err != nil {
+		writeAPIError(c, http.StatusInternalServerError, "Failed to upload volume files", err.Error())
+		return
+	}
+	defer os.RemoveAll(spool)
+
+	result := VolumeUpload{Volume: name, Path: dir, Files: []string{}}
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			writeAPIError(c, http.StatusBadRequest, "Invalid upload request", err.Error())
+			return
+		}
+		if part.FormName() != "file" {
+			continue
+		}
+		fileName := part.FileName()
+		if fileName == "" || fileName == "." || fileName == ".." || strings.ContainsAny(fileName, "/\x00") {
+			writeAPIError(c, http.StatusBadRequest, "Invalid upload request", fmt.Sprintf("invalid file name %q", fileName))
+			return
+		}
+		n, err := spoolFile(filepath.Join(spool, strconv.Itoa(len(result.Files))), part)
+		if err != nil {
+			writeAPIError(c, http.StatusBadRequest, "Invalid upload request", err.Error())
+			return
+		}
+		result.Files = append(result.Files, fileName)
+		result.Bytes += n
+	}
+	if len(result.Files) == 0 {
+		writeAPIError(c, http.StatusBadRequest, "Invalid upload request", "missing file part")
+		return
+	}
+
+	ctx := c.Request.Context()
+	helper, err := newVolumeHelper(ctx, cli, cfg, name, false)
+	if err != nil {
+		writeAPIError(c, http.StatusInternalServerError, "Failed to upload volume files", err.Error())
+		return
+	}
+	defer helper.remove()
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeSpooledArchive(pw, spool, result.Files, uid, gid))
+	}()
+	err = cli.CopyToContainer(ctx, helper.id, helperPath(dir), pr, container.CopyToContainerOptions{})
+	pr.Close()
+	if err != nil {
+		if cerrdefs.IsNotFound(err) {
+			writeAPIError(c, http.StatusNotFound, "Directory not found", dir)
+			return
+		}
+		writeVolumeError(c, err, "Failed to upload volume files")
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func queryID(c *gin.Context, key string) (int, error) {
+	v := c.Query(key)
+	if v == "" {
+		return 0, nil
+	}
+	id, err := strconv.Atoi(v)
+	if err != nil || id < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer", key)
+	}
+	return id, nil
+}
+
+func spoolFile(name string, r io.Reader) (int64, error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
+
+// writeSpooledArchive writes the spooled files, numbered in upload order, as a tar archive
+// under their uploaded names.
+func writeSpooledArchive(w io.Writer, spool string, names []string, uid, gid int) error {
+	tw := tar.NewWriter(w)
+	now := time.Now()
+	for i, fileName := range names {
+		f, err := os.Open(filepath.Join(spool, strconv.Itoa(i)))
+		if err != nil {
+			return err
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return err
+		}
+		hdr := &tar.Header{Typeflag: tar.TypeReg, Name: fileName, Size: info.Size(), Mode: 0644, Uid: uid, Gid: gid, ModTime: now}
+		if err := tw.WriteHeader(hdr); err != nil {
+			f.Close()
+			return err
+		}
+		_, err = io.Copy(tw, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// DeleteVolumeFiles deletes ?path= from a volume, recursively for directories. The volume
+// root itself cannot be deleted this way.
+func DeleteVolumeFiles(c *gin.Context, cli docker.DockerAPI, cfg Config) {
+	name, ok := inspectedVolume(c, cli, "Failed to delete volume files")
+	if !ok {
+		return
+	}
+	p := volumePath(c.Query("path"))
+	setAuditTarget(c, name+":"+p)
+	if p == "/" {
+		writeAPIError(c, http.StatusBadRequest, "Cannot delete the volume root", "remove the volume instead")
+		return
+	}
+	ctx := c.Request.Context()
+	helper, err := newVolumeHelper(ctx, cli, cfg, name, false, "sh", "-c", removePathScript, "sh", helperPath(p))
+	if err != nil {
+		writeAPIError(c, http.StatusInternalServerError, "Failed to delete volume files", err.Error())
+		return
+	}
+	defer helper.remove()
+	if _, err := helper.run(ctx); err != nil {
+		var exit *helperExitError
+		if errors.As(err, &exit) && exit.Status == exitNotFound {
+			writeAPIError(c, http.StatusNotFound, "Path not found", p)
+			return
+		}
+		writeAPIError(c, http.StatusInternalServerError, "Failed to delete volume files", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "removed"})
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Nebula-work/docker-web/internal/imagefs"
+)
+
+// listing joins stat, name, link target triples the way listDirScript prints them.
+func listing(fields ...string) []byte {
+	var b strings.Builder
+	for _, f := range fields {
+		b.WriteString(f)
+		b.WriteByte(0)
+	}
+	return []byte(b.String())
+}
+
+func TestParseListing(t *testing.T) {
+	mtime := time.Unix(1700000000, 0).UTC()
+	tests := []struct {
+		name string
+		out  []byte
+		dir  string
+		want []VolumeFile
+	}{
+		{"empty directory", nil, "/", []VolumeFile{}},
+		{"file", listing("81a4 12 1700000000 1000 1000", "notes.txt", ""), "/data", []VolumeFile{
+			{Name: "notes.txt", Path: "/data/notes.txt", Type: imagefs.KindFile, Size: 12, Mode: 0644, UID: 1000, GID: 1000, ModifiedAt: mtime},
+		}},
+		{"directory size is dropped", listing("41ed 4096 1700000000 0 0", "cache", ""), "/", []VolumeFile{
+			{Name: "cache", Path: "/cache", Type: imagefs.KindDir, Mode: 0755, ModifiedAt: mtime},
+		}},
+		{"symlink", listing("a1ff 11 1700000000 0 0", "current", "releases/v2"), "/app", []VolumeFile{
+			{Name: "current", Path: "/app/current", Type: imagefs.KindSymlink, Size: 11, Mode: 0777, ModifiedAt: mtime, LinkTarget: "releases/v2"},
+		}},
+		{"setuid and special files", listing(
+			"89ed 8 1700000000 0 0", "tool", "",
+			"11a4 0 1700000000 0 0", "fifo", "",
+			"c1ed 0 1700000000 0 0", "sock", "",
+		), "/", []VolumeFile{
+			{Name: "fifo", Path: "/fifo", Type: imagefs.KindOther, Mode: 0644, ModifiedAt: mtime},
+			{Name: "sock", Path: "/sock", Type: imagefs.KindOther, Mode: 0755, ModifiedAt: mtime},
+			{Name: "tool", Path: "/tool", Type: imagefs.KindFile, Size: 8, Mode: 04755, ModifiedAt: mtime},
+		}},
+		{"names with spaces and newlines", listing("81a4 1 1700000000 0 0", "a b\nc", ""), "/", []VolumeFile{
+			{Name: "a b\nc", Path: "/a b\nc", Type: imagefs.KindFile, Size: 1, Mode: 0644, ModifiedAt: mtime},
+		}},
+		{"directories first, then by name", listing(
+			"81a4 1 1700000000 0 0", "b", "",
+			"41ed 4096 1700000000 0 0", "z", "",
+			"81a4 1 1700000000 0 0", ".env", "",
+			"41ed 4096 1700000000 0 0", "a", "",
+		), "/", []VolumeFile{
+			{Name: "a", Path: "/a", Type: imagefs.KindDir, Mode: 0755, ModifiedAt: mtime},
+			{Name: "z", Path: "/z", Type: imagefs.KindDir, Mode: 0755, ModifiedAt: mtime},
+			{Name: ".env", Path: "/.env", Type: imagefs.KindFile, Size: 1, Mode: 0644, ModifiedAt: mtime},
+			{Name: "b", Path: "/b", Type: imagefs.KindFile, Size: 1, Mode: 0644, ModifiedAt: mtime},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseListing(tt.out, tt.dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseListing =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseListingErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		out  []byte
+	}{
+		{"missing fields", listing("81a4 12 1700000000 0 0", "notes.txt")},
+		{"no trailing NUL", []byte("81a4 12 1700000000 0 0\x00notes.txt\x00\x00partial")},
+		{"bad mode", listing("zz 12 1700000000 0 0", "notes.txt", "")},
+		{"short stat", listing("81a4 12", "notes.txt", "")},
+		{"shell error", []byte("stat: can't stat 'x': No such file or directory\n")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := parseListing(tt.out, "/"); err == nil {
+				t.Errorf("parseListing(%q) = %+v, want an error", tt.out, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package api
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/pkg/stdcopy"
+
+	"github.com/Nebula-work/docker-web/internal/docker"
+)
+
+const (
+	// helperMount is where helper containers mount the volume they work on.
+	helperMount = "/volume"
+	// helperLabel marks helper containers so they can be told apart from user containers.
+	helperLabel = "docker-web.helper"
+)
+
+// volumeHelper is a container that mounts one volume. Copying files in and out of it needs
+// nothing running inside, as the daemon's archive endpoints work on stopped containers;
+// it is only started to run a command such as a directory listing.
+type volumeHelper struct {
+	cli docker.DockerAPI
+	id  string
+}
+
+// newVolumeHelper creates a helper for volume, pulling the helper image if needed. cmd is
+// only run by run. The caller must call remove.
+func newVolumeHelper(ctx context.Context, cli docker.DockerAPI, cfg Config, volume string, readOnly bool, cmd ...string) (*volumeHelper, error) {
+	auth, err := registryAuth(cfg, cfg.HelperImage)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ensureImage(ctx, cli, cfg.HelperImage, auth); err != nil {
+		return nil, fmt.Errorf("helper image %s: %w", cfg.HelperImage, err)
+	}
+	resp, err := cli.ContainerCreate(ctx,
+		&container.Config{
+			Image:           cfg.HelperImage,
+			Cmd:             cmd,
+			Labels:          map[string]string{helperLabel: "volume"},
+			NetworkDisabled: true,
+		},
+		&container.HostConfig{
+			Mounts: []mount.Mount{{Type: mount.TypeVolume, Source: volume, Target: helperMount, ReadOnly: readOnly}},
+			// run reads the command's output back from the log, whatever the daemon's default driver
+			LogConfig: container.LogConfig{Type: "json-file"},
+		}, nil, nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("create helper container: %w", err)
+	}
+	return &volumeHelper{cli: cli, id: resp.ID}, nil
+}
+
+// remove deletes the helper. It does not use the request's context, which may be gone.
+func (h *volumeHelper) remove() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	_ = h.cli.ContainerRemove(ctx, h.id, container.RemoveOptions{Force: true})
+}
+
+// maxHelperOutput bounds how much of a helper command's stdout run keeps.
+const maxHelperOutput = 16 << 20
+
+// helperExitError is returned by run when the command exits with a non-zero status.
+type helperExitError struct {
+	Status int64
+	Stderr string
+}
+
+func (e *helperExitError) Error() string {
+	if e.Stderr != "" {
+		return fmt.Sprintf("helper exited with status %d: %s", e.Status, e.Stderr)
+	}
+	return fmt.Sprintf("helper exited with status %d", e.Status)
+}
+
+// run starts the helper's command, waits for it to exit and returns its stdout. A non-zero
+// exit status is returned as a *helperExitError along with whatever stdout was written.
+func (h *volumeHelper) run(ctx context.Context) ([]byte, error) {
+	waitC, errC := h.cli.ContainerWait(ctx, h.id, container.WaitConditionNextExit)
+	if err := h.cli.ContainerStart(ctx, h.id, container.StartOptions{}); err != nil {
+		return nil, err
+	}
+	var status int64
+	select {
+	case res := <-waitC:
+		if res.Error != nil {
+			return nil, errors.New(res.Error.Message)
+		}
+		status = res.StatusCode
+	case err := <-errC:
+		return nil, err
+	}
+
+	rc, err := h.cli.ContainerLogs(ctx, h.id, container.LogsOptions{ShowStdout: true, ShowStderr: true})
+	if err != nil {
+		return nil, fmt.Errorf("read helper output: %w", err)
+	}
+	defer rc.Close()
+	stdout := &limitedBuffer{max: maxHelperOutput}
+	stderr := &limitedBuffer{max: 4 << 10}
+	if _, err := stdcopy.StdCopy(stdout, stderr, rc); err != nil {
+		return nil, fmt.Errorf("read helper output: %w", err)
+	}
+	if status != 0 {
+		return stdout.Bytes(), &helperExitError{Status: status, Stderr: strings.TrimSpace(stderr.String())}
+	}
+	return stdout.Bytes(), nil
+}
+
+// limitedBuffer keeps the first max bytes written to it and silently drops the rest.
+type limitedBuffer struct {
+	bytes.Buffer
+	max int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.Len(); room < len(p) {
+		if room > 0 {
+			b.Buffer.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+// archiveStats counts what went into an archive.
+type archiveStats struct {
+	Files int   `json:"files"`
+	Bytes int64 `json:"bytes"`
+}
+
+// writeArchive writes the helper's volume to w as a tar, gzip-compressed if compress is
+// set, whose entries are relative to the volume root ("./", "./data/file"), with ownership
+// and modes kept.
+func (h *volumeHelper) writeArchive(ctx context.Context, w io.Writer, compress bool) (archiveStats, error) {
+	var stats archiveStats
+	rc, _, err := h.cli.CopyFromContainer(ctx, h.id, helperMount)
+	if err != nil {
+		return stats, err
+	}
+	defer rc.Close()
+
+	var zw *gzip.Writer
+	if compress {
+		zw = gzip.NewWriter(w)
+		w = zw
+	}
+	tw := tar.NewWriter(w)
+	tr := tar.NewReader(rc)
+	// the daemon names entries after the copied directory: "volume", "volume/data/file"
+	prefix := strings.TrimPrefix(helperMount, "/")
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return stats, err
+		}
+		hdr.Name = volumeEntryName(hdr.Name, prefix)
+		if hdr.Typeflag == tar.TypeLink {
+			hdr.Linkname = volumeEntryName(hdr.Linkname, prefix)
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return stats, err
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			n, err := io.Copy(tw, tr)
+			if err != nil {
+				return stats, err
+			}
+			stats.Files++
+			stats.Bytes += n
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return stats, err
+	}
+	if zw != nil {
+		return stats, zw.Close()
+	}
+	return stats, nil
+}
+
+func volumeEntryName(name, prefix string) string {
+	rest := strings.TrimPrefix(name, "./")
+	if rest == prefix {
+		rest = ""
+	} else if r, ok := strings.CutPrefix(rest, prefix+"/"); ok {
+		rest = r
+	}
+	if rest == "" {
+		return "./"
+	}
+	return "./" + rest
+}
+
+// readArchive extracts a tar archive, plain or compressed, into the helper's volume.
+// Entries are taken as relative to the volume root; the daemon refuses any that would
+// land outside it.
+func (h *volumeHelper) readArchive(ctx context.Context, r io.Reader) error {
+	return h.cli.CopyToContainer(ctx, h.id, helperMount, r, container.CopyToContainerOptions{})
+}
+
+// emptyVolumeCmd deletes everything in the helper's volume, dot files included.
+var emptyVolumeCmd = []string{"sh", "-c", "rm -rf " + helperMount + "/..?* " + helperMount + "/.[!.]* " + helperMount + "/*"}
@@ -0,0 +1,27 @@
+package api
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVolumeEntryName(t *testing.T) {
+	prefix := strings.TrimPrefix(helperMount, "/")
+	tests := []struct{ name, want string }{
+		{prefix, "./"},
+		{prefix + "/", "./"},
+		{"./" + prefix + "/", "./"},
+		{prefix + "/data", "./data"},
+		{prefix + "/data/", "./data/"},
+		{prefix + "/data/file.txt", "./data/file.txt"},
+		{"./" + prefix + "/.hidden", "./.hidden"},
+		{prefix + "/" + prefix + "/nested", "./" + prefix + "/nested"},
+		{prefix + "data/file", "./" + prefix + "data/file"},
+		{"other/file", "./other/file"},
+	}
+	for _, tt := range tests {
+		if got := volumeEntryName(tt.name, prefix); got != tt.want {
+			t.Errorf("volumeEntryName(%q, %q) = %q, want %q", tt.name, prefix, got, tt.want)
+		}
+	}
+}
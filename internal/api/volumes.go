@@ -0,0 +1,365 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/gin-gonic/gin"
+
+	"github.com/Nebula-work/docker-web/internal/docker"
+)
+
+var (
+	// volumeName is the pattern the daemon accepts for named volumes.
+	volumeName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]+$`)
+	// driverName matches plugin names such as "local" or "rexray/ebs:latest".
+	driverName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_./:-]*$`)
+)
+
+// Volume statuses, from the containers that mount a volume.
+const (
+	// VolumeInUse volumes are mounted by at least one running container.
+	VolumeInUse = "in-use"
+	// VolumeIdle volumes are only mounted by stopped containers.
+	VolumeIdle = "idle"
+	// VolumeOrphaned volumes are not mounted by any container, like `docker volume ls -f dangling=true`.
+	VolumeOrphaned = "orphaned"
+)
+
+var volumeStatuses = map[string]bool{VolumeInUse: true, VolumeIdle: true, VolumeOrphaned: true}
+
+// volumeSorts maps the ?sort= keys of ListVolumes to their less functions.
+var volumeSorts = map[string]func(a, b VolumeSummary) bool{
+	"name":       func(a, b VolumeSummary) bool { return a.Name < b.Name },
+	"size":       func(a, b VolumeSummary) bool { return a.Size < b.Size },
+	"driver":     func(a, b VolumeSummary) bool { return a.Driver < b.Driver },
+	"created":    func(a, b VolumeSummary) bool { return a.CreatedAt < b.CreatedAt },
+	"containers": func(a, b VolumeSummary) bool { return len(a.Containers) < len(b.Containers) },
+}
+
+// VolumeSummary is a volume with its disk usage and the containers that mount it.
+type VolumeSummary struct {
+	Name       string            `json:"name"`
+	Driver     string            `json:"driver"`
+	Scope      string            `json:"scope"`
+	Mountpoint string            `json:"mountpoint"`
+	CreatedAt  string            `json:"createdAt"`
+	Labels     map[string]string `json:"labels"`
+	Options    map[string]string `json:"options"`
+	// Size is the space used in bytes, or -1 where the daemon cannot tell, as for volumes
+	// of drivers other than "local" or when usage was not requested.
+	Size       int64             `json:"size"`
+	Status     string            `json:"status"`
+	Containers []VolumeContainer `json:"containers"`
+}
+
+// VolumeContainer is a container mounting a volume and where it mounts it.
+type VolumeContainer struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	State       string `json:"state"`
+	Destination string `json:"destination"`
+	ReadOnly    bool   `json:"readOnly"`
+}
+
+type VolumeList struct {
+	Volumes []VolumeSummary `json:"volumes"`
+	// TotalSize adds up the sizes that are known.
+	TotalSize int64    `json:"totalSize"`
+	Warnings  []string `json:"warnings"`
+}
+
+// volumeFilter holds the ?driver=, ?label=, ?status= and ?minSize= filters of ListVolumes.
+// Each repeated or comma-separated value of driver and status is an alternative; every
+// label, given as "key" or "key=value", must match.
+type volumeFilter struct {
+	drivers  map[string]bool
+	labels   []string
+	statuses map[string]bool
+	minSize  int64
+}
+
+func parseVolumeFilter(c *gin.Context) (volumeFilter, error) {
+	f := volumeFilter{drivers: map[string]bool{}, statuses: map[string]bool{}, labels: queryList(c, "label")}
+	for _, d := range queryList(c, "driver") {
+		f.drivers[d] = true
+	}
+	for _, s := range queryList(c, "status") {
+		if !volumeStatuses[s] {
+			return f, fmt.Errorf("unknown status %q, expected in-use, idle or orphaned", s)
+		}
+		f.statuses[s] = true
+	}
+	if v := c.Query("minSize"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			return f, fmt.Errorf("minSize must be a number of bytes")
+		}
+		f.minSize = n
+	}
+	return f, nil
+}
+
+func (f volumeFilter) match(v VolumeSummary) bool {
+	if len(f.drivers) > 0 && !f.drivers[v.Driver] {
+		return false
+	}
+	if len(f.statuses) > 0 && !f.statuses[v.Status] {
+		return false
+	}
+	if f.minSize > 0 && v.Size < f.minSize {
+		return false
+	}
+	for _, l := range f.labels {
+		key, value, hasValue := strings.Cut(l, "=")
+		got, ok := v.Labels[key]
+		if !ok || hasValue && got != value {
+			return false
+		}
+	}
+	return true
+}
+
+// ListVolumes lists volumes with their disk usage and the containers, running or stopped,
+// that mount them. Filter with ?driver=, ?label=, ?status= and ?minSize=, and order with
+// ?sort=name|size|driver|created|containers and ?order=desc. Sizes come from the daemon's
+// disk usage data, which walks every local volume; ?usage=false skips it.
+func ListVolumes(c *gin.Context, cli docker.DockerAPI) {
+	filter, err := parseVolumeFilter(c)
+	if err != nil {
+		writeAPIError(c, http.StatusBadRequest, "Invalid volume filter", err.Error())
+		return
+	}
+	sortKey := c.DefaultQuery("sort", "name")
+	less, ok := volumeSorts[sortKey]
+	if !ok {
+		writeAPIError(c, http.StatusBadRequest, "Invalid volume filter", fmt.Sprintf("unknown sort %q", sortKey))
+		return
+	}
+
+	ctx := c.Request.Context()
+	list, err := cli.VolumeList(ctx, volume.ListOptions{})
+	if err != nil {
+		writeAPIError(c, http.StatusInternalServerError, "Failed to list volumes", err.Error())
+		return
+	}
+	containers, err := cli.ContainerList(ctx, container.ListOptions{All: true})
+	if err != nil {
+		writeAPIError(c, http.StatusInternalServerError, "Failed to list volumes", err.Error())
+		return
+	}
+	result := VolumeList{Volumes: []VolumeSummary{}, Warnings: append([]string{}, list.Warnings...)}
+	sizes := map[string]int64{}
+	if c.Query("usage") != "false" {
+		du, err := cli.DiskUsage(ctx, types.DiskUsageOptions{Types: []types.DiskUsageObject{types.VolumeObject}})
+		if err != nil {
+			// the daemon refuses a second disk usage run while one is in progress
+			result.Warnings = append(result.Warnings, "volume sizes unavailable: "+err.Error())
+		}
+		for _, v := range du.Volumes {
+			if v.UsageData != nil {
+				sizes[v.Name] = v.UsageData.Size
+			}
+		}
+	}
+
+	mounts := volumeMounts(containers)
+	for _, v := range list.Volumes {
+		s := VolumeSummary{
+			Name:       v.Name,
+			Driver:     v.Driver,
+			Scope:      v.Scope,
+			Mountpoint: v.Mountpoint,
+			CreatedAt:  v.CreatedAt,
+			Labels:     v.Labels,
+			Options:    v.Options,
+			Size:       -1,
+			Status:     VolumeOrphaned,
+			Containers: mounts[v.Name],
+		}
+		if size, ok := sizes[v.Name]; ok {
+			s.Size = size
+		}
+		if s.Containers == nil {
+			s.Containers = []VolumeContainer{}
+		}
+		for _, ct := range s.Containers {
+			s.Status = VolumeIdle
+			if ct.State == "running" {
+				s.Status = VolumeInUse
+				break
+			}
+		}
+		if !filter.match(s) {
+			continue
+		}
+		if s.Size > 0 {
+			result.TotalSize += s.Size
+		}
+		result.Volumes = append(result.Volumes, s)
+	}
+
+	desc := c.Query("order") == "desc"
+	sort.SliceStable(result.Volumes, func(i, j int) bool {
+		a, b := result.Volumes[i], result.Volumes[j]
+		if desc {
+			a, b = b, a
+		}
+		if less(a, b) != less(b, a) {
+			return less(a, b)
+		}
+		return result.Volumes[i].Name < result.Volumes[j].Name
+	})
+	c.JSON(http.StatusOK, result)
+}
+
+// volumeMounts maps volume names to the containers mounting them. Helper containers are
+// left out so a backup in progress does not make a volume look in use.
+func volumeMounts(containers []types.Container) map[string][]VolumeContainer {
+	out := map[string][]VolumeContainer{}
+	for _, ct := range containers {
+		if _, ok := ct.Labels[helperLabel]; ok {
+			continue
+		}
+		name := ct.ID
+		if len(ct.Names) > 0 {
+			name = strings.TrimPrefix(ct.Names[0], "/")
+		}
+		for _, m := range ct.Mounts {
+			if m.Type != mount.TypeVolume || m.Name == "" {
+				continue
+			}
+			out[m.Name] = append(out[m.Name], VolumeContainer{
+				ID:          ct.ID,
+				Name:        name,
+				State:       ct.State,
+				Destination: m.Destination,
+				ReadOnly:    !m.RW,
+			})
+		}
+	}
+	for _, cts := range out {
+		sort.Slice(cts, func(i, j int) bool { return cts[i].Name < cts[j].Name })
+	}
+	return out
+}
+
+// CreateVolumeRequest creates a named volume. An empty Name lets the daemon pick one and
+// an empty Driver means "local". DriverOpts uses the Compose key, e.g.
+// {"type": "nfs", "o": "addr=10.0.0.5,rw", "device": ":/exports/data"}.
+type CreateVolumeRequest struct {
+	Name       string            `json:"name"`
+	Driver     string            `json:"driver"`
+	DriverOpts map[string]string `json:"driver_opts"`
+	Labels     map[string]string `json:"labels"`
+}
+
+func (r CreateVolumeRequest) validate() error {
+	if r.Name != "" && !volumeName.MatchString(r.Name) {
+		return fmt.Errorf("name %q must be at least two characters of letters, digits, '_', '.' or '-', starting with a letter or digit", r.Name)
+	}
+	if r.Driver != "" && !driverName.MatchString(r.Driver) {
+		return fmt.Errorf("invalid driver %q", r.Driver)
+	}
+	for k := range r.DriverOpts {
+		if k == "" {
+			return fmt.Errorf("driver_opts: empty option name")
+		}
+	}
+	for k := range r.Labels {
+		if k == "" {
+			return fmt.Errorf("labels: empty label key")
+		}
+	}
+	return nil
+}
+
+// hostDevice reports the host path a local-driver volume would mount, as with
+// {"type": "none", "o": "bind", "device": "/srv/data"} or a block device such as /dev/sdb.
+// Network filesystems (":/export" for NFS, "//server/share" for CIFS) are not host paths.
+func (r CreateVolumeRequest) hostDevice() (string, bool) {
+	if r.Driver != "" && r.Driver != "local" {
+		return "", false
+	}
+	device := r.DriverOpts["device"]
+	for _, o := range strings.Split(r.DriverOpts["o"], ",") {
+		if o = strings.TrimSpace(o); o == "bind" || o == "rbind" {
+			return device, true
+		}
+	}
+	return device, strings.HasPrefix(device, "/") && !strings.HasPrefix(device, "//")
+}
+
+// CreateVolume creates a volume and returns it with 201. Creating a volume under a name
+// that is already taken is a conflict, although the daemon itself would return the
+// existing volume. Like host path binds, volumes backed by a host path or device are
+// reserved to administrators unless the path is under BindRoots.
+func CreateVolume(c *gin.Context, cli docker.DockerAPI, cfg Config) {
+	var req CreateVolumeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeAPIError(c, http.StatusBadRequest, "Invalid volume config", err.Error())
+		return
+	}
+	if err := req.validate(); err != nil {
+		writeAPIError(c, http.StatusBadRequest, "Invalid volume config", err.Error())
+		return
+	}
+	if device, ok := req.hostDevice(); ok && !isAdmin(c, cfg) && !bindAllowed(device, cfg.BindRoots) {
+		writeAPIError(c, http.StatusForbidden, "Permission denied", "only administrators may create volumes on host path "+device)
+		return
+	}
+	setAuditTarget(c, req.Name)
+	ctx := c.Request.Context()
+	if req.Name != "" {
+		if _, err := cli.VolumeInspect(ctx, req.Name); err == nil {
+			writeAPIError(c, http.StatusConflict, "Volume already exists", req.Name)
+			return
+		} else if !cerrdefs.IsNotFound(err) {
+			writeAPIError(c, http.StatusInternalServerError, "Failed to create volume", err.Error())
+			return
+		}
+	}
+	driver := req.Driver
+	if driver == "" {
+		driver = "local"
+	}
+	vol, err := cli.VolumeCreate(ctx, volume.CreateOptions{
+		Name:       req.Name,
+		Driver:     driver,
+		DriverOpts: req.DriverOpts,
+		Labels:     req.Labels,
+	})
+	if err != nil {
+		if cerrdefs.IsNotFound(err) {
+			// the only thing a create can fail to find is the driver plugin
+			writeAPIError(c, http.StatusBadRequest, "Unknown volume driver", err.Error())
+			return
+		}
+		writeVolumeError(c, err, "Failed to create volume")
+		return
+	}
+	setAuditTarget(c, vol.Name)
+	c.JSON(http.StatusCreated, vol)
+}
+
+func writeVolumeError(c *gin.Context, err error, message string) {
+	status := http.StatusInternalServerError
+	switch {
+	case cerrdefs.IsNotFound(err):
+		status = http.StatusNotFound
+	case cerrdefs.IsInvalidArgument(err):
+		status = http.StatusBadRequest
+	case cerrdefs.IsConflict(err):
+		status = http.StatusConflict
+	}
+	writeAPIError(c, status, message, err.Error())
+}
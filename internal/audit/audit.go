@@ -0,0 +1,210 @@
+// Package audit records mutating API actions in an append-only NDJSON file.
+package audit
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+	// ResultAccepted marks a request that started a background job; a second entry with the
+	// same Job records how the job ended.
+	ResultAccepted = "accepted"
+)
+
+// Entry is one recorded action.
+type Entry struct {
+	ID         string         `json:"id"`
+	Time       time.Time      `json:"time"`
+	User       string         `json:"user"`
+	ClientIP   string         `json:"clientIp"`
+	Action     string         `json:"action"`
+	Target     string         `json:"target,omitempty"`
+	Method     string         `json:"method"`
+	Path       string         `json:"path"`
+	Params     map[string]any `json:"params,omitempty"`
+	Status     int            `json:"status"`
+	Result     string         `json:"result"`
+	Error      string         `json:"error,omitempty"`
+	Job        string         `json:"job,omitempty"`
+	DurationMs int64          `json:"durationMs"`
+}
+
+// Filter selects entries; zero fields match everything. Action matches a prefix, so
+// "container." selects every container action.
+type Filter struct {
+	User   string
+	Action string
+	Target string
+	Result string
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+	Offset int
+}
+
+func (f Filter) match(e Entry) bool {
+	switch {
+	case f.User != "" && e.User != f.User:
+		return false
+	case f.Action != "" && !strings.HasPrefix(e.Action, f.Action):
+		return false
+	case f.Target != "" && !strings.Contains(e.Target, f.Target):
+		return false
+	case f.Result != "" && e.Result != f.Result:
+		return false
+	case !f.Since.IsZero() && e.Time.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && e.Time.After(f.Until):
+		return false
+	}
+	return true
+}
+
+// Log is an append-only audit log file. Each entry is fsynced before Append returns.
+type Log struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+}
+
+func Open(path string) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &Log{path: path, f: f}, nil
+}
+
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Close()
+}
+
+// Append writes e, filling in its ID and time when unset.
+func (l *Log) Append(e Entry) error {
+	if e.ID == "" {
+		b := make([]byte, 8)
+		_, _ = rand.Read(b)
+		e.ID = hex.EncodeToString(b)
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.f.Write(line); err != nil {
+		return err
+	}
+	return l.f.Sync()
+}
+
+// Query returns matching entries newest first, paginated by the filter's Limit and Offset,
+// together with the total number of matches.
+func (l *Log) Query(f Filter) ([]Entry, int, error) {
+	var matches []Entry
+	err := l.scan(func(e Entry) {
+		if f.match(e) {
+			matches = append(matches, e)
+		}
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Time.After(matches[j].Time) })
+	total := len(matches)
+	if f.Offset > 0 {
+		if f.Offset >= len(matches) {
+			matches = nil
+		} else {
+			matches = matches[f.Offset:]
+		}
+	}
+	if f.Limit > 0 && len(matches) > f.Limit {
+		matches = matches[:f.Limit]
+	}
+	if matches == nil {
+		matches = []Entry{}
+	}
+	return matches, total, nil
+}
+
+// Export writes every entry matching f, oldest first, as "ndjson" or "csv".
+func (l *Log) Export(w io.Writer, format string, f Filter) error {
+	switch format {
+	case "ndjson":
+		enc := json.NewEncoder(w)
+		var werr error
+		err := l.scan(func(e Entry) {
+			if werr == nil && f.match(e) {
+				werr = enc.Encode(e)
+			}
+		})
+		return errors.Join(err, werr)
+	case "csv":
+		cw := csv.NewWriter(w)
+		_ = cw.Write([]string{"id", "time", "user", "client_ip", "action", "target", "method", "path", "params", "status", "result", "error", "job", "duration_ms"})
+		err := l.scan(func(e Entry) {
+			if !f.match(e) {
+				return
+			}
+			params := ""
+			if len(e.Params) > 0 {
+				b, _ := json.Marshal(e.Params)
+				params = string(b)
+			}
+			_ = cw.Write([]string{
+				e.ID, e.Time.Format(time.RFC3339Nano), e.User, e.ClientIP, e.Action, e.Target, e.Method, e.Path,
+				params, strconv.Itoa(e.Status), e.Result, e.Error, e.Job, strconv.FormatInt(e.DurationMs, 10),
+			})
+		})
+		cw.Flush()
+		return errors.Join(err, cw.Error())
+	default:
+		return fmt.Errorf("unknown export format %q", format)
+	}
+}
+
+// scan calls fn for every entry in file order. Lines that fail to parse, such as a
+// partial line left by a crash, are skipped.
+func (l *Log) scan(fn func(Entry)) error {
+	f, err := os.Open(l.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for sc.Scan() {
+		var e Entry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			continue
+		}
+		fn(e)
+	}
+	return sc.Err()
+}
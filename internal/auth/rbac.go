@@ -0,0 +1,70 @@
+package auth
+
+import "fmt"
+
+type Role string
+
+const (
+	RoleViewer   Role = "viewer"
+	RoleOperator Role = "operator"
+	RoleAdmin    Role = "admin"
+)
+
+// Action is a permission checked before a route handler runs.
+type Action string
+
+const (
+	ActionView    Action = "view"    // list, inspect, logs, stats, events, jobs
+	ActionOperate Action = "operate" // start, stop, restart, cancel jobs
+	ActionExec    Action = "exec"    // interactive exec sessions
+	ActionCreate  Action = "create"  // run containers, pull images, create volumes
+	ActionBuild   Action = "build"   // build images
+	ActionRemove  Action = "remove"  // remove containers, images and volumes, prune
+	ActionNetwork Action = "network" // create and remove networks
+	ActionSecrets Action = "secrets" // reveal masked environment variables
+	ActionAdmin   Action = "admin"   // manage users and server settings
+)
+
+var rolePermissions = map[Role]map[Action]bool{
+	RoleViewer: {
+		ActionView: true,
+	},
+	RoleOperator: {
+		ActionView:    true,
+		ActionOperate: true,
+		ActionExec:    true,
+		ActionCreate:  true,
+		ActionBuild:   true,
+	},
+	RoleAdmin: {
+		ActionView:    true,
+		ActionOperate: true,
+		ActionExec:    true,
+		ActionCreate:  true,
+		ActionBuild:   true,
+		ActionRemove:  true,
+		ActionNetwork: true,
+		ActionSecrets: true,
+		ActionAdmin:   true,
+	},
+}
+
+// ParseRole validates a role name.
+func ParseRole(s string) (Role, error) {
+	r := Role(s)
+	if _, ok := rolePermissions[r]; !ok {
+		return "", fmt.Errorf("unknown role %q (want viewer, operator or admin)", s)
+	}
+	return r, nil
+}
+
+// Can reports whether role grants action.
+func (r Role) Can(action Action) bool {
+	return rolePermissions[r][action]
+}
+
+// Scoped reports whether a user's container rights are limited by their label selector.
+// Viewing is never scoped, and administrators are never scoped.
+func (u User) Scoped(action Action) bool {
+	return u.Selector != "" && u.Role != RoleAdmin && action != ActionView
+}
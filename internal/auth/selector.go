@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Selector is a label selector in the style of `docker ps --filter label=...`, e.g.
+// "team=payments,env!=prod,managed". Every requirement must hold for a match.
+type Selector []requirement
+
+type requirement struct {
+	key   string
+	op    string // "=", "!=" or "" for "key exists"
+	value string
+}
+
+// ParseSelector parses a comma-separated list of key=value, key!=value and key requirements.
+func ParseSelector(s string) (Selector, error) {
+	var sel Selector
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		var r requirement
+		if k, v, ok := strings.Cut(part, "!="); ok {
+			r = requirement{key: k, op: "!=", value: v}
+		} else if k, v, ok := strings.Cut(part, "="); ok {
+			r = requirement{key: k, op: "=", value: v}
+		} else {
+			r = requirement{key: part}
+		}
+		r.key = strings.TrimSpace(r.key)
+		r.value = strings.TrimSpace(r.value)
+		if r.key == "" {
+			return nil, fmt.Errorf("invalid selector requirement %q", part)
+		}
+		sel = append(sel, r)
+	}
+	return sel, nil
+}
+
+// Matches reports whether labels satisfy every requirement.
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, r := range s {
+		v, ok := labels[r.key]
+		switch r.op {
+		case "=":
+			if !ok || v != r.value {
+				return false
+			}
+		case "!=":
+			if ok && v == r.value {
+				return false
+			}
+		default:
+			if !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Defaults returns the labels a new resource needs to satisfy the selector's equality
+// and existence requirements.
+func (s Selector) Defaults() map[string]string {
+	out := map[string]string{}
+	for _, r := range s {
+		switch r.op {
+		case "=":
+			out[r.key] = r.value
+		case "":
+			if _, ok := out[r.key]; !ok {
+				out[r.key] = ""
+			}
+		}
+	}
+	return out
+}
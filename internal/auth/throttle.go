@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// LoginThrottle slows down password guessing. Failed attempts are counted per username and
+// client address, and per username alone with a higher limit, so that guesses spread over
+// many addresses are held back too.
+type LoginThrottle struct {
+	window    time.Duration
+	perClient int
+	perUser   int
+
+	mu       sync.Mutex
+	failures map[string][]time.Time // key -> failure times, oldest first
+}
+
+func NewLoginThrottle(perClient, perUser int, window time.Duration) *LoginThrottle {
+	return &LoginThrottle{window: window, perClient: perClient, perUser: perUser, failures: map[string][]time.Time{}}
+}
+
+// Wait reports how long username must wait before trying again from clientIP; zero means
+// it may try now.
+func (t *LoginThrottle) Wait(username, clientIP string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	return max(t.waitLocked(clientKey(username, clientIP), t.perClient, now), t.waitLocked(userKey(username), t.perUser, now))
+}
+
+// Fail records a failed attempt.
+func (t *LoginThrottle) Fail(username, clientIP string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	for key, times := range t.failures {
+		if !times[len(times)-1].After(now.Add(-t.window)) {
+			delete(t.failures, key)
+		}
+	}
+	for _, key := range []string{clientKey(username, clientIP), userKey(username)} {
+		t.failures[key] = append(t.failures[key], now)
+	}
+}
+
+// Succeed forgets the failed attempts of username from clientIP.
+func (t *LoginThrottle) Succeed(username, clientIP string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.failures, clientKey(username, clientIP))
+}
+
+// waitLocked drops failures older than the window and, when limit remain, returns the time
+// until the oldest of them expires.
+func (t *LoginThrottle) waitLocked(key string, limit int, now time.Time) time.Duration {
+	times := t.failures[key]
+	for len(times) > 0 && !times[0].After(now.Add(-t.window)) {
+		times = times[1:]
+	}
+	if len(times) == 0 {
+		delete(t.failures, key)
+		return 0
+	}
+	t.failures[key] = times
+	if len(times) < limit {
+		return 0
+	}
+	return times[len(times)-limit].Add(t.window).Sub(now)
+}
+
+func clientKey(username, clientIP string) string { return "client:" + clientIP + "/" + username }
+
+func userKey(username string) string { return "user:" + username }
@@ -0,0 +1,225 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/Nebula-work/docker-web/internal/utils"
+)
+
+const (
+	tokenTypeAccess  = "access"
+	tokenTypeRefresh = "refresh"
+	issuer           = "docker-web"
+)
+
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// Claims are the JWT claims of both access and refresh tokens; Type tells them apart.
+type Claims struct {
+	Type string `json:"typ"`
+	jwt.RegisteredClaims
+}
+
+// TokenPair is returned on login and refresh.
+type TokenPair struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+	TokenType    string `json:"tokenType"`
+	ExpiresIn    int    `json:"expiresIn"`
+}
+
+// TokenIssuer signs and verifies HS256 tokens. Refresh tokens are single-use: refreshing
+// or logging out revokes the presented token until it would have expired anyway.
+// Revocations are only kept in memory unless LoadRevocations gives them a file.
+type TokenIssuer struct {
+	secret     []byte
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+
+	mu      sync.Mutex
+	revoked map[string]time.Time            // refresh token ID -> expiry
+	issued  map[string]map[string]time.Time // username -> unused refresh token ID -> expiry
+	path    string                          // file revoked is saved to, if any
+}
+
+func NewTokenIssuer(secret []byte, accessTTL, refreshTTL time.Duration) *TokenIssuer {
+	return &TokenIssuer{
+		secret: secret, accessTTL: accessTTL, refreshTTL: refreshTTL,
+		revoked: map[string]time.Time{}, issued: map[string]map[string]time.Time{},
+	}
+}
+
+// RandomSecret returns a fresh signing key for when none is configured.
+func RandomSecret() []byte {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return b
+}
+
+// LoadRevocations keeps revoked refresh tokens in the file at path, so that a token used for
+// refreshing or logging out stays unusable after a restart, and loads those already there.
+func (t *TokenIssuer) LoadRevocations(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &t.revoked); err != nil {
+			return fmt.Errorf("parse %s: %w", path, err)
+		}
+	}
+	t.path = path
+	return nil
+}
+
+// Issue creates a new access and refresh token for username.
+func (t *TokenIssuer) Issue(username string) (TokenPair, error) {
+	access, _, err := t.sign(username, tokenTypeAccess, t.accessTTL)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	refresh, claims, err := t.sign(username, tokenTypeRefresh, t.refreshTTL)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	t.mu.Lock()
+	if t.issued[username] == nil {
+		t.issued[username] = map[string]time.Time{}
+	}
+	t.issued[username][claims.ID] = claims.ExpiresAt.Time
+	t.mu.Unlock()
+	return TokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(t.accessTTL.Seconds()),
+	}, nil
+}
+
+// ParseAccess validates an access token and returns its claims.
+func (t *TokenIssuer) ParseAccess(token string) (*Claims, error) {
+	return t.parse(token, tokenTypeAccess)
+}
+
+// Refresh validates and revokes a refresh token, returning the claims it carried so the
+// caller can issue a new pair.
+func (t *TokenIssuer) Refresh(token string) (*Claims, error) {
+	claims, err := t.parse(token, tokenTypeRefresh)
+	if err != nil {
+		return nil, err
+	}
+	if !t.revoke(claims) {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// Revoke invalidates a refresh token. Invalid tokens are ignored.
+func (t *TokenIssuer) Revoke(token string) {
+	if claims, err := t.parse(token, tokenTypeRefresh); err == nil {
+		t.revoke(claims)
+	}
+}
+
+// RevokeUser invalidates every refresh token issued to username, e.g. after a password
+// change. Access tokens stay valid until they expire.
+func (t *TokenIssuer) RevokeUser(username string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for id, exp := range t.issued[username] {
+		t.revoked[id] = exp
+	}
+	delete(t.issued, username)
+	t.saveLocked()
+}
+
+// revoke marks the token as used and reports whether it was still valid.
+func (t *TokenIssuer) revoke(claims *Claims) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	for id, exp := range t.revoked {
+		if exp.Before(now) {
+			delete(t.revoked, id)
+		}
+	}
+	for user, ids := range t.issued {
+		for id, exp := range ids {
+			if exp.Before(now) {
+				delete(ids, id)
+			}
+		}
+		if len(ids) == 0 {
+			delete(t.issued, user)
+		}
+	}
+	delete(t.issued[claims.Subject], claims.ID)
+	if _, ok := t.revoked[claims.ID]; ok {
+		return false
+	}
+	t.revoked[claims.ID] = claims.ExpiresAt.Time
+	t.saveLocked()
+	return true
+}
+
+// saveLocked writes the revoked tokens to the file given to LoadRevocations. A failure is
+// only logged: the revocation still holds until the server restarts.
+func (t *TokenIssuer) saveLocked() {
+	if t.path == "" {
+		return
+	}
+	data, err := json.Marshal(t.revoked)
+	if err == nil {
+		err = utils.WriteFileAtomic(t.path, data, 0600)
+	}
+	if err != nil {
+		log.Printf("save revoked tokens: %v", err)
+	}
+}
+
+func (t *TokenIssuer) sign(username, typ string, ttl time.Duration) (string, *Claims, error) {
+	now := time.Now()
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	claims := &Claims{
+		Type: typ,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   username,
+			ID:        hex.EncodeToString(id),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(t.secret)
+	return token, claims, err
+}
+
+func (t *TokenIssuer) parse(token, typ string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (any, error) { return t.secret, nil },
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if claims.Type != typ || claims.Subject == "" {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
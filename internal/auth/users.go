@@ -0,0 +1,291 @@
+// Package auth provides the local user store and the signed session tokens used by the API.
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/Nebula-work/docker-web/internal/utils"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrUserExists         = errors.New("user already exists")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrLastAdmin          = errors.New("cannot remove the last administrator")
+)
+
+// minPasswordLength is enforced whenever a password is set.
+const minPasswordLength = 8
+
+// User is a local account. PasswordHash is a bcrypt hash and is never sent to clients.
+type User struct {
+	Username     string `json:"username"`
+	PasswordHash string `json:"passwordHash"`
+	Role         Role   `json:"role"`
+	// Selector optionally limits the user's container rights to containers whose labels match it.
+	Selector  string    `json:"selector,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	// PasswordChangedAt is when the password was last set; refresh tokens issued before it are
+	// rejected even after a restart has cleared the in-memory revocations.
+	PasswordChangedAt time.Time `json:"passwordChangedAt"`
+}
+
+// IssuedBeforePasswordChange reports whether a token issued at iat predates the user's last
+// password change. Token times have second precision, so the change time is truncated to
+// match and a token issued in the same second is accepted.
+func (u User) IssuedBeforePasswordChange(iat time.Time) bool {
+	return iat.Before(u.PasswordChangedAt.Truncate(time.Second))
+}
+
+// UserStore keeps local users in a JSON file.
+type UserStore struct {
+	path string
+
+	mu    sync.RWMutex
+	users map[string]*User
+}
+
+// dummyHash is compared against when a username does not exist so that
+// failed logins take the same time whether or not the user is known.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("docker-web-dummy-password"), bcrypt.DefaultCost)
+
+// OpenUserStore loads the store at path, creating an empty one if the file does not exist.
+func OpenUserStore(path string) (*UserStore, error) {
+	s := &UserStore{path: path, users: map[string]*User{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Users []*User `json:"users"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	for _, u := range file.Users {
+		if u.Role == "" {
+			// accounts created before roles existed had full access
+			u.Role = RoleAdmin
+		}
+		s.users[u.Username] = u
+	}
+	return s, nil
+}
+
+// Empty reports whether no users exist yet.
+func (s *UserStore) Empty() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.users) == 0
+}
+
+// Authenticate checks a username and password.
+func (s *UserStore) Authenticate(username, password string) (User, error) {
+	s.mu.RLock()
+	u, ok := s.users[username]
+	s.mu.RUnlock()
+	if !ok {
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return User{}, ErrInvalidCredentials
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)); err != nil {
+		return User{}, ErrInvalidCredentials
+	}
+	return *u, nil
+}
+
+func (s *UserStore) Get(username string) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.users[username]
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	return *u, nil
+}
+
+// List returns all users sorted by name.
+func (s *UserStore) List() []User {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]User, 0, len(s.users))
+	for _, u := range s.users {
+		out = append(out, *u)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Username < out[j].Username })
+	return out
+}
+
+// Create adds a user with the given password, role and optional label selector.
+func (s *UserStore) Create(username, password string, role Role, selector string) (User, error) {
+	username = strings.TrimSpace(username)
+	if username == "" || strings.ContainsAny(username, " \t\n/:") {
+		return User{}, fmt.Errorf("invalid username %q", username)
+	}
+	if err := validateRole(role, selector); err != nil {
+		return User{}, err
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return User{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[username]; ok {
+		return User{}, ErrUserExists
+	}
+	now := time.Now().UTC()
+	u := &User{Username: username, PasswordHash: hash, Role: role, Selector: selector, CreatedAt: now, UpdatedAt: now, PasswordChangedAt: now}
+	s.users[username] = u
+	if err := s.saveLocked(); err != nil {
+		delete(s.users, username)
+		return User{}, err
+	}
+	return *u, nil
+}
+
+// SetPassword replaces a user's password.
+func (s *UserStore) SetPassword(username, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[username]
+	if !ok {
+		return ErrUserNotFound
+	}
+	prev := *u
+	u.PasswordHash = hash
+	u.UpdatedAt = time.Now().UTC()
+	u.PasswordChangedAt = u.UpdatedAt
+	if err := s.saveLocked(); err != nil {
+		*u = prev
+		return err
+	}
+	return nil
+}
+
+// Update changes a user's role and label selector and, when password is not empty, their
+// password. Everything is validated before the store is touched, so either all changes are
+// saved or none are.
+func (s *UserStore) Update(username string, role Role, selector, password string) (User, error) {
+	if err := validateRole(role, selector); err != nil {
+		return User{}, err
+	}
+	var hash string
+	if password != "" {
+		var err error
+		if hash, err = hashPassword(password); err != nil {
+			return User{}, err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[username]
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	if u.Role == RoleAdmin && role != RoleAdmin && s.adminCountLocked() == 1 {
+		return User{}, ErrLastAdmin
+	}
+	prev := *u
+	u.Role, u.Selector = role, selector
+	u.UpdatedAt = time.Now().UTC()
+	if hash != "" {
+		u.PasswordHash = hash
+		u.PasswordChangedAt = u.UpdatedAt
+	}
+	if err := s.saveLocked(); err != nil {
+		*u = prev
+		return User{}, err
+	}
+	return *u, nil
+}
+
+// Delete removes a user.
+func (s *UserStore) Delete(username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[username]
+	if !ok {
+		return ErrUserNotFound
+	}
+	if u.Role == RoleAdmin && s.adminCountLocked() == 1 {
+		return ErrLastAdmin
+	}
+	delete(s.users, username)
+	if err := s.saveLocked(); err != nil {
+		s.users[username] = u
+		return err
+	}
+	return nil
+}
+
+func (s *UserStore) adminCountLocked() int {
+	n := 0
+	for _, u := range s.users {
+		if u.Role == RoleAdmin {
+			n++
+		}
+	}
+	return n
+}
+
+// saveLocked writes the store atomically; the file is only readable by the server user.
+func (s *UserStore) saveLocked() error {
+	users := make([]*User, 0, len(s.users))
+	for _, u := range s.users {
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+	data, err := json.MarshalIndent(struct {
+		Users []*User `json:"users"`
+	}{users}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(s.path, data, 0600)
+}
+
+func validateRole(role Role, selector string) error {
+	if _, err := ParseRole(string(role)); err != nil {
+		return err
+	}
+	_, err := ParseSelector(selector)
+	return err
+}
+
+func hashPassword(password string) (string, error) {
+	if len(password) < minPasswordLength {
+		return "", fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// RandomPassword returns a random URL-safe password for bootstrapping the first account.
+func RandomPassword() string {
+	b := make([]byte, 18)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,202 @@
+// Package backups keeps volume backup archives in a local directory, one subdirectory per
+// volume name, so a backup taken on one Docker host can be restored on any other.
+package backups
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Ext is the extension of every stored archive.
+const Ext = ".tar.gz"
+
+var (
+	ErrNotFound    = errors.New("backup not found")
+	ErrInvalidName = errors.New("invalid backup name")
+
+	// safeName matches volume names and archive file names; neither may contain a path separator.
+	safeName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+)
+
+// Backup describes one stored archive.
+type Backup struct {
+	Volume    string    `json:"volume"`
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type Store struct {
+	dir string
+}
+
+// Open returns a store rooted at dir, creating the directory if needed.
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Writer receives a new archive. Nothing is visible in the store until Commit; Abort
+// discards the partial file.
+type Writer struct {
+	*os.File
+	volume, dir, stamp string
+}
+
+// Create starts a new archive for volume, named after the volume and the current time.
+func (s *Store) Create(volume string) (*Writer, error) {
+	if !safeName.MatchString(volume) {
+		return nil, ErrInvalidName
+	}
+	dir := filepath.Join(s.dir, volume)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp(dir, ".partial-*")
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{File: f, volume: volume, dir: dir, stamp: time.Now().UTC().Format("20060102-150405")}, nil
+}
+
+// Commit closes the archive and publishes it under its final name. A second backup taken
+// within the same second gets a numbered name rather than replacing the first.
+func (w *Writer) Commit() (Backup, error) {
+	defer os.Remove(w.File.Name())
+	if err := w.File.Sync(); err != nil {
+		w.File.Close()
+		return Backup{}, err
+	}
+	if err := w.File.Close(); err != nil {
+		return Backup{}, err
+	}
+	for n := 1; ; n++ {
+		name := fmt.Sprintf("%s-%s%s", w.volume, w.stamp, Ext)
+		if n > 1 {
+			name = fmt.Sprintf("%s-%s-%d%s", w.volume, w.stamp, n, Ext)
+		}
+		p := filepath.Join(w.dir, name)
+		// a hard link, unlike a rename, fails instead of replacing an existing file
+		err := os.Link(w.File.Name(), p)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return Backup{}, err
+		}
+		info, err := os.Stat(p)
+		if err != nil {
+			return Backup{}, err
+		}
+		return newBackup(w.volume, info), nil
+	}
+}
+
+func (w *Writer) Abort() {
+	w.File.Close()
+	os.Remove(w.File.Name())
+}
+
+// List returns the backups of volume, or of every volume when it is empty, newest first.
+func (s *Store) List(volume string) ([]Backup, error) {
+	var volumes []string
+	if volume != "" {
+		if !safeName.MatchString(volume) {
+			return nil, ErrInvalidName
+		}
+		volumes = []string{volume}
+	} else {
+		entries, err := os.ReadDir(s.dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if e.IsDir() && safeName.MatchString(e.Name()) {
+				volumes = append(volumes, e.Name())
+			}
+		}
+	}
+
+	out := []Backup{}
+	for _, v := range volumes {
+		entries, err := os.ReadDir(filepath.Join(s.dir, v))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if !e.Type().IsRegular() || !isArchiveName(e.Name()) {
+				continue
+			}
+			info, err := e.Info()
+			if err != nil {
+				continue
+			}
+			out = append(out, newBackup(v, info))
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out, nil
+}
+
+// Open opens a stored archive for reading.
+func (s *Store) Open(volume, name string) (*os.File, Backup, error) {
+	p, err := s.path(volume, name)
+	if err != nil {
+		return nil, Backup{}, err
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, Backup{}, ErrNotFound
+	}
+	if err != nil {
+		return nil, Backup{}, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, Backup{}, err
+	}
+	return f, newBackup(volume, info), nil
+}
+
+func (s *Store) Remove(volume, name string) error {
+	p, err := s.path(volume, name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	// drop the volume's directory once its last backup is gone
+	_ = os.Remove(filepath.Dir(p))
+	return nil
+}
+
+func (s *Store) path(volume, name string) (string, error) {
+	if !safeName.MatchString(volume) || !isArchiveName(name) {
+		return "", ErrInvalidName
+	}
+	return filepath.Join(s.dir, volume, name), nil
+}
+
+func isArchiveName(name string) bool {
+	return safeName.MatchString(name) && strings.HasSuffix(name, Ext)
+}
+
+func newBackup(volume string, info fs.FileInfo) Backup {
+	return Backup{Volume: volume, Name: info.Name(), Size: info.Size(), CreatedAt: info.ModTime().UTC()}
+}
@@ -0,0 +1,261 @@
+// Package credentials keeps registry logins on the server so pulls, pushes and builds can
+// authenticate without the client sending a password each time. The store is a single
+// file encrypted with AES-256-GCM.
+package credentials
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/distribution/reference"
+
+	"github.com/Nebula-work/docker-web/internal/utils"
+)
+
+// DockerHub is the key Docker Hub credentials are stored under.
+const DockerHub = "docker.io"
+
+// fileMagic starts every store file and is authenticated along with the contents.
+var fileMagic = []byte("dwcred1\n")
+
+var ErrNotFound = errors.New("no credentials for registry")
+
+// Credential is a login for one registry. Password and IdentityToken never leave the
+// server; use Summary for API responses.
+type Credential struct {
+	Registry      string    `json:"registry"`
+	Username      string    `json:"username"`
+	Password      string    `json:"password,omitempty"`
+	IdentityToken string    `json:"identityToken,omitempty"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+// Summary is a Credential without its secrets.
+type Summary struct {
+	Registry  string    `json:"registry"`
+	Username  string    `json:"username"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Store holds credentials by registry host.
+type Store struct {
+	path string
+	aead cipher.AEAD
+
+	mu    sync.RWMutex
+	creds map[string]Credential
+}
+
+// Key returns the 32-byte store key. A non-empty secret is hashed into the key; otherwise
+// the key is read from keyFile, which is created with a random key on first use.
+func Key(secret, keyFile string) ([]byte, error) {
+	if secret != "" {
+		sum := sha256.Sum256([]byte(secret))
+		return sum[:], nil
+	}
+	data, err := os.ReadFile(keyFile)
+	if err == nil {
+		key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("%s: not a 64 character hex key", keyFile)
+		}
+		return key, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := utils.WriteFileAtomic(keyFile, []byte(hex.EncodeToString(key)+"\n"), 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Open loads the store at path with key, creating an empty one if the file does not exist.
+// An empty path keeps credentials in memory only.
+func Open(path string, key []byte) (*Store, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{path: path, aead: aead, creds: map[string]Credential{}}
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	n := len(fileMagic) + aead.NonceSize()
+	if len(data) < n || !bytes.Equal(data[:len(fileMagic)], fileMagic) {
+		return nil, fmt.Errorf("%s: not a credential store", path)
+	}
+	plain, err := aead.Open(nil, data[len(fileMagic):n], data[n:], fileMagic)
+	if err != nil {
+		return nil, fmt.Errorf("%s: cannot decrypt, wrong key?", path)
+	}
+	var creds []Credential
+	if err := json.Unmarshal(plain, &creds); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	for _, c := range creds {
+		s.creds[c.Registry] = c
+	}
+	return s, nil
+}
+
+// Get returns the credentials for registry, which is normalized first.
+func (s *Store) Get(registry string) (Credential, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	c, ok := s.creds[NormalizeRegistry(registry)]
+	if !ok {
+		return Credential{}, ErrNotFound
+	}
+	return c, nil
+}
+
+// ForImage returns the credentials for the registry an image reference points at.
+func (s *Store) ForImage(ref string) (Credential, error) {
+	registry, err := RegistryOf(ref)
+	if err != nil {
+		return Credential{}, err
+	}
+	return s.Get(registry)
+}
+
+// All returns every stored credential, secrets included, ordered by registry.
+func (s *Store) All() []Credential {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]Credential, 0, len(s.creds))
+	for _, c := range s.creds {
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Registry < out[j].Registry })
+	return out
+}
+
+func (s *Store) List() []Summary {
+	all := s.All()
+	out := make([]Summary, len(all))
+	for i, c := range all {
+		out[i] = c.summary()
+	}
+	return out
+}
+
+func (c Credential) summary() Summary {
+	return Summary{Registry: c.Registry, Username: c.Username, UpdatedAt: c.UpdatedAt}
+}
+
+// Set saves c, replacing any credentials for the same registry.
+func (s *Store) Set(c Credential) (Summary, error) {
+	c.Registry = NormalizeRegistry(c.Registry)
+	c.UpdatedAt = time.Now().UTC()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, existed := s.creds[c.Registry]
+	s.creds[c.Registry] = c
+	if err := s.save(); err != nil {
+		if existed {
+			s.creds[c.Registry] = prev
+		} else {
+			delete(s.creds, c.Registry)
+		}
+		return Summary{}, err
+	}
+	return c.summary(), nil
+}
+
+func (s *Store) Delete(registry string) error {
+	registry = NormalizeRegistry(registry)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, ok := s.creds[registry]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(s.creds, registry)
+	if err := s.save(); err != nil {
+		s.creds[registry] = prev
+		return err
+	}
+	return nil
+}
+
+// save writes the store; callers hold s.mu.
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+	creds := make([]Credential, 0, len(s.creds))
+	for _, c := range s.creds {
+		creds = append(creds, c)
+	}
+	sort.Slice(creds, func(i, j int) bool { return creds[i].Registry < creds[j].Registry })
+	plain, err := json.Marshal(creds)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	data := append(append(append([]byte{}, fileMagic...), nonce...), s.aead.Seal(nil, nonce, plain, fileMagic)...)
+	return utils.WriteFileAtomic(s.path, data, 0600)
+}
+
+// NormalizeRegistry reduces a registry address to the host[:port] credentials are stored
+// under; "https://index.docker.io/v1/" and other Docker Hub spellings become DockerHub.
+func NormalizeRegistry(registry string) string {
+	registry = strings.ToLower(strings.TrimSpace(registry))
+	registry = strings.TrimPrefix(registry, "https://")
+	registry = strings.TrimPrefix(registry, "http://")
+	registry, _, _ = strings.Cut(registry, "/")
+	switch registry {
+	case "", "index.docker.io", "registry-1.docker.io", "registry.hub.docker.com":
+		return DockerHub
+	}
+	return registry
+}
+
+// RegistryOf returns the registry host of an image reference such as "nginx" or
+// "ghcr.io/org/app:1.0".
+func RegistryOf(ref string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return "", fmt.Errorf("invalid image reference %q: %w", ref, err)
+	}
+	return NormalizeRegistry(reference.Domain(named)), nil
+}
+
+// ServerAddress is the address the Docker daemon expects in auth configs for registry.
+func ServerAddress(registry string) string {
+	if registry = NormalizeRegistry(registry); registry == DockerHub {
+		return "https://index.docker.io/v1/"
+	}
+	return registry
+}
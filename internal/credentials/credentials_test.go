@@ -0,0 +1,202 @@
+package credentials
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNormalizeRegistry(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", DockerHub},
+		{"docker.io", DockerHub},
+		{"index.docker.io", DockerHub},
+		{"https://index.docker.io/v1/", DockerHub},
+		{"registry-1.docker.io", DockerHub},
+		{"registry.hub.docker.com", DockerHub},
+		{"  Docker.IO  ", DockerHub},
+		{"ghcr.io", "ghcr.io"},
+		{"GHCR.io/org/app", "ghcr.io"},
+		{"https://registry.example.com/v2/", "registry.example.com"},
+		{"http://localhost:5000", "localhost:5000"},
+		{"10.0.0.5:5000/team", "10.0.0.5:5000"},
+	}
+	for _, tt := range tests {
+		if got := NormalizeRegistry(tt.in); got != tt.want {
+			t.Errorf("NormalizeRegistry(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRegistryOf(t *testing.T) {
+	tests := []struct {
+		ref, want string
+		wantErr   bool
+	}{
+		{ref: "nginx", want: DockerHub},
+		{ref: "library/nginx:1.27", want: DockerHub},
+		{ref: "docker.io/org/app", want: DockerHub},
+		{ref: "ghcr.io/org/app:1.0", want: "ghcr.io"},
+		{ref: "localhost:5000/app@sha256:" + string(bytes.Repeat([]byte("a"), 64)), want: "localhost:5000"},
+		{ref: "Invalid/Name", wantErr: true},
+		{ref: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := RegistryOf(tt.ref)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("RegistryOf(%q) = %q, %v; want %q, error %v", tt.ref, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials")
+	key := bytes.Repeat([]byte{1}, 32)
+
+	s, err := Open(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds := []Credential{
+		{Registry: "https://index.docker.io/v1/", Username: "alice", Password: "hunter22"},
+		{Registry: "ghcr.io", Username: "bob", IdentityToken: "refresh-token"},
+	}
+	for _, c := range creds {
+		if _, err := s.Set(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, fileMagic) {
+		t.Errorf("store file does not start with %q", fileMagic)
+	}
+	for _, secret := range []string{"alice", "hunter22", "refresh-token", "ghcr.io"} {
+		if bytes.Contains(data, []byte(secret)) {
+			t.Errorf("store file contains %q in plain text", secret)
+		}
+	}
+
+	reopened, err := Open(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		registry, username, password, token string
+	}{
+		{DockerHub, "alice", "hunter22", ""},
+		{"index.docker.io", "alice", "hunter22", ""},
+		{"GHCR.IO", "bob", "", "refresh-token"},
+	}
+	for _, tt := range tests {
+		c, err := reopened.Get(tt.registry)
+		if err != nil {
+			t.Errorf("Get(%q): %v", tt.registry, err)
+			continue
+		}
+		if c.Username != tt.username || c.Password != tt.password || c.IdentityToken != tt.token {
+			t.Errorf("Get(%q) = %+v, want %s/%s/%s", tt.registry, c, tt.username, tt.password, tt.token)
+		}
+	}
+	if _, err := reopened.Get("quay.io"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(quay.io) error = %v, want ErrNotFound", err)
+	}
+	if c, err := reopened.ForImage("nginx:latest"); err != nil || c.Username != "alice" {
+		t.Errorf("ForImage(nginx:latest) = %+v, %v; want alice's login", c, err)
+	}
+	for _, sum := range reopened.List() {
+		if sum.Registry == "" || sum.Username == "" {
+			t.Errorf("List returned incomplete summary %+v", sum)
+		}
+	}
+
+	if err := reopened.Delete("docker.io"); err != nil {
+		t.Fatal(err)
+	}
+	if err := reopened.Delete("docker.io"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second Delete error = %v, want ErrNotFound", err)
+	}
+	again, err := Open(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := again.All(); len(got) != 1 || got[0].Registry != "ghcr.io" {
+		t.Errorf("after delete the store holds %+v, want only ghcr.io", got)
+	}
+}
+
+func TestOpenRejectsBadFiles(t *testing.T) {
+	dir := t.TempDir()
+	key := bytes.Repeat([]byte{1}, 32)
+	good := filepath.Join(dir, "good")
+	s, err := Open(good, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Set(Credential{Registry: "ghcr.io", Username: "bob", Password: "secret123"}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(good)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := append([]byte{}, data...)
+	tampered[len(tampered)-1] ^= 0xff
+
+	tests := []struct {
+		name string
+		data []byte
+		key  []byte
+	}{
+		{"wrong key", data, bytes.Repeat([]byte{2}, 32)},
+		{"tampered", tampered, key},
+		{"truncated", data[:len(fileMagic)+4], key},
+		{"not a store", []byte(`[{"registry":"ghcr.io"}]`), key},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name)
+			if err := os.WriteFile(path, tt.data, 0600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := Open(path, tt.key); err == nil {
+				t.Error("Open succeeded")
+			}
+		})
+	}
+}
+
+func TestKey(t *testing.T) {
+	dir := t.TempDir()
+	a, err := Key("passphrase", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := Key("passphrase", ""); len(a) != 32 || !bytes.Equal(a, b) {
+		t.Error("a passphrase does not always give the same 32-byte key")
+	}
+
+	keyFile := filepath.Join(dir, "credentials.key")
+	generated, err := Key("", keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read, err := Key("", keyFile); err != nil || !bytes.Equal(read, generated) {
+		t.Errorf("reading the generated key file gave %x, %v; want %x", read, err, generated)
+	}
+
+	bad := filepath.Join(dir, "bad.key")
+	if err := os.WriteFile(bad, []byte("not hex\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Key("", bad); err == nil {
+		t.Error("Key accepted a malformed key file")
+	}
+}
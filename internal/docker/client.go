@@ -7,30 +7,64 @@ import (
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/build"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/registry"
 	"github.com/docker/docker/api/types/volume"
 	"github.com/docker/docker/client"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 // DockerAPI defines the subset of the Docker client used by handlers. This makes testing easy.
 type DockerAPI interface {
 	ContainerList(ctx context.Context, options container.ListOptions) ([]types.Container, error)
+	ContainerInspect(ctx context.Context, containerID string) (container.InspectResponse, error)
+	ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *ocispec.Platform, containerName string) (container.CreateResponse, error)
 	ContainerStart(ctx context.Context, containerID string, options container.StartOptions) error
 	ContainerStop(ctx context.Context, containerID string, options container.StopOptions) error
 	ContainerRemove(ctx context.Context, containerID string, options container.RemoveOptions) error
 	ContainerRestart(ctx context.Context, containerID string, options container.StopOptions) error
 	ContainerLogs(ctx context.Context, containerID string, options container.LogsOptions) (io.ReadCloser, error)
+	ContainerStats(ctx context.Context, containerID string, stream bool) (container.StatsResponseReader, error)
+	ContainerExecCreate(ctx context.Context, containerID string, options container.ExecOptions) (container.ExecCreateResponse, error)
+	ContainerExecAttach(ctx context.Context, execID string, options container.ExecAttachOptions) (types.HijackedResponse, error)
+	ContainerExecResize(ctx context.Context, execID string, options container.ResizeOptions) error
+	ContainerExecInspect(ctx context.Context, execID string) (container.ExecInspect, error)
+	ContainerWait(ctx context.Context, containerID string, condition container.WaitCondition) (<-chan container.WaitResponse, <-chan error)
+	CopyFromContainer(ctx context.Context, containerID, srcPath string) (io.ReadCloser, container.PathStat, error)
+	CopyToContainer(ctx context.Context, containerID, dstPath string, content io.Reader, options container.CopyToContainerOptions) error
 	ImageList(ctx context.Context, options image.ListOptions) ([]image.Summary, error)
+	ImageInspect(ctx context.Context, imageID string) (image.InspectResponse, error)
+	ImageHistory(ctx context.Context, imageID string) ([]image.HistoryResponseItem, error)
 	ImagePull(ctx context.Context, ref string, options image.PullOptions) (io.ReadCloser, error)
 	ImageBuild(ctx context.Context, buildContext io.Reader, options build.ImageBuildOptions) (build.ImageBuildResponse, error)
 	ImageRemove(ctx context.Context, imageID string, options image.RemoveOptions) ([]image.DeleteResponse, error)
+	ImageTag(ctx context.Context, source, target string) error
+	ImagePush(ctx context.Context, ref string, options image.PushOptions) (io.ReadCloser, error)
+	ImageSave(ctx context.Context, imageIDs []string) (io.ReadCloser, error)
+	ImageLoad(ctx context.Context, input io.Reader) (image.LoadResponse, error)
+	RegistryLogin(ctx context.Context, auth registry.AuthConfig) (registry.AuthenticateOKBody, error)
 	VolumeList(ctx context.Context, options volume.ListOptions) (volume.ListResponse, error)
+	VolumeInspect(ctx context.Context, volumeID string) (volume.Volume, error)
 	VolumeCreate(ctx context.Context, options volume.CreateOptions) (volume.Volume, error)
 	VolumeRemove(ctx context.Context, volumeID string, force bool) error
 	NetworkList(ctx context.Context, options network.ListOptions) ([]network.Summary, error)
+	NetworkInspect(ctx context.Context, networkID string, options network.InspectOptions) (network.Inspect, error)
 	NetworkCreate(ctx context.Context, name string, options network.CreateOptions) (network.CreateResponse, error)
 	NetworkRemove(ctx context.Context, networkID string) error
+	Events(ctx context.Context, options events.ListOptions) (<-chan events.Message, <-chan error)
+	ContainersPrune(ctx context.Context, pruneFilters filters.Args) (container.PruneReport, error)
+	ImagesPrune(ctx context.Context, pruneFilters filters.Args) (image.PruneReport, error)
+	VolumesPrune(ctx context.Context, pruneFilters filters.Args) (volume.PruneReport, error)
+	NetworksPrune(ctx context.Context, pruneFilters filters.Args) (network.PruneReport, error)
+	BuildCachePrune(ctx context.Context, options build.CachePruneOptions) (*build.CachePruneReport, error)
+	DiskUsage(ctx context.Context, options types.DiskUsageOptions) (types.DiskUsage, error)
+	Ping(ctx context.Context) (types.Ping, error)
+	// ClientVersion is the API version in use, negotiated with the daemon on the first request.
+	ClientVersion() string
+	Close() error
 }
 
 // clientWrapper wraps the real docker client
@@ -50,6 +84,12 @@ func NewClientFromEnv() (DockerAPI, error) {
 func (w *clientWrapper) ContainerList(ctx context.Context, options container.ListOptions) ([]types.Container, error) {
 	return w.cli.ContainerList(ctx, options)
 }
+func (w *clientWrapper) ContainerInspect(ctx context.Context, containerID string) (container.InspectResponse, error) {
+	return w.cli.ContainerInspect(ctx, containerID)
+}
+func (w *clientWrapper) ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *ocispec.Platform, containerName string) (container.CreateResponse, error) {
+	return w.cli.ContainerCreate(ctx, config, hostConfig, networkingConfig, platform, containerName)
+}
 func (w *clientWrapper) ContainerStart(ctx context.Context, containerID string, options container.StartOptions) error {
 	return w.cli.ContainerStart(ctx, containerID, options)
 }
@@ -65,9 +105,39 @@ func (w *clientWrapper) ContainerRestart(ctx context.Context, containerID string
 func (w *clientWrapper) ContainerLogs(ctx context.Context, containerID string, options container.LogsOptions) (io.ReadCloser, error) {
 	return w.cli.ContainerLogs(ctx, containerID, options)
 }
+func (w *clientWrapper) ContainerStats(ctx context.Context, containerID string, stream bool) (container.StatsResponseReader, error) {
+	return w.cli.ContainerStats(ctx, containerID, stream)
+}
+func (w *clientWrapper) ContainerExecCreate(ctx context.Context, containerID string, options container.ExecOptions) (container.ExecCreateResponse, error) {
+	return w.cli.ContainerExecCreate(ctx, containerID, options)
+}
+func (w *clientWrapper) ContainerExecAttach(ctx context.Context, execID string, options container.ExecAttachOptions) (types.HijackedResponse, error) {
+	return w.cli.ContainerExecAttach(ctx, execID, options)
+}
+func (w *clientWrapper) ContainerExecResize(ctx context.Context, execID string, options container.ResizeOptions) error {
+	return w.cli.ContainerExecResize(ctx, execID, options)
+}
+func (w *clientWrapper) ContainerExecInspect(ctx context.Context, execID string) (container.ExecInspect, error) {
+	return w.cli.ContainerExecInspect(ctx, execID)
+}
+func (w *clientWrapper) ContainerWait(ctx context.Context, containerID string, condition container.WaitCondition) (<-chan container.WaitResponse, <-chan error) {
+	return w.cli.ContainerWait(ctx, containerID, condition)
+}
+func (w *clientWrapper) CopyFromContainer(ctx context.Context, containerID, srcPath string) (io.ReadCloser, container.PathStat, error) {
+	return w.cli.CopyFromContainer(ctx, containerID, srcPath)
+}
+func (w *clientWrapper) CopyToContainer(ctx context.Context, containerID, dstPath string, content io.Reader, options container.CopyToContainerOptions) error {
+	return w.cli.CopyToContainer(ctx, containerID, dstPath, content, options)
+}
 func (w *clientWrapper) ImageList(ctx context.Context, options image.ListOptions) ([]image.Summary, error) {
 	return w.cli.ImageList(ctx, options)
 }
+func (w *clientWrapper) ImageInspect(ctx context.Context, imageID string) (image.InspectResponse, error) {
+	return w.cli.ImageInspect(ctx, imageID)
+}
+func (w *clientWrapper) ImageHistory(ctx context.Context, imageID string) ([]image.HistoryResponseItem, error) {
+	return w.cli.ImageHistory(ctx, imageID)
+}
 func (w *clientWrapper) ImagePull(ctx context.Context, ref string, options image.PullOptions) (io.ReadCloser, error) {
 	return w.cli.ImagePull(ctx, ref, options)
 }
@@ -77,9 +147,27 @@ func (w *clientWrapper) ImageBuild(ctx context.Context, buildContext io.Reader,
 func (w *clientWrapper) ImageRemove(ctx context.Context, imageID string, options image.RemoveOptions) ([]image.DeleteResponse, error) {
 	return w.cli.ImageRemove(ctx, imageID, options)
 }
+func (w *clientWrapper) ImageTag(ctx context.Context, source, target string) error {
+	return w.cli.ImageTag(ctx, source, target)
+}
+func (w *clientWrapper) ImagePush(ctx context.Context, ref string, options image.PushOptions) (io.ReadCloser, error) {
+	return w.cli.ImagePush(ctx, ref, options)
+}
+func (w *clientWrapper) ImageSave(ctx context.Context, imageIDs []string) (io.ReadCloser, error) {
+	return w.cli.ImageSave(ctx, imageIDs)
+}
+func (w *clientWrapper) ImageLoad(ctx context.Context, input io.Reader) (image.LoadResponse, error) {
+	return w.cli.ImageLoad(ctx, input)
+}
+func (w *clientWrapper) RegistryLogin(ctx context.Context, auth registry.AuthConfig) (registry.AuthenticateOKBody, error) {
+	return w.cli.RegistryLogin(ctx, auth)
+}
 func (w *clientWrapper) VolumeList(ctx context.Context, options volume.ListOptions) (volume.ListResponse, error) {
 	return w.cli.VolumeList(ctx, options)
 }
+func (w *clientWrapper) VolumeInspect(ctx context.Context, volumeID string) (volume.Volume, error) {
+	return w.cli.VolumeInspect(ctx, volumeID)
+}
 func (w *clientWrapper) VolumeCreate(ctx context.Context, options volume.CreateOptions) (volume.Volume, error) {
 	return w.cli.VolumeCreate(ctx, options)
 }
@@ -89,9 +177,42 @@ func (w *clientWrapper) VolumeRemove(ctx context.Context, volumeID string, force
 func (w *clientWrapper) NetworkList(ctx context.Context, options network.ListOptions) ([]network.Summary, error) {
 	return w.cli.NetworkList(ctx, options)
 }
+func (w *clientWrapper) NetworkInspect(ctx context.Context, networkID string, options network.InspectOptions) (network.Inspect, error) {
+	return w.cli.NetworkInspect(ctx, networkID, options)
+}
 func (w *clientWrapper) NetworkCreate(ctx context.Context, name string, options network.CreateOptions) (network.CreateResponse, error) {
 	return w.cli.NetworkCreate(ctx, name, options)
 }
 func (w *clientWrapper) NetworkRemove(ctx context.Context, networkID string) error {
 	return w.cli.NetworkRemove(ctx, networkID)
 }
+func (w *clientWrapper) Events(ctx context.Context, options events.ListOptions) (<-chan events.Message, <-chan error) {
+	return w.cli.Events(ctx, options)
+}
+func (w *clientWrapper) ContainersPrune(ctx context.Context, pruneFilters filters.Args) (container.PruneReport, error) {
+	return w.cli.ContainersPrune(ctx, pruneFilters)
+}
+func (w *clientWrapper) ImagesPrune(ctx context.Context, pruneFilters filters.Args) (image.PruneReport, error) {
+	return w.cli.ImagesPrune(ctx, pruneFilters)
+}
+func (w *clientWrapper) VolumesPrune(ctx context.Context, pruneFilters filters.Args) (volume.PruneReport, error) {
+	return w.cli.VolumesPrune(ctx, pruneFilters)
+}
+func (w *clientWrapper) NetworksPrune(ctx context.Context, pruneFilters filters.Args) (network.PruneReport, error) {
+	return w.cli.NetworksPrune(ctx, pruneFilters)
+}
+func (w *clientWrapper) BuildCachePrune(ctx context.Context, options build.CachePruneOptions) (*build.CachePruneReport, error) {
+	return w.cli.BuildCachePrune(ctx, options)
+}
+func (w *clientWrapper) DiskUsage(ctx context.Context, options types.DiskUsageOptions) (types.DiskUsage, error) {
+	return w.cli.DiskUsage(ctx, options)
+}
+func (w *clientWrapper) ClientVersion() string {
+	return w.cli.ClientVersion()
+}
+func (w *clientWrapper) Ping(ctx context.Context) (types.Ping, error) {
+	return w.cli.Ping(ctx)
+}
+func (w *clientWrapper) Close() error {
+	return w.cli.Close()
+}
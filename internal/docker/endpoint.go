@@ -0,0 +1,113 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+
+	"github.com/docker/docker/client"
+)
+
+// Endpoint describes how to reach a Docker daemon.
+type Endpoint struct {
+	Name string `json:"name"`
+	// Host is unix:///path/to/docker.sock, tcp://host:port or ssh://[user@]host[:port].
+	// Hosts served by an agent use agent://<name>.
+	Host string `json:"host"`
+	// TLS files for tcp endpoints. Leave them empty for plain TCP.
+	TLSCACert string `json:"tlsCaCert,omitempty"`
+	TLSCert   string `json:"tlsCert,omitempty"`
+	TLSKey    string `json:"tlsKey,omitempty"`
+}
+
+var hostNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,62}$`)
+
+// Validate checks the name and host URL without contacting the daemon.
+func (e Endpoint) Validate() error {
+	if !hostNamePattern.MatchString(e.Name) {
+		return fmt.Errorf("invalid host name %q: use letters, digits, '.', '_' or '-'", e.Name)
+	}
+	u, err := url.Parse(e.Host)
+	if err != nil {
+		return fmt.Errorf("invalid host URL %q: %w", e.Host, err)
+	}
+	tls := e.TLSCACert != "" || e.TLSCert != "" || e.TLSKey != ""
+	switch u.Scheme {
+	case "unix":
+		if u.Path == "" {
+			return fmt.Errorf("unix host %q has no socket path", e.Host)
+		}
+	case "tcp":
+		if u.Host == "" {
+			return fmt.Errorf("tcp host %q has no address", e.Host)
+		}
+	case "ssh":
+		if u.Hostname() == "" {
+			return fmt.Errorf("ssh host %q has no address", e.Host)
+		}
+	case "agent":
+		if u.Host != e.Name {
+			return fmt.Errorf("agent host must be agent://%s", e.Name)
+		}
+	default:
+		return fmt.Errorf("unsupported host scheme %q: use unix, tcp or ssh", u.Scheme)
+	}
+	if tls && u.Scheme != "tcp" {
+		return fmt.Errorf("TLS files only apply to tcp hosts")
+	}
+	if (e.TLSCert == "") != (e.TLSKey == "") {
+		return fmt.Errorf("tlsCert and tlsKey must be given together")
+	}
+	return nil
+}
+
+// EnvEndpoint describes the daemon NewClientFromEnv connects to.
+func EnvEndpoint(name string) Endpoint {
+	host := os.Getenv(client.EnvOverrideHost)
+	if host == "" {
+		host = client.DefaultDockerHost
+	}
+	return Endpoint{Name: name, Host: host}
+}
+
+// NewClient creates a client for the endpoint. No connection is made until the first request.
+func NewClient(e Endpoint) (DockerAPI, error) {
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+	u, _ := url.Parse(e.Host)
+	switch u.Scheme {
+	case "ssh":
+		return NewDialerClient(sshDialer(u))
+	case "agent":
+		// the client is created when the agent connects
+		return nil, ErrAgentNotConnected
+	}
+	opts := []client.Opt{client.WithAPIVersionNegotiation(), client.WithHost(e.Host)}
+	if e.TLSCACert != "" || e.TLSCert != "" {
+		opts = append(opts, client.WithTLSClientConfig(e.TLSCACert, e.TLSCert, e.TLSKey))
+	}
+	c, err := client.NewClientWithOpts(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &clientWrapper{cli: c}, nil
+}
+
+// NewDialerClient creates a client whose connections come from dial, such as ssh sessions
+// or agent tunnel streams.
+func NewDialerClient(dial func(ctx context.Context) (net.Conn, error)) (DockerAPI, error) {
+	c, err := client.NewClientWithOpts(
+		client.WithAPIVersionNegotiation(),
+		// the address is never dialled, it only fills in the request URLs
+		client.WithHost("http://docker.example.com"),
+		client.WithDialContext(func(ctx context.Context, _, _ string) (net.Conn, error) { return dial(ctx) }),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &clientWrapper{cli: c}, nil
+}
@@ -0,0 +1,461 @@
+package docker
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Nebula-work/docker-web/internal/utils"
+)
+
+var (
+	ErrHostNotFound = errors.New("host not found")
+	ErrHostExists   = errors.New("host already exists")
+	// ErrHostFixed is returned when removing a host that was not added through the registry,
+	// such as the default local daemon.
+	ErrHostFixed = errors.New("host cannot be removed")
+
+	ErrAgentNotConnected = errors.New("agent not connected")
+	ErrAgentAuth         = errors.New("invalid agent name or token")
+)
+
+const (
+	HealthUnknown   = "unknown"
+	HealthHealthy   = "healthy"
+	HealthUnhealthy = "unhealthy"
+)
+
+// healthTimeout bounds a single health check ping.
+const healthTimeout = 5 * time.Second
+
+// Health is the result of the last health check of a host.
+type Health struct {
+	State      string    `json:"state"`
+	Error      string    `json:"error,omitempty"`
+	CheckedAt  time.Time `json:"checkedAt"`
+	LatencyMs  int64     `json:"latencyMs"`
+	APIVersion string    `json:"apiVersion,omitempty"`
+	OSType     string    `json:"osType,omitempty"`
+}
+
+// HostInfo describes a registered host.
+type HostInfo struct {
+	Endpoint
+	Default bool   `json:"default"`
+	Fixed   bool   `json:"fixed"`
+	Health  Health `json:"health"`
+}
+
+type host struct {
+	ep     Endpoint
+	cli    DockerAPI
+	err    error // why cli could not be created
+	fixed  bool
+	health Health
+
+	// agent hosts only
+	tokenHash  string
+	disconnect func()
+}
+
+// savedHost is a host as stored in the registry file.
+type savedHost struct {
+	Endpoint
+	AgentTokenHash string `json:"agentTokenHash,omitempty"`
+}
+
+// Registry holds the named Docker hosts the server manages. Hosts added with Add are saved
+// to the registry file; hosts attached with Attach exist only for the life of the process.
+type Registry struct {
+	mu          sync.RWMutex
+	path        string
+	defaultHost string
+	hosts       map[string]*host
+}
+
+// NewRegistry loads the hosts saved in path, if it exists. An empty path keeps nothing on disk.
+// A saved host whose client cannot be created is kept and reported as unhealthy.
+func NewRegistry(path string) (*Registry, error) {
+	r := &Registry{path: path, hosts: map[string]*host{}}
+	if path == "" {
+		return r, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var saved []savedHost
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	for _, s := range saved {
+		ep := s.Endpoint
+		if _, ok := r.hosts[ep.Name]; ok {
+			return nil, fmt.Errorf("%s: duplicate host %q", path, ep.Name)
+		}
+		h := &host{ep: ep, tokenHash: s.AgentTokenHash, health: Health{State: HealthUnknown}}
+		h.cli, h.err = NewClient(ep)
+		if h.err != nil {
+			h.health = Health{State: HealthUnhealthy, Error: h.err.Error()}
+		}
+		r.hosts[ep.Name] = h
+	}
+	return r, nil
+}
+
+// Attach registers an existing client under ep.Name without saving it. The first attached
+// host becomes the default unless SetDefault says otherwise.
+func (r *Registry) Attach(ep Endpoint, cli DockerAPI) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.hosts[ep.Name]; ok {
+		return ErrHostExists
+	}
+	r.hosts[ep.Name] = &host{ep: ep, cli: cli, fixed: true, health: Health{State: HealthUnknown}}
+	if r.defaultHost == "" {
+		r.defaultHost = ep.Name
+	}
+	return nil
+}
+
+// Detach removes an attached host and closes its client.
+func (r *Registry) Detach(name string) {
+	r.mu.Lock()
+	h, ok := r.hosts[name]
+	if ok && h.fixed {
+		delete(r.hosts, name)
+	}
+	r.mu.Unlock()
+	if ok && h.fixed && h.cli != nil {
+		h.cli.Close()
+	}
+}
+
+// SetDefault selects the host used by routes that do not name one.
+func (r *Registry) SetDefault(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.hosts[name]; !ok {
+		return ErrHostNotFound
+	}
+	r.defaultHost = name
+	return nil
+}
+
+// Default returns the name of the default host.
+func (r *Registry) Default() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.defaultHost
+}
+
+// Add validates ep, creates its client and saves it to the registry file.
+// Agent hosts are added with AddAgent instead.
+func (r *Registry) Add(ep Endpoint) (HostInfo, error) {
+	cli, err := NewClient(ep)
+	if errors.Is(err, ErrAgentNotConnected) {
+		return HostInfo{}, errors.New("agent hosts are added with AddAgent")
+	}
+	if err != nil {
+		return HostInfo{}, err
+	}
+	if err := r.insert(&host{ep: ep, cli: cli, health: Health{State: HealthUnknown}}); err != nil {
+		cli.Close()
+		return HostInfo{}, err
+	}
+	return r.Check(context.Background(), ep.Name)
+}
+
+// AddAgent saves an agent host named name and returns the token its agent must present.
+// Only a hash of the token is kept.
+func (r *Registry) AddAgent(name string) (HostInfo, string, error) {
+	ep := Endpoint{Name: name, Host: "agent://" + name}
+	if err := ep.Validate(); err != nil {
+		return HostInfo{}, "", err
+	}
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	token := base64.RawURLEncoding.EncodeToString(b)
+	h := &host{
+		ep:        ep,
+		err:       ErrAgentNotConnected,
+		tokenHash: hashToken(token),
+		health:    Health{State: HealthUnhealthy, Error: ErrAgentNotConnected.Error()},
+	}
+	if err := r.insert(h); err != nil {
+		return HostInfo{}, "", err
+	}
+	return r.snapshot(h), token, nil
+}
+
+// insert adds and saves a new host.
+func (r *Registry) insert(h *host) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.hosts[h.ep.Name]; ok {
+		return ErrHostExists
+	}
+	r.hosts[h.ep.Name] = h
+	if r.defaultHost == "" {
+		r.defaultHost = h.ep.Name
+	}
+	if err := r.save(); err != nil {
+		delete(r.hosts, h.ep.Name)
+		if r.defaultHost == h.ep.Name {
+			r.defaultHost = ""
+		}
+		return err
+	}
+	return nil
+}
+
+// VerifyAgent checks an agent's credentials.
+func (r *Registry) VerifyAgent(name, token string) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if _, ok := r.agentHost(name, token); !ok {
+		return ErrAgentAuth
+	}
+	return nil
+}
+
+// agentHost returns the agent host name if token is its token. Callers hold r.mu.
+func (r *Registry) agentHost(name, token string) (*host, bool) {
+	h, ok := r.hosts[name]
+	if !ok || h.tokenHash == "" || subtle.ConstantTimeCompare([]byte(hashToken(token)), []byte(h.tokenHash)) != 1 {
+		return nil, false
+	}
+	return h, true
+}
+
+// ConnectAgent makes cli the client of an agent host once its credentials check out.
+// disconnect ends the agent's session; it is called when another session for the same
+// host connects or the host is removed.
+func (r *Registry) ConnectAgent(name, token string, cli DockerAPI, disconnect func()) error {
+	r.mu.Lock()
+	h, ok := r.agentHost(name, token)
+	if !ok {
+		r.mu.Unlock()
+		return ErrAgentAuth
+	}
+	previous := h.disconnect
+	h.cli, h.err, h.disconnect = cli, nil, disconnect
+	r.mu.Unlock()
+	if previous != nil {
+		previous()
+	}
+	go r.Check(context.Background(), name)
+	return nil
+}
+
+// DisconnectAgent marks an agent host offline if cli is still its current client.
+func (r *Registry) DisconnectAgent(name string, cli DockerAPI) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	h, ok := r.hosts[name]
+	if !ok || h.cli != cli {
+		return
+	}
+	h.cli, h.err, h.disconnect = nil, ErrAgentNotConnected, nil
+	h.health = Health{State: HealthUnhealthy, Error: ErrAgentNotConnected.Error(), CheckedAt: time.Now().UTC()}
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Remove deletes a host added with Add and closes its client.
+func (r *Registry) Remove(name string) error {
+	r.mu.Lock()
+	h, ok := r.hosts[name]
+	switch {
+	case !ok:
+		r.mu.Unlock()
+		return ErrHostNotFound
+	case h.fixed:
+		r.mu.Unlock()
+		return ErrHostFixed
+	}
+	delete(r.hosts, name)
+	if err := r.save(); err != nil {
+		r.hosts[name] = h
+		r.mu.Unlock()
+		return err
+	}
+	if r.defaultHost == name {
+		r.defaultHost = ""
+	}
+	r.mu.Unlock()
+	if h.disconnect != nil {
+		h.disconnect()
+	}
+	if h.cli != nil {
+		h.cli.Close()
+	}
+	return nil
+}
+
+// Client returns the client for name, or for the default host when name is empty.
+func (r *Registry) Client(name string) (DockerAPI, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if name == "" {
+		name = r.defaultHost
+	}
+	h, ok := r.hosts[name]
+	if !ok {
+		return nil, ErrHostNotFound
+	}
+	if h.cli == nil {
+		return nil, fmt.Errorf("host %s is unavailable: %w", name, h.err)
+	}
+	return h.cli, nil
+}
+
+func (r *Registry) Get(name string) (HostInfo, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	h, ok := r.hosts[name]
+	if !ok {
+		return HostInfo{}, ErrHostNotFound
+	}
+	return r.info(h), nil
+}
+
+// snapshot is info for callers that do not hold r.mu.
+func (r *Registry) snapshot(h *host) HostInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.info(h)
+}
+
+// List returns every host sorted by name.
+func (r *Registry) List() []HostInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]HostInfo, 0, len(r.hosts))
+	for _, h := range r.hosts {
+		out = append(out, r.info(h))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+func (r *Registry) info(h *host) HostInfo {
+	return HostInfo{Endpoint: h.ep, Default: h.ep.Name == r.defaultHost, Fixed: h.fixed, Health: h.health}
+}
+
+// Check pings a host now and records the result.
+func (r *Registry) Check(ctx context.Context, name string) (HostInfo, error) {
+	r.mu.RLock()
+	h, ok := r.hosts[name]
+	var cli DockerAPI
+	var cliErr error
+	if ok {
+		cli, cliErr = h.cli, h.err
+	}
+	r.mu.RUnlock()
+	if !ok {
+		return HostInfo{}, ErrHostNotFound
+	}
+	health := Health{State: HealthUnhealthy, CheckedAt: time.Now().UTC()}
+	if cli == nil {
+		health.Error = cliErr.Error()
+	} else {
+		ctx, cancel := context.WithTimeout(ctx, healthTimeout)
+		start := time.Now()
+		ping, err := cli.Ping(ctx)
+		cancel()
+		health.LatencyMs = time.Since(start).Milliseconds()
+		if err != nil {
+			health.Error = err.Error()
+		} else {
+			health.State = HealthHealthy
+			health.APIVersion = ping.APIVersion
+			health.OSType = ping.OSType
+		}
+	}
+	r.mu.Lock()
+	if h.cli == cli {
+		// skip results for a client replaced while the check ran
+		h.health = health
+	}
+	info := r.info(h)
+	r.mu.Unlock()
+	return info, nil
+}
+
+// CheckAll pings every host concurrently.
+func (r *Registry) CheckAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, h := range r.List() {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			_, _ = r.Check(ctx, name)
+		}(h.Name)
+	}
+	wg.Wait()
+}
+
+// Watch runs CheckAll every interval until ctx is done.
+func (r *Registry) Watch(ctx context.Context, interval time.Duration) {
+	r.CheckAll(ctx)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			r.CheckAll(ctx)
+		}
+	}
+}
+
+// Close closes every client.
+func (r *Registry) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, h := range r.hosts {
+		if h.disconnect != nil {
+			h.disconnect()
+		}
+		if h.cli != nil {
+			h.cli.Close()
+		}
+	}
+}
+
+// save writes the hosts added with Add. Callers hold r.mu.
+func (r *Registry) save() error {
+	if r.path == "" {
+		return nil
+	}
+	saved := []savedHost{}
+	for _, h := range r.hosts {
+		if !h.fixed {
+			saved = append(saved, savedHost{Endpoint: h.ep, AgentTokenHash: h.tokenHash})
+		}
+	}
+	sort.Slice(saved, func(i, j int) bool { return saved[i].Name < saved[j].Name })
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(r.path, data, 0600)
+}
@@ -0,0 +1,119 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sshDialer connects to a remote daemon by running `docker system dial-stdio` over ssh,
+// as the docker CLI does for ssh:// hosts. Authentication uses the server's ssh config
+// and agent; password prompts are disabled.
+func sshDialer(u *url.URL) func(ctx context.Context) (net.Conn, error) {
+	args := []string{"-o", "BatchMode=yes", "-o", "ConnectTimeout=10"}
+	if u.User != nil && u.User.Username() != "" {
+		args = append(args, "-l", u.User.Username())
+	}
+	if port := u.Port(); port != "" {
+		args = append(args, "-p", port)
+	}
+	args = append(args, "--", u.Hostname(), "docker", "system", "dial-stdio")
+
+	return func(ctx context.Context) (net.Conn, error) {
+		// not CommandContext: ctx only bounds the dial, the connection outlives it
+		cmd := exec.Command("ssh", args...)
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return nil, err
+		}
+		stdout, w := io.Pipe()
+		stderr := &limitedBuffer{max: 4096}
+		cmd.Stdout = w
+		cmd.Stderr = stderr
+		if err := cmd.Start(); err != nil {
+			return nil, fmt.Errorf("ssh: %w", err)
+		}
+		go func() {
+			err := cmd.Wait()
+			if err != nil {
+				if msg := strings.TrimSpace(stderr.String()); msg != "" {
+					err = errors.New(msg)
+				}
+			}
+			// readers see EOF on a clean exit, or why ssh failed
+			w.CloseWithError(err)
+		}()
+		return &commandConn{cmd: cmd, stdin: stdin, stdout: stdout}, nil
+	}
+}
+
+// commandConn is a net.Conn over the stdin and stdout of a running command.
+type commandConn struct {
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	stdout    *io.PipeReader
+	closeOnce sync.Once
+}
+
+func (c *commandConn) Read(p []byte) (int, error) {
+	return c.stdout.Read(p)
+}
+
+func (c *commandConn) Write(p []byte) (int, error) {
+	return c.stdin.Write(p)
+}
+
+// CloseWrite half-closes the connection, which hijacked exec sessions rely on.
+func (c *commandConn) CloseWrite() error {
+	return c.stdin.Close()
+}
+
+func (c *commandConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.stdin.Close()
+		c.stdout.Close()
+		_ = c.cmd.Process.Kill()
+	})
+	return nil
+}
+
+func (c *commandConn) LocalAddr() net.Addr              { return dummyAddr{} }
+func (c *commandConn) RemoteAddr() net.Addr             { return dummyAddr{} }
+func (c *commandConn) SetDeadline(time.Time) error      { return nil }
+func (c *commandConn) SetReadDeadline(time.Time) error  { return nil }
+func (c *commandConn) SetWriteDeadline(time.Time) error { return nil }
+
+type dummyAddr struct{}
+
+func (dummyAddr) Network() string { return "ssh" }
+func (dummyAddr) String() string  { return "ssh" }
+
+// limitedBuffer keeps the first max bytes written to it.
+type limitedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+	max int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if room := b.max - b.buf.Len(); room > 0 {
+		b.buf.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,76 @@
+package docker
+
+import (
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// Stats is a single computed resource sample for a container, in the units the UI displays.
+type Stats struct {
+	ID            string    `json:"id"`
+	Name          string    `json:"name"`
+	Read          time.Time `json:"read"`
+	CPUPercent    float64   `json:"cpuPercent"`
+	OnlineCPUs    uint32    `json:"onlineCpus"`
+	MemoryUsage   uint64    `json:"memoryUsage"`
+	MemoryLimit   uint64    `json:"memoryLimit"`
+	MemoryPercent float64   `json:"memoryPercent"`
+	NetworkRx     uint64    `json:"networkRx"`
+	NetworkTx     uint64    `json:"networkTx"`
+	BlockRead     uint64    `json:"blockRead"`
+	BlockWrite    uint64    `json:"blockWrite"`
+	PIDs          uint64    `json:"pids"`
+}
+
+// ComputeStats derives percentages and totals from a raw stats sample using the
+// same formulas as `docker stats`.
+func ComputeStats(s *container.StatsResponse) Stats {
+	out := Stats{
+		ID:          s.ID,
+		Name:        strings.TrimPrefix(s.Name, "/"),
+		Read:        s.Read,
+		MemoryLimit: s.MemoryStats.Limit,
+		PIDs:        s.PidsStats.Current,
+	}
+
+	online := s.CPUStats.OnlineCPUs
+	if online == 0 {
+		online = uint32(len(s.CPUStats.CPUUsage.PercpuUsage))
+	}
+	out.OnlineCPUs = online
+	cpuDelta := float64(s.CPUStats.CPUUsage.TotalUsage) - float64(s.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(s.CPUStats.SystemUsage) - float64(s.PreCPUStats.SystemUsage)
+	if cpuDelta > 0 && systemDelta > 0 {
+		out.CPUPercent = cpuDelta / systemDelta * float64(online) * 100
+	}
+
+	// page cache is reclaimable, so it is not counted as used memory;
+	// cgroup v1 reports it as total_inactive_file and cgroup v2 as inactive_file
+	out.MemoryUsage = s.MemoryStats.Usage
+	cache := s.MemoryStats.Stats["total_inactive_file"]
+	if v, ok := s.MemoryStats.Stats["inactive_file"]; ok {
+		cache = v
+	}
+	if cache < out.MemoryUsage {
+		out.MemoryUsage -= cache
+	}
+	if out.MemoryLimit > 0 {
+		out.MemoryPercent = float64(out.MemoryUsage) / float64(out.MemoryLimit) * 100
+	}
+
+	for _, n := range s.Networks {
+		out.NetworkRx += n.RxBytes
+		out.NetworkTx += n.TxBytes
+	}
+	for _, e := range s.BlkioStats.IoServiceBytesRecursive {
+		switch strings.ToLower(e.Op) {
+		case "read":
+			out.BlockRead += e.Value
+		case "write":
+			out.BlockWrite += e.Value
+		}
+	}
+	return out
+}
@@ -0,0 +1,274 @@
+// Package imagefs reconstructs an image's filesystem layer by layer from a `docker save`
+// archive, so it can be browsed like dive: which layer added, modified or deleted each
+// path, and how much space is wasted on files that later layers overwrite.
+package imagefs
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+const (
+	// maxBlobSize bounds the non-layer files (manifests, configs) kept from the archive.
+	maxBlobSize = 4 << 20
+	// maxEntries bounds the number of layer entries held in memory for one image.
+	maxEntries = 2_000_000
+	// maxLinkDepth bounds how many archive symlinks are followed to find a layer.
+	maxLinkDepth = 8
+)
+
+var ErrTooLarge = fmt.Errorf("image has more than %d filesystem entries", maxEntries)
+
+// Kind is the type of a filesystem entry.
+type Kind string
+
+const (
+	KindFile     Kind = "file"
+	KindDir      Kind = "dir"
+	KindSymlink  Kind = "symlink"
+	KindHardlink Kind = "hardlink"
+	KindOther    Kind = "other"
+	KindDeleted  Kind = "deleted"
+)
+
+// entry is one record of a layer tar. Whiteouts carry KindDeleted; an opaque marker is a
+// KindDeleted entry with opaque set on the directory it hides.
+type entry struct {
+	path   string
+	kind   Kind
+	size   int64
+	mode   uint32
+	link   string
+	opaque bool
+}
+
+// saveManifest is one element of manifest.json. Both the legacy layout ("<id>/layer.tar")
+// and the OCI layout written by Docker 25+ ("blobs/sha256/<hex>") are referenced from it.
+type saveManifest struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+type imageConfig struct {
+	History []struct {
+		CreatedBy  string `json:"created_by"`
+		EmptyLayer bool   `json:"empty_layer"`
+	} `json:"history"`
+	RootFS struct {
+		DiffIDs []string `json:"diff_ids"`
+	} `json:"rootfs"`
+}
+
+// archive collects what Analyze needs from a save stream, whose files come in no fixed order.
+type archive struct {
+	layers  map[string][]entry
+	blobs   map[string][]byte
+	links   map[string]string
+	skipped map[string]string // path -> reason it could not be read as a layer
+	entries int
+}
+
+// Analyze reads a `docker save` archive holding a single image and builds its layered
+// filesystem. Layers may be plain or gzip-compressed tars.
+func Analyze(r io.Reader) (*Image, error) {
+	a := &archive{
+		layers:  map[string][]entry{},
+		blobs:   map[string][]byte{},
+		links:   map[string]string{},
+		skipped: map[string]string{},
+	}
+	if err := a.read(r); err != nil {
+		return nil, err
+	}
+	raw, ok := a.blobs["manifest.json"]
+	if !ok {
+		return nil, errors.New("not an image archive: manifest.json missing")
+	}
+	var manifests []saveManifest
+	if err := json.Unmarshal(raw, &manifests); err != nil {
+		return nil, fmt.Errorf("parse manifest.json: %w", err)
+	}
+	if len(manifests) == 0 {
+		return nil, errors.New("image archive holds no images")
+	}
+	m := manifests[0]
+	var cfg imageConfig
+	if data, ok := a.blobs[a.resolve(m.Config)]; ok {
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return nil, fmt.Errorf("parse image config: %w", err)
+		}
+	}
+
+	layers := make([][]entry, len(m.Layers))
+	for i, name := range m.Layers {
+		p := a.resolve(name)
+		if entries, ok := a.layers[p]; ok {
+			layers[i] = entries
+			continue
+		}
+		if data, ok := a.blobs[p]; ok && len(bytes.Trim(data, "\x00")) == 0 {
+			continue // an empty layer is just the two zero blocks that end a tar
+		}
+		if reason, ok := a.skipped[p]; ok {
+			return nil, fmt.Errorf("layer %s: %s", name, reason)
+		}
+		return nil, fmt.Errorf("layer %s missing from archive", name)
+	}
+	return build(imageID(m.Config), describeLayers(cfg, m.Layers), layers), nil
+}
+
+func (a *archive) read(r io.Reader) error {
+	tr := tar.NewReader(r)
+	br := bufio.NewReaderSize(nil, 64<<10)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read image archive: %w", err)
+		}
+		name := cleanPath(hdr.Name)
+		switch hdr.Typeflag {
+		case tar.TypeSymlink:
+			a.links[name] = path.Join(path.Dir(name), hdr.Linkname)
+			continue
+		case tar.TypeReg:
+		default:
+			continue
+		}
+
+		br.Reset(tr)
+		head, _ := br.Peek(512)
+		switch {
+		case len(head) >= 2 && head[0] == 0x1f && head[1] == 0x8b:
+			zr, err := gzip.NewReader(br)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			err = a.readLayer(name, zr)
+			zr.Close()
+			if err != nil {
+				return err
+			}
+		case len(head) >= 262 && string(head[257:262]) == "ustar":
+			if err := a.readLayer(name, br); err != nil {
+				return err
+			}
+		case len(head) >= 4 && bytes.Equal(head[:4], []byte{0x28, 0xb5, 0x2f, 0xfd}):
+			a.skipped[name] = "zstd-compressed layers are not supported"
+		case hdr.Size <= maxBlobSize:
+			data, err := io.ReadAll(br)
+			if err != nil {
+				return fmt.Errorf("read %s: %w", name, err)
+			}
+			a.blobs[name] = data
+		default:
+			a.skipped[name] = "not a tar archive"
+		}
+	}
+}
+
+func (a *archive) readLayer(name string, r io.Reader) error {
+	var entries []entry
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read layer %s: %w", name, err)
+		}
+		p := cleanPath(hdr.Name)
+		if p == "" {
+			continue
+		}
+		if a.entries++; a.entries > maxEntries {
+			return ErrTooLarge
+		}
+		dir, base := path.Split(p)
+		if strings.HasPrefix(base, ".wh.") {
+			if base == ".wh..wh..opq" {
+				entries = append(entries, entry{path: strings.TrimSuffix(dir, "/"), kind: KindDeleted, opaque: true})
+			} else if !strings.HasPrefix(base, ".wh..wh.") {
+				entries = append(entries, entry{path: dir + strings.TrimPrefix(base, ".wh."), kind: KindDeleted})
+			}
+			continue
+		}
+		e := entry{path: p, mode: uint32(hdr.Mode)}
+		switch hdr.Typeflag {
+		case tar.TypeReg:
+			e.kind, e.size = KindFile, hdr.Size
+		case tar.TypeDir:
+			e.kind = KindDir
+		case tar.TypeSymlink:
+			e.kind, e.link = KindSymlink, hdr.Linkname
+		case tar.TypeLink:
+			e.kind, e.link = KindHardlink, cleanPath(hdr.Linkname)
+		default:
+			e.kind = KindOther
+		}
+		entries = append(entries, e)
+	}
+	a.layers[name] = entries
+	return nil
+}
+
+// resolve follows archive symlinks, which Docker 25+ uses to point legacy layer paths at blobs.
+func (a *archive) resolve(name string) string {
+	name = cleanPath(name)
+	for range maxLinkDepth {
+		target, ok := a.links[name]
+		if !ok {
+			break
+		}
+		name = target
+	}
+	return name
+}
+
+// describeLayers pairs each filesystem layer with its diff ID and the history step that made it.
+func describeLayers(cfg imageConfig, names []string) []Layer {
+	var steps []string
+	for _, h := range cfg.History {
+		if !h.EmptyLayer {
+			steps = append(steps, h.CreatedBy)
+		}
+	}
+	layers := make([]Layer, len(names))
+	for i, name := range names {
+		layers[i] = Layer{Index: i, Digest: name}
+		if i < len(cfg.RootFS.DiffIDs) {
+			layers[i].Digest = cfg.RootFS.DiffIDs[i]
+		}
+		if i < len(steps) {
+			layers[i].CreatedBy = steps[i]
+		}
+	}
+	return layers
+}
+
+// imageID derives the image ID from the config's path in the archive.
+func imageID(config string) string {
+	name := path.Base(config)
+	name = strings.TrimSuffix(name, ".json")
+	if name == "" || name == "." {
+		return ""
+	}
+	return "sha256:" + name
+}
+
+// cleanPath turns a tar name such as "./usr/bin/" into "usr/bin"; the root becomes "".
+func cleanPath(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
@@ -0,0 +1,163 @@
+package imagefs
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// tarEntry is one record written by writeTar: a name ending in "/" is a directory, a
+// non-empty link makes a symlink and anything else is a file of size bytes.
+type tarEntry struct {
+	name string
+	size int
+	link string
+}
+
+func writeTar(t *testing.T, entries []tarEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0644, Typeflag: tar.TypeReg, Size: int64(e.size)}
+		switch {
+		case strings.HasSuffix(e.name, "/"):
+			hdr.Typeflag, hdr.Mode, hdr.Size = tar.TypeDir, 0755, 0
+		case e.link != "":
+			hdr.Typeflag, hdr.Linkname, hdr.Size = tar.TypeSymlink, e.link, 0
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Size > 0 {
+			if _, err := tw.Write(bytes.Repeat([]byte("x"), e.size)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func gzipped(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// saveArchive builds a legacy `docker save` archive with one image whose layers are the
+// given tar streams, each produced by a RUN step named after its index.
+func saveArchive(t *testing.T, layers ...[]byte) []byte {
+	t.Helper()
+	m := saveManifest{Config: "abc123.json", RepoTags: []string{"test:latest"}}
+	var cfg imageConfig
+	files := map[string][]byte{}
+	for i, data := range layers {
+		name := "layer" + strconv.Itoa(i) + "/layer.tar"
+		m.Layers = append(m.Layers, name)
+		files[name] = data
+		cfg.RootFS.DiffIDs = append(cfg.RootFS.DiffIDs, "sha256:diff"+strconv.Itoa(i))
+		cfg.History = append(cfg.History, struct {
+			CreatedBy  string `json:"created_by"`
+			EmptyLayer bool   `json:"empty_layer"`
+		}{CreatedBy: "RUN step " + strconv.Itoa(i)})
+	}
+	manifest, err := json.Marshal([]saveManifest{m})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	write := func(name string, data []byte) {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("manifest.json", manifest)
+	write("abc123.json", config)
+	for _, name := range m.Layers {
+		write(name, files[name])
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestAnalyzeLayers(t *testing.T) {
+	base := writeTar(t, []tarEntry{{name: "etc/"}, {name: "etc/hosts", size: 10}})
+	img, err := Analyze(bytes.NewReader(saveArchive(t, base, gzipped(t, writeTar(t, []tarEntry{{name: "etc/hosts", size: 12}})))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.ID != "sha256:abc123" {
+		t.Errorf("ID = %q, want sha256:abc123", img.ID)
+	}
+	if len(img.Layers) != 2 {
+		t.Fatalf("got %d layers, want 2", len(img.Layers))
+	}
+	for i, l := range img.Layers {
+		if l.Index != i || l.Digest != "sha256:diff"+strconv.Itoa(i) || l.CreatedBy != "RUN step "+strconv.Itoa(i) {
+			t.Errorf("layer %d = %+v", i, l)
+		}
+	}
+	if l := img.Layers[1]; l.Modified != 1 || l.Size != 12 {
+		t.Errorf("gzip layer = %+v, want one modified file of 12 bytes", l)
+	}
+}
+
+func TestAnalyzeErrors(t *testing.T) {
+	zstd := append([]byte{0x28, 0xb5, 0x2f, 0xfd}, make([]byte, 600)...)
+	tests := []struct {
+		name    string
+		archive []byte
+		want    string
+	}{
+		{"no manifest", writeTar(t, []tarEntry{{name: "layer.tar", size: 10}}), "manifest.json missing"},
+		{"zstd layer", saveArchive(t, zstd), "zstd-compressed layers are not supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Analyze(bytes.NewReader(tt.archive))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Analyze error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCleanPath(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"./usr/bin/", "usr/bin"},
+		{"/etc/hosts", "etc/hosts"},
+		{"./", ""},
+		{"../../etc/passwd", "etc/passwd"},
+		{"a/./b/../c", "a/c"},
+	}
+	for _, tt := range tests {
+		if got := cleanPath(tt.in); got != tt.want {
+			t.Errorf("cleanPath(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
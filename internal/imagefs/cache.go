@@ -0,0 +1,98 @@
+package imagefs
+
+import (
+	"sync"
+	"time"
+)
+
+// failureRetention is how long a failed analysis is remembered, so that an image that cannot
+// be analysed is not exported again on every request.
+const failureRetention = 10 * time.Minute
+
+// Cache keeps the most recently analysed images, since reading a whole image archive is too
+// slow to repeat for every directory listing.
+type Cache struct {
+	max int
+
+	mu      sync.Mutex
+	images  map[string]*Image
+	order   []string          // least recently used first
+	pending map[string]string // image ID -> ID of the job analysing it
+	failed  map[string]failure
+}
+
+// failure is an analysis that failed recently.
+type failure struct {
+	jobID string
+	at    time.Time
+}
+
+func NewCache(max int) *Cache {
+	return &Cache{max: max, images: map[string]*Image{}, pending: map[string]string{}, failed: map[string]failure{}}
+}
+
+// Get returns a cached analysis and marks it as recently used.
+func (c *Cache) Get(id string) (*Image, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	img, ok := c.images[id]
+	if ok {
+		c.touch(id)
+	}
+	return img, ok
+}
+
+// Pending returns the ID of the job analysing image id, or of the job whose analysis failed
+// within failureRetention. When running reports that there is none, start is called to
+// launch one; the cache lock is held meanwhile so concurrent requests share a single job.
+func (c *Cache) Pending(id string, running func(jobID string) bool, start func() string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if jobID, ok := c.pending[id]; ok && running(jobID) {
+		return jobID
+	}
+	if f, ok := c.failed[id]; ok {
+		if time.Since(f.at) < failureRetention {
+			return f.jobID
+		}
+		delete(c.failed, id)
+	}
+	jobID := start()
+	c.pending[id] = jobID
+	return jobID
+}
+
+// Finish stores the result of an analysis; a nil img only clears the pending job.
+func (c *Cache) Finish(id string, img *Image) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pending, id)
+	if img == nil {
+		return
+	}
+	c.images[id] = img
+	c.touch(id)
+	for len(c.order) > c.max {
+		delete(c.images, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+// Fail records that the analysis of image id by jobID failed.
+func (c *Cache) Fail(id, jobID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pending, id)
+	c.failed[id] = failure{jobID: jobID, at: time.Now()}
+}
+
+// touch moves id to the back of the LRU order; callers hold c.mu.
+func (c *Cache) touch(id string) {
+	for i, o := range c.order {
+		if o == id {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+	c.order = append(c.order, id)
+}
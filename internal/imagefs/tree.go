@@ -0,0 +1,373 @@
+package imagefs
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// maxWasted bounds the list of paths reported as wasting space.
+const maxWasted = 50
+
+var (
+	ErrNotFound = errors.New("path not found in layer")
+	ErrNotDir   = errors.New("not a directory")
+)
+
+// Change describes what a layer did to a path.
+type Change string
+
+const (
+	Added    Change = "added"
+	Modified Change = "modified"
+	Deleted  Change = "deleted"
+)
+
+// Image is the analysed filesystem of an image.
+type Image struct {
+	ID     string  `json:"id"`
+	Layers []Layer `json:"layers"`
+	// TotalSize is the size of every file in every layer, including overwritten copies.
+	TotalSize int64 `json:"totalSize"`
+	// WastedSize is the part of TotalSize taken by file versions a later layer overwrote or deleted.
+	WastedSize int64 `json:"wastedSize"`
+	// Efficiency is the share of TotalSize that is not wasted, from 0 to 1.
+	Efficiency float64      `json:"efficiency"`
+	Wasted     []WastedFile `json:"wasted"`
+
+	root *node
+}
+
+// Layer summarises one filesystem layer, base layer first. The counts cover files, links
+// and other non-directory entries.
+type Layer struct {
+	Index     int    `json:"index"`
+	Digest    string `json:"digest"`
+	CreatedBy string `json:"createdBy"`
+	Size      int64  `json:"size"`
+	Added     int    `json:"added"`
+	Modified  int    `json:"modified"`
+	Deleted   int    `json:"deleted"`
+}
+
+// WastedFile is a path whose content was written by one layer and replaced or removed by a
+// later one; Size counts every superseded copy.
+type WastedFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	Copies int    `json:"copies"`
+}
+
+// FileEntry is one path in a directory listing at a given layer.
+type FileEntry struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	Type Kind   `json:"type"`
+	// Size is the file size, or for a directory the total size of the files below it.
+	Size       int64  `json:"size"`
+	Mode       uint32 `json:"mode"`
+	LinkTarget string `json:"linkTarget,omitempty"`
+	// Change is what the listed layer did to this path; empty when it was left untouched.
+	Change Change `json:"change,omitempty"`
+	// Layer is the layer the path's current content comes from.
+	Layer int `json:"layer"`
+	// HasChanges is set on directories with a changed path somewhere below them.
+	HasChanges bool `json:"hasChanges"`
+}
+
+// version is the state one layer gave a path. Versions are kept in layer order.
+type version struct {
+	layer int
+	kind  Kind
+	size  int64
+	mode  uint32
+	link  string
+}
+
+type node struct {
+	name     string
+	children map[string]*node
+	versions []version
+}
+
+// at returns the index of the version in effect at layer, or -1 if the path did not exist yet.
+func (n *node) at(layer int) int {
+	for i := len(n.versions) - 1; i >= 0; i-- {
+		if n.versions[i].layer <= layer {
+			return i
+		}
+	}
+	return -1
+}
+
+// live reports whether the path exists at layer.
+func (n *node) live(layer int) bool {
+	i := n.at(layer)
+	return i >= 0 && n.versions[i].kind != KindDeleted
+}
+
+// change reports what layer did to the path.
+func (n *node) change(layer int) Change {
+	i := n.at(layer)
+	if i < 0 || n.versions[i].layer != layer {
+		return ""
+	}
+	switch {
+	case n.versions[i].kind == KindDeleted:
+		return Deleted
+	case i > 0 && n.versions[i-1].kind != KindDeleted:
+		return Modified
+	default:
+		return Added
+	}
+}
+
+func (n *node) child(name string) *node {
+	if n.children == nil {
+		n.children = map[string]*node{}
+	}
+	c, ok := n.children[name]
+	if !ok {
+		c = &node{name: name}
+		n.children[name] = c
+	}
+	return c
+}
+
+// set records v on the node, replacing an earlier version from the same layer.
+func (n *node) set(v version) {
+	if last := len(n.versions) - 1; last >= 0 && n.versions[last].layer == v.layer {
+		n.versions[last] = v
+		return
+	}
+	n.versions = append(n.versions, v)
+}
+
+// remove marks the node and everything below it that exists at layer as deleted.
+// Paths already written by layer itself are kept, since a layer's own entries win over
+// the whiteouts it carries.
+func (n *node) remove(layer int) {
+	if !n.live(layer) {
+		return
+	}
+	if n.versions[len(n.versions)-1].layer != layer {
+		n.set(version{layer: layer, kind: KindDeleted})
+	}
+	for _, c := range n.children {
+		c.remove(layer)
+	}
+}
+
+// build applies the layers in order to a single tree and gathers the statistics.
+func build(id string, layers []Layer, entries [][]entry) *Image {
+	img := &Image{ID: id, Layers: layers, Wasted: []WastedFile{}, root: &node{}}
+	img.root.versions = []version{{layer: 0, kind: KindDir, mode: 0o755}}
+
+	for layer, list := range entries {
+		// whiteouts only hide what lower layers wrote, so they go first
+		for _, e := range list {
+			if e.kind != KindDeleted {
+				continue
+			}
+			n := img.root.lookup(e.path)
+			if n == nil {
+				continue
+			}
+			if e.opaque {
+				for _, c := range n.children {
+					c.remove(layer)
+				}
+			} else if n != img.root {
+				n.remove(layer)
+			}
+		}
+		for _, e := range list {
+			if e.kind == KindDeleted {
+				continue
+			}
+			n := img.root
+			parts := strings.Split(e.path, "/")
+			for _, part := range parts[:len(parts)-1] {
+				n = n.child(part)
+				if i := n.at(layer); i < 0 || n.versions[i].kind != KindDir {
+					n.replace(layer, version{layer: layer, kind: KindDir, mode: 0o755})
+				}
+			}
+			n.child(parts[len(parts)-1]).replace(layer, version{layer: layer, kind: e.kind, size: e.size, mode: e.mode, link: e.link})
+		}
+	}
+
+	img.stats()
+	return img
+}
+
+// replace sets a new version; when a directory turns into something else its contents go too.
+func (n *node) replace(layer int, v version) {
+	if v.kind != KindDir {
+		if i := n.at(layer); i >= 0 && n.versions[i].kind == KindDir {
+			for _, c := range n.children {
+				c.remove(layer)
+			}
+		}
+	}
+	n.set(v)
+}
+
+func (img *Image) stats() {
+	wasted := map[string]*WastedFile{}
+	var walk func(n *node, p string)
+	walk = func(n *node, p string) {
+		for i, v := range n.versions {
+			if v.kind == KindDir {
+				continue
+			}
+			if v.layer < len(img.Layers) {
+				l := &img.Layers[v.layer]
+				l.Size += v.size
+				switch n.change(v.layer) {
+				case Added:
+					l.Added++
+				case Modified:
+					l.Modified++
+				case Deleted:
+					if i > 0 && n.versions[i-1].kind != KindDir {
+						l.Deleted++
+					}
+				}
+			}
+			img.TotalSize += v.size
+			if i < len(n.versions)-1 && v.kind != KindDeleted && v.size > 0 {
+				img.WastedSize += v.size
+				w := wasted[p]
+				if w == nil {
+					w = &WastedFile{Path: p}
+					wasted[p] = w
+				}
+				w.Size += v.size
+				w.Copies++
+			}
+		}
+		for _, c := range n.children {
+			walk(c, joinPath(p, c.name))
+		}
+	}
+	walk(img.root, "/")
+
+	for _, w := range wasted {
+		img.Wasted = append(img.Wasted, *w)
+	}
+	sort.Slice(img.Wasted, func(i, j int) bool {
+		if img.Wasted[i].Size != img.Wasted[j].Size {
+			return img.Wasted[i].Size > img.Wasted[j].Size
+		}
+		return img.Wasted[i].Path < img.Wasted[j].Path
+	})
+	if len(img.Wasted) > maxWasted {
+		img.Wasted = img.Wasted[:maxWasted]
+	}
+	img.Efficiency = 1
+	if img.TotalSize > 0 {
+		img.Efficiency = float64(img.TotalSize-img.WastedSize) / float64(img.TotalSize)
+	}
+}
+
+// lookup finds the node for a cleaned path, "" being the root.
+func (n *node) lookup(p string) *node {
+	if p == "" {
+		return n
+	}
+	for _, part := range strings.Split(p, "/") {
+		n = n.children[part]
+		if n == nil {
+			return nil
+		}
+	}
+	return n
+}
+
+// List returns the contents of dir as they are after layer is applied, sorted by name.
+// Paths the layer deleted are included with Change "deleted". With changesOnly, only
+// entries the layer touched, or directories containing such entries, are returned.
+func (img *Image) List(layer int, dir string, changesOnly bool) ([]FileEntry, error) {
+	if layer < 0 || layer >= len(img.Layers) {
+		return nil, ErrNotFound
+	}
+	p := cleanPath(dir)
+	n := img.root.lookup(p)
+	if n == nil || !n.live(layer) {
+		return nil, ErrNotFound
+	}
+	if n.versions[n.at(layer)].kind != KindDir {
+		return nil, ErrNotDir
+	}
+
+	out := []FileEntry{}
+	for _, c := range n.children {
+		i := c.at(layer)
+		if i < 0 {
+			continue
+		}
+		v := c.versions[i]
+		change := c.change(layer)
+		if v.kind == KindDeleted {
+			if change != Deleted {
+				continue
+			}
+			// show what was deleted
+			v = c.versions[i-1]
+		}
+		e := FileEntry{
+			Name:       c.name,
+			Path:       joinPath("/"+p, c.name),
+			Type:       v.kind,
+			Size:       v.size,
+			Mode:       v.mode,
+			LinkTarget: v.link,
+			Change:     change,
+			Layer:      c.versions[i].layer,
+		}
+		if v.kind == KindDir {
+			if change == Deleted {
+				e.Size, _ = c.subtree(layer - 1)
+			} else {
+				e.Size, e.HasChanges = c.subtree(layer)
+			}
+		}
+		if changesOnly && change == "" && !e.HasChanges {
+			continue
+		}
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+// subtree returns the size of the files below n at layer and whether layer changed any of them.
+func (n *node) subtree(layer int) (size int64, changed bool) {
+	for _, c := range n.children {
+		i := c.at(layer)
+		if i < 0 {
+			continue
+		}
+		if c.versions[i].layer == layer {
+			changed = true
+		}
+		switch c.versions[i].kind {
+		case KindDeleted:
+		case KindDir:
+			s, ch := c.subtree(layer)
+			size += s
+			changed = changed || ch
+		default:
+			size += c.versions[i].size
+		}
+	}
+	return size, changed
+}
+
+func joinPath(dir, name string) string {
+	if strings.HasSuffix(dir, "/") {
+		return dir + name
+	}
+	return dir + "/" + name
+}
@@ -0,0 +1,179 @@
+package imagefs
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// testImage has three layers:
+//
+//	0: etc/a (10), etc/b (20), var/cache/x (100), var/cache/y (50), bin/sh (30)
+//	1: rewrites etc/a (15), whites out etc/b, makes var/cache opaque and adds var/cache/z (5)
+//	2: whites out etc/a and bin, and writes bin/sh (40) again in the same layer
+func testImage(t *testing.T) *Image {
+	t.Helper()
+	layers := [][]tarEntry{
+		{
+			{name: "etc/"}, {name: "etc/a", size: 10}, {name: "etc/b", size: 20},
+			{name: "var/"}, {name: "var/cache/"}, {name: "var/cache/x", size: 100}, {name: "var/cache/y", size: 50},
+			{name: "bin/"}, {name: "bin/sh", size: 30},
+		},
+		{
+			{name: "etc/a", size: 15}, {name: "etc/.wh.b"},
+			{name: "var/cache/.wh..wh..opq"}, {name: "var/cache/z", size: 5},
+		},
+		{
+			{name: "etc/.wh.a"}, {name: "bin/sh", size: 40}, {name: ".wh.bin"},
+		},
+	}
+	var tars [][]byte
+	for _, l := range layers {
+		tars = append(tars, writeTar(t, l))
+	}
+	img, err := Analyze(bytes.NewReader(saveArchive(t, tars...)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func TestBuildStats(t *testing.T) {
+	img := testImage(t)
+
+	wantLayers := []struct {
+		size                     int64
+		added, modified, deleted int
+	}{
+		{size: 210, added: 5},
+		{size: 20, added: 1, modified: 1, deleted: 3},
+		{size: 40, modified: 1, deleted: 1},
+	}
+	for i, want := range wantLayers {
+		l := img.Layers[i]
+		if l.Size != want.size || l.Added != want.added || l.Modified != want.modified || l.Deleted != want.deleted {
+			t.Errorf("layer %d: size %d added %d modified %d deleted %d, want %+v", i, l.Size, l.Added, l.Modified, l.Deleted, want)
+		}
+	}
+
+	// every copy counts towards the total; copies later overwritten or deleted are waste
+	if img.TotalSize != 270 {
+		t.Errorf("TotalSize = %d, want 270", img.TotalSize)
+	}
+	if img.WastedSize != 225 {
+		t.Errorf("WastedSize = %d, want 225", img.WastedSize)
+	}
+	if want := 45.0 / 270; img.Efficiency != want {
+		t.Errorf("Efficiency = %v, want %v", img.Efficiency, want)
+	}
+	wantWasted := []WastedFile{
+		{Path: "/var/cache/x", Size: 100, Copies: 1},
+		{Path: "/var/cache/y", Size: 50, Copies: 1},
+		{Path: "/bin/sh", Size: 30, Copies: 1},
+		{Path: "/etc/a", Size: 25, Copies: 2},
+		{Path: "/etc/b", Size: 20, Copies: 1},
+	}
+	if !reflect.DeepEqual(img.Wasted, wantWasted) {
+		t.Errorf("Wasted = %+v, want %+v", img.Wasted, wantWasted)
+	}
+}
+
+func TestBuildEmptyImage(t *testing.T) {
+	img := build("sha256:empty", []Layer{{}}, [][]entry{nil})
+	if img.TotalSize != 0 || img.WastedSize != 0 || img.Efficiency != 1 || len(img.Wasted) != 0 {
+		t.Errorf("empty image stats = %d/%d/%v/%v", img.TotalSize, img.WastedSize, img.Efficiency, img.Wasted)
+	}
+}
+
+// listed is the part of a FileEntry the List tests compare.
+type listed struct {
+	Name       string
+	Type       Kind
+	Size       int64
+	Change     Change
+	Layer      int
+	HasChanges bool
+}
+
+func TestList(t *testing.T) {
+	img := testImage(t)
+	tests := []struct {
+		name    string
+		layer   int
+		dir     string
+		changes bool
+		want    []listed
+	}{
+		{"base root", 0, "/", false, []listed{
+			{"bin", KindDir, 30, Added, 0, true},
+			{"etc", KindDir, 30, Added, 0, true},
+			{"var", KindDir, 150, Added, 0, true},
+		}},
+		{"modified and whited out", 1, "/etc", false, []listed{
+			{"a", KindFile, 15, Modified, 1, false},
+			{"b", KindFile, 20, Deleted, 1, false},
+		}},
+		{"opaque directory", 1, "var/cache/", false, []listed{
+			{"x", KindFile, 100, Deleted, 1, false},
+			{"y", KindFile, 50, Deleted, 1, false},
+			{"z", KindFile, 5, Added, 1, false},
+		}},
+		{"changed directories only", 1, "/", true, []listed{
+			{"etc", KindDir, 15, "", 0, true},
+			{"var", KindDir, 5, "", 0, true},
+		}},
+		{"deleted file shows its last content", 2, "/etc", false, []listed{
+			{"a", KindFile, 15, Deleted, 2, false},
+		}},
+		{"earlier deletions are gone", 2, "/etc", true, []listed{
+			{"a", KindFile, 15, Deleted, 2, false},
+		}},
+		{"rewritten after whiteout in the same layer", 2, "/bin", false, []listed{
+			{"sh", KindFile, 40, Modified, 2, false},
+		}},
+		{"unchanged directory at a later layer", 2, "/var/cache", false, []listed{
+			{"z", KindFile, 5, "", 1, false},
+		}},
+		{"nothing changed below", 2, "/var", true, []listed{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := img.List(tt.layer, tt.dir, tt.changes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []listed{}
+			for _, e := range entries {
+				got = append(got, listed{e.Name, e.Type, e.Size, e.Change, e.Layer, e.HasChanges})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("List(%d, %q) =\n%+v\nwant\n%+v", tt.layer, tt.dir, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListErrors(t *testing.T) {
+	img := testImage(t)
+	tests := []struct {
+		name  string
+		layer int
+		dir   string
+		want  error
+	}{
+		{"file", 0, "/etc/a", ErrNotDir},
+		{"missing", 0, "/nope", ErrNotFound},
+		{"not yet created", 0, "/var/cache/z", ErrNotFound},
+		{"deleted", 1, "/etc/b", ErrNotFound},
+		{"negative layer", -1, "/", ErrNotFound},
+		{"layer out of range", 3, "/", ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := img.List(tt.layer, tt.dir, false); !errors.Is(err, tt.want) {
+				t.Errorf("List(%d, %q) error = %v, want %v", tt.layer, tt.dir, err, tt.want)
+			}
+		})
+	}
+}
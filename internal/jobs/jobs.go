@@ -0,0 +1,320 @@
+// Package jobs runs long-lived daemon operations such as pulls, builds and prunes in the
+// background, independent of the HTTP request that started them.
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusCancelled Status = "cancelled"
+)
+
+var (
+	ErrNotFound = errors.New("job not found")
+	ErrFinished = errors.New("job already finished")
+)
+
+// maxEvents bounds the per-job event history kept for late subscribers.
+const maxEvents = 2000
+
+// Event is one progress or log entry produced by a job.
+type Event struct {
+	Seq     int       `json:"seq"`
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"` // "progress", "step", "log", "error" or "status"
+	ID      string    `json:"id,omitempty"`
+	Status  string    `json:"status,omitempty"`
+	Message string    `json:"message,omitempty"`
+	Current int64     `json:"current,omitempty"`
+	Total   int64     `json:"total,omitempty"`
+}
+
+// Owner is who started a job: the user and the label selector their rights were limited to.
+// The zero Owner marks a job shared by everyone, such as one started with authentication off.
+type Owner struct {
+	User     string `json:"user,omitempty"`
+	Selector string `json:"selector,omitempty"`
+}
+
+// Snapshot is the JSON view of a job.
+type Snapshot struct {
+	ID         string         `json:"id"`
+	Kind       string         `json:"kind"`
+	Target     string         `json:"target"`
+	Owner      Owner          `json:"owner"`
+	Status     Status         `json:"status"`
+	CreatedAt  time.Time      `json:"createdAt"`
+	FinishedAt *time.Time     `json:"finishedAt,omitempty"`
+	Error      string         `json:"error,omitempty"`
+	Progress   Progress       `json:"progress"`
+	Result     map[string]any `json:"result,omitempty"`
+}
+
+// Job is a single background operation.
+type Job struct {
+	id      string
+	kind    string
+	target  string
+	owner   Owner
+	created time.Time
+	cancel  context.CancelFunc
+	done    chan struct{}
+
+	mu         sync.Mutex
+	status     Status
+	finished   time.Time
+	err        string
+	progress   Progress
+	result     map[string]any
+	events     []Event
+	seq        int
+	subs       map[chan Event]struct{}
+	cancelling bool
+}
+
+func (j *Job) ID() string { return j.id }
+
+func (j *Job) Owner() Owner { return j.owner }
+
+// Done is closed once the job has finished.
+func (j *Job) Done() <-chan struct{} { return j.done }
+
+func (j *Job) Snapshot() Snapshot {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	s := Snapshot{
+		ID:        j.id,
+		Kind:      j.kind,
+		Target:    j.target,
+		Owner:     j.owner,
+		Status:    j.status,
+		CreatedAt: j.created,
+		Error:     j.err,
+		Progress:  j.progress.clone(),
+	}
+	if j.result != nil {
+		s.Result = make(map[string]any, len(j.result))
+		for k, v := range j.result {
+			s.Result[k] = v
+		}
+	}
+	if !j.finished.IsZero() {
+		t := j.finished
+		s.FinishedAt = &t
+	}
+	return s
+}
+
+// Publish records an event and forwards it to subscribers.
+func (j *Job) Publish(e Event) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.publishLocked(e)
+}
+
+func (j *Job) publishLocked(e Event) {
+	j.seq++
+	e.Seq = j.seq
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	j.events = append(j.events, e)
+	if len(j.events) > maxEvents {
+		j.events = j.events[len(j.events)-maxEvents:]
+	}
+	for ch := range j.subs {
+		select {
+		case ch <- e:
+		default:
+			// a subscriber that cannot keep up is dropped; it can re-attach and replay
+			delete(j.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// SetResult stores a value in the job's result map, e.g. the ID of a built image.
+func (j *Job) SetResult(key string, value any) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.result == nil {
+		j.result = map[string]any{}
+	}
+	j.result[key] = value
+}
+
+// Subscribe returns the retained event history and a channel of subsequent events.
+// The channel is closed when the job finishes or the subscriber falls behind.
+func (j *Job) Subscribe() ([]Event, <-chan Event, func()) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	past := append([]Event(nil), j.events...)
+	ch := make(chan Event, 256)
+	if j.status != StatusRunning {
+		close(ch)
+		return past, ch, func() {}
+	}
+	j.subs[ch] = struct{}{}
+	unsubscribe := func() {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		if _, ok := j.subs[ch]; ok {
+			delete(j.subs, ch)
+			close(ch)
+		}
+	}
+	return past, ch, unsubscribe
+}
+
+func (j *Job) finish(err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	switch {
+	case err == nil:
+		j.status = StatusSucceeded
+		j.progress.Percent = 100
+		if j.progress.TotalSteps > 0 {
+			j.progress.Step = j.progress.TotalSteps
+		}
+	case j.cancelling || errors.Is(err, context.Canceled):
+		j.status = StatusCancelled
+		j.err = "cancelled"
+	case errors.Is(err, context.DeadlineExceeded):
+		j.status = StatusFailed
+		j.err = "timed out"
+	default:
+		j.status = StatusFailed
+		j.err = err.Error()
+	}
+	j.finished = time.Now().UTC()
+	j.publishLocked(Event{Type: "status", Status: string(j.status), Message: j.err})
+	// done is closed first so subscribers can tell completion from being dropped
+	close(j.done)
+	for ch := range j.subs {
+		close(ch)
+	}
+	j.subs = nil
+}
+
+// Manager owns all jobs and forgets finished ones after the retention period.
+type Manager struct {
+	retention time.Duration
+	ctx       context.Context
+	stop      context.CancelFunc
+
+	mu   sync.Mutex
+	jobs map[string]*Job
+}
+
+func NewManager(retention time.Duration) *Manager {
+	ctx, stop := context.WithCancel(context.Background())
+	return &Manager{retention: retention, ctx: ctx, stop: stop, jobs: map[string]*Job{}}
+}
+
+// Start runs fn in the background with its own timeout and returns immediately.
+// kind names the operation ("pull", "build", ...), target is what it acts on and owner who
+// asked for it.
+func (m *Manager) Start(kind, target string, owner Owner, timeout time.Duration, fn func(ctx context.Context, j *Job) error) *Job {
+	ctx, cancel := context.WithTimeout(m.ctx, timeout)
+	j := &Job{
+		id:      newID(),
+		kind:    kind,
+		target:  target,
+		owner:   owner,
+		created: time.Now().UTC(),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		status:  StatusRunning,
+		subs:    map[chan Event]struct{}{},
+	}
+	m.mu.Lock()
+	m.expireLocked()
+	m.jobs[j.id] = j
+	m.mu.Unlock()
+
+	go func() {
+		defer cancel()
+		j.finish(fn(ctx, j))
+	}()
+	return j
+}
+
+func (m *Manager) Get(id string) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return j, nil
+}
+
+// List returns snapshots of all retained jobs, newest first.
+func (m *Manager) List() []Snapshot {
+	m.mu.Lock()
+	m.expireLocked()
+	jobs := make([]*Job, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		jobs = append(jobs, j)
+	}
+	m.mu.Unlock()
+
+	out := make([]Snapshot, 0, len(jobs))
+	for _, j := range jobs {
+		out = append(out, j.Snapshot())
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].CreatedAt.After(out[b].CreatedAt) })
+	return out
+}
+
+// Cancel stops a running job.
+func (m *Manager) Cancel(id string) error {
+	j, err := m.Get(id)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	if j.status != StatusRunning {
+		j.mu.Unlock()
+		return ErrFinished
+	}
+	j.cancelling = true
+	j.mu.Unlock()
+	j.cancel()
+	return nil
+}
+
+// Shutdown cancels every running job.
+func (m *Manager) Shutdown() {
+	m.stop()
+}
+
+func (m *Manager) expireLocked() {
+	cutoff := time.Now().Add(-m.retention)
+	for id, j := range m.jobs {
+		j.mu.Lock()
+		expired := !j.finished.IsZero() && j.finished.Before(cutoff)
+		j.mu.Unlock()
+		if expired {
+			delete(m.jobs, id)
+		}
+	}
+}
+
+func newID() string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,138 @@
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/pkg/jsonmessage"
+)
+
+// Progress is the parsed state of a pull, push or build.
+type Progress struct {
+	// Layers tracks per-layer transfer state, keyed by layer ID (pulls and pushes).
+	Layers map[string]LayerProgress `json:"layers,omitempty"`
+	// Step and TotalSteps follow "Step N/M" lines of a build.
+	Step       int     `json:"step,omitempty"`
+	TotalSteps int     `json:"totalSteps,omitempty"`
+	Current    int64   `json:"current,omitempty"`
+	Total      int64   `json:"total,omitempty"`
+	Percent    float64 `json:"percent"`
+	Message    string  `json:"message,omitempty"`
+}
+
+type LayerProgress struct {
+	Status  string `json:"status"`
+	Current int64  `json:"current,omitempty"`
+	Total   int64  `json:"total,omitempty"`
+}
+
+func (p Progress) clone() Progress {
+	if p.Layers != nil {
+		layers := make(map[string]LayerProgress, len(p.Layers))
+		for k, v := range p.Layers {
+			layers[k] = v
+		}
+		p.Layers = layers
+	}
+	return p
+}
+
+var buildStep = regexp.MustCompile(`^Step (\d+)/(\d+) :`)
+
+// ConsumeDaemonStream reads a daemon JSON progress stream (as returned by ImagePull, ImagePush
+// and ImageBuild) to the end, updating the job's progress and event log. An error reported
+// inside the stream is returned as an error.
+func (j *Job) ConsumeDaemonStream(r io.Reader) error {
+	dec := json.NewDecoder(r)
+	for {
+		var msg jsonmessage.JSONMessage
+		if err := dec.Decode(&msg); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if msg.Error != nil || msg.ErrorMessage != "" {
+			text := msg.ErrorMessage
+			if msg.Error != nil {
+				text = msg.Error.Message
+			}
+			j.Publish(Event{Type: "error", Message: text})
+			return errors.New(text)
+		}
+		j.apply(msg)
+	}
+}
+
+func (j *Job) apply(msg jsonmessage.JSONMessage) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	p := &j.progress
+
+	if msg.Aux != nil {
+		var aux map[string]any
+		if err := json.Unmarshal(*msg.Aux, &aux); err == nil {
+			if j.result == nil {
+				j.result = map[string]any{}
+			}
+			for key, name := range map[string]string{"ID": "id", "Digest": "digest", "Tag": "tag"} {
+				if v, ok := aux[key]; ok {
+					j.result[name] = v
+				}
+			}
+		}
+	}
+
+	if msg.Stream != "" {
+		line := strings.TrimRight(msg.Stream, "\r\n")
+		if m := buildStep.FindStringSubmatch(line); m != nil {
+			p.Step, _ = strconv.Atoi(m[1])
+			p.TotalSteps, _ = strconv.Atoi(m[2])
+			p.Percent = float64(p.Step-1) / float64(p.TotalSteps) * 100
+			p.Message = line
+			j.publishLocked(Event{Type: "step", Status: "running", Message: line, Current: int64(p.Step), Total: int64(p.TotalSteps)})
+		} else if strings.TrimSpace(line) == "---> Using cache" && p.Step > 0 {
+			j.publishLocked(Event{Type: "step", Status: "cached", Current: int64(p.Step), Total: int64(p.TotalSteps)})
+		}
+		if line != "" {
+			j.publishLocked(Event{Type: "log", Message: line})
+		}
+		return
+	}
+	if msg.Status == "" {
+		return
+	}
+	if msg.ID == "" {
+		p.Message = msg.Status
+		j.publishLocked(Event{Type: "log", Message: msg.Status})
+		return
+	}
+
+	if p.Layers == nil {
+		p.Layers = map[string]LayerProgress{}
+	}
+	layer := p.Layers[msg.ID]
+	layer.Status = msg.Status
+	if msg.Progress != nil && msg.Progress.Total > 0 {
+		layer.Current, layer.Total = msg.Progress.Current, msg.Progress.Total
+	}
+	if strings.HasSuffix(msg.Status, "complete") || msg.Status == "Already exists" {
+		layer.Current = layer.Total
+	}
+	p.Layers[msg.ID] = layer
+	p.Current, p.Total = 0, 0
+	for _, l := range p.Layers {
+		if l.Total > 0 {
+			p.Current += min(l.Current, l.Total)
+			p.Total += l.Total
+		}
+	}
+	if p.Total > 0 {
+		p.Percent = float64(p.Current) / float64(p.Total) * 100
+	}
+	j.publishLocked(Event{Type: "progress", ID: msg.ID, Status: msg.Status, Current: layer.Current, Total: layer.Total})
+}
@@ -0,0 +1,499 @@
+// Package registryclient reads and prunes repositories on registries that speak the
+// Registry HTTP API v2, such as registry:2, Harbor or GHCR. It handles both basic and
+// bearer token authentication.
+package registryclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/distribution/reference"
+
+	"github.com/Nebula-work/docker-web/internal/credentials"
+)
+
+const (
+	// maxManifestSize bounds manifests and other JSON bodies read from a registry.
+	maxManifestSize = 4 << 20
+	defaultPageSize = 100
+)
+
+var (
+	ErrNotFound     = errors.New("not found in registry")
+	ErrUnauthorized = errors.New("registry denied access")
+	// ErrUnsupported is returned when the registry does not offer an operation, e.g. the
+	// catalog on Docker Hub or deletes on a registry without storage.delete enabled.
+	ErrUnsupported = errors.New("operation not supported by registry")
+	// ErrInvalid is returned for repository names, tags and digests that are not valid
+	// references, before anything is sent to the registry.
+	ErrInvalid = errors.New("invalid reference")
+)
+
+var (
+	anchoredTag    = regexp.MustCompile(`^` + reference.TagRegexp.String() + `$`)
+	anchoredDigest = regexp.MustCompile(`^` + reference.DigestRegexp.String() + `$`)
+)
+
+// manifestTypes are the manifest media types asked for, newest first.
+var manifestTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// Client talks to one registry.
+type Client struct {
+	base string
+	cred *credentials.Credential
+	http *http.Client
+
+	mu     sync.Mutex
+	tokens map[string]string // bearer token by scope
+	basic  bool              // the registry asked for basic auth
+}
+
+// New returns a client for registry (a host[:port] as stored by the credentials package).
+// cred may be nil for anonymous access. Plain http is used for loopback registries and
+// when insecure is set.
+func New(registry string, cred *credentials.Credential, insecure bool) *Client {
+	registry = credentials.NormalizeRegistry(registry)
+	host := registry
+	if host == credentials.DockerHub {
+		host = "registry-1.docker.io"
+	}
+	scheme := "https"
+	if insecure || isLoopback(host) {
+		scheme = "http"
+	}
+	return &Client{
+		base:   scheme + "://" + host,
+		cred:   cred,
+		http:   &http.Client{Timeout: 30 * time.Second},
+		tokens: map[string]string{},
+	}
+}
+
+func isLoopback(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Page is one page of a paginated list; Next is the value to pass as last for the next
+// page and is empty on the last page.
+type Page struct {
+	Items []string `json:"items"`
+	Next  string   `json:"next,omitempty"`
+}
+
+// Repositories lists the registry's catalog.
+func (c *Client) Repositories(ctx context.Context, n int, last string) (Page, error) {
+	var body struct {
+		Repositories []string `json:"repositories"`
+	}
+	next, err := c.list(ctx, "/v2/_catalog", "registry:catalog:*", n, last, &body)
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrUnauthorized) {
+		// Docker Hub and several hosted registries do not expose the catalog at all
+		err = fmt.Errorf("%w: catalog unavailable (%v)", ErrUnsupported, err)
+	}
+	return Page{Items: nonNil(body.Repositories), Next: next}, err
+}
+
+// Tags lists the tags of repo.
+func (c *Client) Tags(ctx context.Context, repo string, n int, last string) (Page, error) {
+	repo, err := c.repoPath(repo)
+	if err != nil {
+		return Page{Items: []string{}}, err
+	}
+	var body struct {
+		Tags []string `json:"tags"`
+	}
+	next, err := c.list(ctx, "/v2/"+repo+"/tags/list", pullScope(repo), n, last, &body)
+	return Page{Items: nonNil(body.Tags), Next: next}, err
+}
+
+func (c *Client) list(ctx context.Context, path, scope string, n int, last string, out any) (string, error) {
+	if n <= 0 {
+		n = defaultPageSize
+	}
+	q := url.Values{"n": {strconv.Itoa(n)}}
+	if last != "" {
+		q.Set("last", last)
+	}
+	res, err := c.do(ctx, http.MethodGet, path+"?"+q.Encode(), scope, nil)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if err := json.NewDecoder(io.LimitReader(res.Body, maxManifestSize)).Decode(out); err != nil {
+		return "", fmt.Errorf("decoding %s: %w", path, err)
+	}
+	return nextLast(res.Header.Get("Link")), nil
+}
+
+// nextLast extracts the last parameter from a Link header such as
+// `</v2/_catalog?last=b&n=100>; rel="next"`.
+func nextLast(link string) string {
+	if !strings.Contains(link, `rel="next"`) {
+		return ""
+	}
+	start, end := strings.Index(link, "<"), strings.Index(link, ">")
+	if start < 0 || end < start {
+		return ""
+	}
+	u, err := url.Parse(link[start+1 : end])
+	if err != nil {
+		return ""
+	}
+	return u.Query().Get("last")
+}
+
+// Descriptor points at a blob or manifest.
+type Descriptor struct {
+	MediaType string    `json:"mediaType"`
+	Digest    string    `json:"digest"`
+	Size      int64     `json:"size"`
+	Platform  *Platform `json:"platform,omitempty"`
+}
+
+type Platform struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// Manifest describes a tag or digest. An index (multi-platform image) lists its
+// per-platform manifests; a single image lists its config and layers.
+type Manifest struct {
+	Repository string       `json:"repository"`
+	Reference  string       `json:"reference"`
+	Digest     string       `json:"digest"`
+	MediaType  string       `json:"mediaType"`
+	Manifests  []Descriptor `json:"manifests,omitempty"`
+	Config     *Descriptor  `json:"config,omitempty"`
+	Layers     []Descriptor `json:"layers,omitempty"`
+	// Size is the sum of the config and layer sizes, i.e. the compressed download size.
+	Size int64 `json:"size,omitempty"`
+}
+
+// Manifest fetches the manifest of repo at ref, a tag or digest.
+func (c *Client) Manifest(ctx context.Context, repo, ref string) (Manifest, error) {
+	repo, err := c.repoPath(repo)
+	if err != nil {
+		return Manifest{}, err
+	}
+	if !anchoredTag.MatchString(ref) && !anchoredDigest.MatchString(ref) {
+		return Manifest{}, fmt.Errorf("%w: %q is not a tag or digest", ErrInvalid, ref)
+	}
+	res, err := c.do(ctx, http.MethodGet, "/v2/"+repo+"/manifests/"+ref, pullScope(repo), acceptManifests)
+	if err != nil {
+		return Manifest{}, err
+	}
+	defer res.Body.Close()
+	raw, err := io.ReadAll(io.LimitReader(res.Body, maxManifestSize+1))
+	if err != nil {
+		return Manifest{}, err
+	}
+	if len(raw) > maxManifestSize {
+		return Manifest{}, fmt.Errorf("manifest %s:%s is too large", repo, ref)
+	}
+	var body struct {
+		MediaType string       `json:"mediaType"`
+		Manifests []Descriptor `json:"manifests"`
+		Config    *Descriptor  `json:"config"`
+		Layers    []Descriptor `json:"layers"`
+	}
+	if err := json.Unmarshal(raw, &body); err != nil {
+		return Manifest{}, fmt.Errorf("decoding manifest: %w", err)
+	}
+	m := Manifest{
+		Repository: repo,
+		Reference:  ref,
+		Digest:     res.Header.Get("Docker-Content-Digest"),
+		MediaType:  body.MediaType,
+		Manifests:  body.Manifests,
+		Config:     body.Config,
+		Layers:     body.Layers,
+	}
+	if ct := res.Header.Get("Content-Type"); m.MediaType == "" {
+		m.MediaType, _, _ = strings.Cut(ct, ";")
+	}
+	if m.Digest == "" {
+		m.Digest = fmt.Sprintf("sha256:%x", sha256.Sum256(raw))
+	}
+	if m.Manifests == nil && m.Config != nil {
+		m.Size = m.Config.Size
+		for _, l := range m.Layers {
+			m.Size += l.Size
+		}
+	}
+	return m, nil
+}
+
+// DeleteTag deletes the manifest tag points at. The registry API deletes by digest, so
+// every other tag on the same manifest goes with it.
+func (c *Client) DeleteTag(ctx context.Context, repo, tag string) (string, error) {
+	repo, err := c.repoPath(repo)
+	if err != nil {
+		return "", err
+	}
+	if !anchoredTag.MatchString(tag) {
+		return "", fmt.Errorf("%w: %q is not a tag", ErrInvalid, tag)
+	}
+	scope := "repository:" + repo + ":pull,delete"
+	res, err := c.do(ctx, http.MethodHead, "/v2/"+repo+"/manifests/"+tag, scope, acceptManifests)
+	if err != nil {
+		return "", err
+	}
+	res.Body.Close()
+	digest := res.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", fmt.Errorf("registry did not report the digest of %s:%s", repo, tag)
+	}
+	res, err = c.do(ctx, http.MethodDelete, "/v2/"+repo+"/manifests/"+digest, scope, nil)
+	if err != nil {
+		return "", err
+	}
+	res.Body.Close()
+	return digest, nil
+}
+
+func acceptManifests(req *http.Request) {
+	req.Header.Set("Accept", strings.Join(manifestTypes, ", "))
+}
+
+// repoPath validates repo, a repository name without registry host, tag or digest, and adds
+// the implicit library/ namespace of official Docker Hub images.
+func (c *Client) repoPath(repo string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(repo)
+	if err != nil {
+		return "", fmt.Errorf("%w: repository %q: %v", ErrInvalid, repo, err)
+	}
+	path := reference.Path(named)
+	if !reference.IsNameOnly(named) || (path != repo && path != "library/"+repo) {
+		return "", fmt.Errorf("%w: repository %q must be a name without registry, tag or digest", ErrInvalid, repo)
+	}
+	if c.base == "https://registry-1.docker.io" {
+		return path, nil
+	}
+	return repo, nil
+}
+
+func pullScope(repo string) string {
+	return "repository:" + repo + ":pull"
+}
+
+// do sends a request, authenticating and retrying once if the registry asks for it.
+// Responses other than 2xx are turned into errors.
+func (c *Client) do(ctx context.Context, method, path, scope string, prepare func(*http.Request)) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, c.base+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		if prepare != nil {
+			prepare(req)
+		}
+		c.authorize(req, scope)
+		res, err := c.http.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			challenge := res.Header.Get("WWW-Authenticate")
+			drain(res)
+			if err := c.authenticate(ctx, challenge, scope); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if res.StatusCode/100 == 2 {
+			return res, nil
+		}
+		defer drain(res)
+		return nil, statusError(res)
+	}
+}
+
+func (c *Client) authorize(req *http.Request, scope string) {
+	c.mu.Lock()
+	token, basic := c.tokens[scope], c.basic
+	c.mu.Unlock()
+	switch {
+	case token != "":
+		req.Header.Set("Authorization", "Bearer "+token)
+	case basic && c.cred != nil && c.cred.Password != "":
+		req.SetBasicAuth(c.cred.Username, c.cred.Password)
+	}
+}
+
+// authenticate answers a WWW-Authenticate challenge: basic auth is remembered, bearer
+// challenges are exchanged for a token at the realm.
+func (c *Client) authenticate(ctx context.Context, challenge, scope string) error {
+	kind, params := parseChallenge(challenge)
+	switch kind {
+	case "basic":
+		if c.cred == nil || c.cred.Password == "" {
+			return ErrUnauthorized
+		}
+		c.mu.Lock()
+		c.basic = true
+		c.mu.Unlock()
+		return nil
+	case "bearer":
+		token, err := c.fetchToken(ctx, params, scope)
+		if err != nil {
+			return err
+		}
+		c.mu.Lock()
+		c.tokens[scope] = token
+		c.mu.Unlock()
+		return nil
+	}
+	return ErrUnauthorized
+}
+
+func (c *Client) fetchToken(ctx context.Context, params map[string]string, scope string) (string, error) {
+	realm := params["realm"]
+	u, err := url.Parse(realm)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return "", fmt.Errorf("registry sent an invalid token realm %q", realm)
+	}
+	// credentials go to the realm, so it may only use plain http when the registry itself
+	// does or when it is on this machine
+	if u.Scheme == "http" && strings.HasPrefix(c.base, "https:") && !isLoopback(u.Host) {
+		return "", fmt.Errorf("registry sent a plain http token realm %q for an https registry", realm)
+	}
+	if params["scope"] != "" && !strings.Contains(scope, params["scope"]) {
+		scope += " " + params["scope"]
+	}
+	var req *http.Request
+	if c.cred != nil && c.cred.IdentityToken != "" {
+		// identity tokens are OAuth2 refresh tokens
+		form := url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {c.cred.IdentityToken},
+			"service":       {params["service"]},
+			"scope":         {scope},
+			"client_id":     {"docker-web"},
+		}
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, realm, strings.NewReader(form.Encode()))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	} else {
+		q := u.Query()
+		if params["service"] != "" {
+			q.Set("service", params["service"])
+		}
+		for _, s := range strings.Fields(scope) {
+			q.Add("scope", s)
+		}
+		u.RawQuery = q.Encode()
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err == nil && c.cred != nil && c.cred.Password != "" {
+			req.SetBasicAuth(c.cred.Username, c.cred.Password)
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	res, err := c.http.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("fetching registry token: %w", err)
+	}
+	defer drain(res)
+	if res.StatusCode/100 != 2 {
+		return "", fmt.Errorf("%w: token request returned %s", ErrUnauthorized, res.Status)
+	}
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(res.Body, maxManifestSize)).Decode(&body); err != nil {
+		return "", fmt.Errorf("decoding registry token: %w", err)
+	}
+	if body.Token == "" {
+		body.Token = body.AccessToken
+	}
+	if body.Token == "" {
+		return "", fmt.Errorf("%w: empty token", ErrUnauthorized)
+	}
+	return body.Token, nil
+}
+
+// parseChallenge splits `Bearer realm="...",service="..."` into its scheme and parameters.
+func parseChallenge(h string) (string, map[string]string) {
+	kind, rest, _ := strings.Cut(strings.TrimSpace(h), " ")
+	params := map[string]string{}
+	for rest != "" {
+		var key, value string
+		key, rest, _ = strings.Cut(strings.TrimLeft(rest, " ,"), "=")
+		if strings.HasPrefix(rest, `"`) {
+			value, rest, _ = strings.Cut(rest[1:], `"`)
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		if key = strings.ToLower(strings.TrimSpace(key)); key != "" {
+			params[key] = value
+		}
+	}
+	return strings.ToLower(kind), params
+}
+
+// statusError turns a failed response into an error, using the registry's error body
+// when it has one.
+func statusError(res *http.Response) error {
+	var body struct {
+		Errors []struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	detail := res.Status
+	if json.NewDecoder(io.LimitReader(res.Body, 64*1024)).Decode(&body) == nil && len(body.Errors) > 0 {
+		detail = body.Errors[0].Message
+		if body.Errors[0].Code == "UNSUPPORTED" {
+			return fmt.Errorf("%w: %s", ErrUnsupported, detail)
+		}
+	}
+	switch res.StatusCode {
+	case http.StatusNotFound:
+		return fmt.Errorf("%w: %s", ErrNotFound, detail)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("%w: %s", ErrUnauthorized, detail)
+	case http.StatusMethodNotAllowed:
+		return fmt.Errorf("%w: %s", ErrUnsupported, detail)
+	}
+	return fmt.Errorf("registry returned %s", detail)
+}
+
+func drain(res *http.Response) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64*1024))
+	res.Body.Close()
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
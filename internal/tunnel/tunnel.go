@@ -0,0 +1,394 @@
+// Package tunnel multiplexes byte streams over a single WebSocket connection. The server
+// uses it to reach Docker daemons through agents that dial out to it.
+//
+// Every WebSocket binary message is one frame: a type byte, a big-endian stream ID and a
+// payload. Each stream has a fixed receive window; the reader returns credit as it
+// consumes data, so one slow stream cannot stall the others.
+package tunnel
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	frameOpen   byte = iota + 1 // new stream
+	frameData                   // payload bytes
+	frameWindow                 // payload is a uint32 credit increment
+	frameClose                  // sender will write no more (half close)
+	frameReset                  // stream aborted in both directions
+)
+
+const (
+	headerLen  = 5
+	maxPayload = 32 * 1024
+	// window is how many unread bytes a stream buffers before the sender must wait.
+	window = 256 * 1024
+
+	pingInterval = 30 * time.Second
+	readTimeout  = 3 * pingInterval
+	acceptQueue  = 64
+)
+
+var (
+	ErrClosed      = errors.New("tunnel closed")
+	ErrStreamReset = errors.New("tunnel stream reset")
+)
+
+// Session is one end of a tunnel.
+type Session struct {
+	conn *websocket.Conn
+	wmu  sync.Mutex
+
+	mu      sync.Mutex
+	streams map[uint32]*Stream
+	nextID  uint32
+	err     error
+
+	accept    chan *Stream
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// New starts a session over conn. Exactly one end of a tunnel must be the opener: it
+// creates streams with Open, while the other end receives them from Accept.
+func New(conn *websocket.Conn, opener bool) *Session {
+	s := &Session{
+		conn:    conn,
+		streams: map[uint32]*Stream{},
+		nextID:  2,
+		accept:  make(chan *Stream, acceptQueue),
+		done:    make(chan struct{}),
+	}
+	if opener {
+		s.nextID = 1
+	}
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(readTimeout))
+	})
+	go s.readLoop()
+	go s.pingLoop()
+	return s
+}
+
+// Open starts a new stream to the other end.
+func (s *Session) Open() (*Stream, error) {
+	s.mu.Lock()
+	if s.err != nil {
+		s.mu.Unlock()
+		return nil, s.err
+	}
+	st := newStream(s, s.nextID)
+	s.streams[st.id] = st
+	s.nextID += 2
+	s.mu.Unlock()
+	if err := s.writeFrame(frameOpen, st.id, nil); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// Accept waits for a stream opened by the other end.
+func (s *Session) Accept() (*Stream, error) {
+	select {
+	case st := <-s.accept:
+		return st, nil
+	case <-s.done:
+		return nil, s.Err()
+	}
+}
+
+// Done is closed when the session ends.
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err reports why the session ended.
+func (s *Session) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func (s *Session) Close() error {
+	s.closeWithError(ErrClosed)
+	return nil
+}
+
+func (s *Session) closeWithError(err error) {
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		s.err = err
+		streams := s.streams
+		s.streams = map[uint32]*Stream{}
+		s.mu.Unlock()
+		for _, st := range streams {
+			st.abort(err)
+		}
+		s.conn.Close()
+		close(s.done)
+	})
+}
+
+func (s *Session) writeFrame(typ byte, id uint32, payload []byte) error {
+	msg := make([]byte, headerLen+len(payload))
+	msg[0] = typ
+	binary.BigEndian.PutUint32(msg[1:headerLen], id)
+	copy(msg[headerLen:], payload)
+	s.wmu.Lock()
+	err := s.conn.WriteMessage(websocket.BinaryMessage, msg)
+	s.wmu.Unlock()
+	if err != nil {
+		s.closeWithError(err)
+		return err
+	}
+	return nil
+}
+
+func (s *Session) pingLoop() {
+	t := time.NewTicker(pingInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-t.C:
+			if err := s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
+				s.closeWithError(err)
+				return
+			}
+		}
+	}
+}
+
+func (s *Session) readLoop() {
+	for {
+		_ = s.conn.SetReadDeadline(time.Now().Add(readTimeout))
+		typ, msg, err := s.conn.ReadMessage()
+		if err != nil {
+			s.closeWithError(err)
+			return
+		}
+		if typ != websocket.BinaryMessage || len(msg) < headerLen {
+			continue
+		}
+		id := binary.BigEndian.Uint32(msg[1:headerLen])
+		payload := msg[headerLen:]
+
+		if msg[0] == frameOpen {
+			s.mu.Lock()
+			st := newStream(s, id)
+			s.streams[id] = st
+			s.mu.Unlock()
+			select {
+			case s.accept <- st:
+			default:
+				// nobody is accepting fast enough
+				st.Close()
+			}
+			continue
+		}
+
+		s.mu.Lock()
+		st := s.streams[id]
+		s.mu.Unlock()
+		if st == nil {
+			continue // stream already closed on this end
+		}
+		switch msg[0] {
+		case frameData:
+			st.receive(payload)
+		case frameWindow:
+			if len(payload) == 4 {
+				st.grant(int(binary.BigEndian.Uint32(payload)))
+			}
+		case frameClose:
+			st.remoteClose()
+		case frameReset:
+			st.abort(ErrStreamReset)
+			s.forget(id)
+		}
+	}
+}
+
+func (s *Session) forget(id uint32) {
+	s.mu.Lock()
+	delete(s.streams, id)
+	s.mu.Unlock()
+}
+
+// Stream is a bidirectional byte stream inside a session. It implements net.Conn and
+// CloseWrite, so it can carry HTTP connections including hijacked ones.
+type Stream struct {
+	id uint32
+	s  *Session
+
+	mu           sync.Mutex
+	cond         *sync.Cond
+	buf          bytes.Buffer
+	unacked      int // bytes read but not yet returned to the sender as credit
+	credit       int // bytes this end may still send
+	localClosed  bool
+	remoteClosed bool
+	err          error
+}
+
+func newStream(s *Session, id uint32) *Stream {
+	st := &Stream{id: id, s: s, credit: window}
+	st.cond = sync.NewCond(&st.mu)
+	return st
+}
+
+func (st *Stream) Read(p []byte) (int, error) {
+	st.mu.Lock()
+	for st.buf.Len() == 0 && !st.remoteClosed && st.err == nil {
+		st.cond.Wait()
+	}
+	if st.err != nil {
+		st.mu.Unlock()
+		return 0, st.err
+	}
+	if st.buf.Len() == 0 {
+		st.mu.Unlock()
+		return 0, io.EOF
+	}
+	n, _ := st.buf.Read(p)
+	st.unacked += n
+	ack := 0
+	if st.unacked >= window/2 {
+		ack, st.unacked = st.unacked, 0
+	}
+	st.mu.Unlock()
+	if ack > 0 {
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], uint32(ack))
+		_ = st.s.writeFrame(frameWindow, st.id, b[:])
+	}
+	return n, nil
+}
+
+func (st *Stream) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		st.mu.Lock()
+		for st.credit == 0 && st.err == nil && !st.localClosed {
+			st.cond.Wait()
+		}
+		switch {
+		case st.err != nil:
+			st.mu.Unlock()
+			return written, st.err
+		case st.localClosed:
+			st.mu.Unlock()
+			return written, io.ErrClosedPipe
+		}
+		n := min(len(p), st.credit, maxPayload)
+		st.credit -= n
+		st.mu.Unlock()
+		if err := st.s.writeFrame(frameData, st.id, p[:n]); err != nil {
+			return written, err
+		}
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// CloseWrite tells the other end no more data will be written; reading continues.
+func (st *Stream) CloseWrite() error {
+	st.mu.Lock()
+	if st.localClosed || st.err != nil {
+		st.mu.Unlock()
+		return nil
+	}
+	st.localClosed = true
+	done := st.remoteClosed
+	st.cond.Broadcast()
+	st.mu.Unlock()
+	err := st.s.writeFrame(frameClose, st.id, nil)
+	if done {
+		st.s.forget(st.id)
+	}
+	return err
+}
+
+// Close ends the stream in both directions. Unless both ends had already finished
+// writing, the other end sees a reset.
+func (st *Stream) Close() error {
+	st.mu.Lock()
+	if st.err != nil {
+		st.mu.Unlock()
+		return nil
+	}
+	graceful := st.localClosed && st.remoteClosed
+	st.err = net.ErrClosed
+	st.cond.Broadcast()
+	st.mu.Unlock()
+	st.s.forget(st.id)
+	if !graceful {
+		_ = st.s.writeFrame(frameReset, st.id, nil)
+	}
+	return nil
+}
+
+func (st *Stream) receive(p []byte) {
+	st.mu.Lock()
+	if st.err != nil || st.remoteClosed {
+		st.mu.Unlock()
+		return
+	}
+	if st.buf.Len()+len(p) > window {
+		// the other end ignored the window
+		st.mu.Unlock()
+		st.Close()
+		return
+	}
+	st.buf.Write(p)
+	st.cond.Broadcast()
+	st.mu.Unlock()
+}
+
+func (st *Stream) grant(n int) {
+	st.mu.Lock()
+	st.credit += n
+	st.cond.Broadcast()
+	st.mu.Unlock()
+}
+
+func (st *Stream) remoteClose() {
+	st.mu.Lock()
+	st.remoteClosed = true
+	done := st.localClosed
+	st.cond.Broadcast()
+	st.mu.Unlock()
+	if done {
+		st.s.forget(st.id)
+	}
+}
+
+func (st *Stream) abort(err error) {
+	st.mu.Lock()
+	if st.err == nil {
+		st.err = err
+	}
+	st.cond.Broadcast()
+	st.mu.Unlock()
+}
+
+func (st *Stream) LocalAddr() net.Addr              { return tunnelAddr{} }
+func (st *Stream) RemoteAddr() net.Addr             { return tunnelAddr{} }
+func (st *Stream) SetDeadline(time.Time) error      { return nil }
+func (st *Stream) SetReadDeadline(time.Time) error  { return nil }
+func (st *Stream) SetWriteDeadline(time.Time) error { return nil }
+
+type tunnelAddr struct{}
+
+func (tunnelAddr) Network() string { return "tunnel" }
+func (tunnelAddr) String() string  { return "tunnel" }
@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// OpenBuildContext reads a build context archive from f in a form the Docker daemon accepts.
+// Tar archives, compressed or not, are passed through as they are; zip archives are
+// converted to tar while they are read.
+func OpenBuildContext(f *os.File) (io.ReadCloser, error) {
+	magic := make([]byte, 4)
+	n, err := f.ReadAt(magic, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	magic = magic[:n]
+	if !bytes.HasPrefix(magic, []byte("PK\x03\x04")) && !bytes.HasPrefix(magic, []byte("PK\x05\x06")) {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return io.NopCloser(f), nil
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.NewReader(f, info.Size())
+	if err != nil {
+		return nil, fmt.Errorf("reading zip context: %w", err)
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(zipToTar(zr, pw))
+	}()
+	return pr, nil
+}
+
+func zipToTar(zr *zip.Reader, w io.Writer) error {
+	tw := tar.NewWriter(w)
+	for _, zf := range zr.File {
+		name, err := contextPath(zf.Name)
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			continue
+		}
+		fi := zf.FileInfo()
+		var link string
+		if fi.Mode()&fs.ModeSymlink != 0 {
+			b, err := readZipFile(zf, 4096)
+			if err != nil {
+				return err
+			}
+			link = string(b)
+		}
+		hdr, err := tar.FileInfoHeader(fi, link)
+		if err != nil {
+			return fmt.Errorf("%s: %w", zf.Name, err)
+		}
+		hdr.Name = name
+		if fi.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return fmt.Errorf("%s: %w", zf.Name, err)
+		}
+		_, err = io.Copy(tw, rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", zf.Name, err)
+		}
+	}
+	return tw.Close()
+}
+
+// contextPath cleans an archive entry name, rejecting names that escape the context.
+func contextPath(name string) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	clean := path.Clean("/" + name)[1:]
+	if strings.HasPrefix(name, "/") || strings.Contains("/"+name+"/", "/../") {
+		return "", fmt.Errorf("archive entry %q is outside the build context", name)
+	}
+	return clean, nil
+}
+
+func readZipFile(zf *zip.File, limit int64) ([]byte, error) {
+	rc, err := zf.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(io.LimitReader(rc, limit))
+}
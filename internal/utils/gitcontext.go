@@ -0,0 +1,234 @@
+package utils
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/moby/patternmatcher"
+	"github.com/moby/patternmatcher/ignorefile"
+)
+
+var (
+	// scpLikeRepo matches git's user@host:path shorthand for ssh.
+	scpLikeRepo = regexp.MustCompile(`^[A-Za-z0-9._-]+@[A-Za-z0-9.-]+:[^/]`)
+	gitRef      = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]*$`)
+)
+
+// GitSource names a commit to build from: a remote URL or an absolute path of a repository
+// on the server, a branch, tag or commit (HEAD when empty), and a directory inside it.
+type GitSource struct {
+	Repository string
+	Ref        string
+	Subdir     string
+}
+
+// Local reports whether the repository is a path on the server rather than a URL.
+func (s GitSource) Local() bool {
+	return filepath.IsAbs(s.Repository)
+}
+
+// Validate rejects sources git could misread as options or fetch over transports other
+// than http(s), ssh and git. Local repositories must lie under one of roots.
+func (s GitSource) Validate(roots []string) error {
+	switch {
+	case s.Repository == "":
+		return fmt.Errorf("repository is required")
+	case s.Local():
+		if !underRoot(s.Repository, roots) {
+			return fmt.Errorf("local repository %q is not under an allowed directory", s.Repository)
+		}
+	case scpLikeRepo.MatchString(s.Repository):
+	default:
+		u, err := url.Parse(s.Repository)
+		if err != nil || u.Scheme == "" {
+			return fmt.Errorf("repository %q is not a URL or absolute path", s.Repository)
+		}
+		switch u.Scheme {
+		case "http", "https", "ssh", "git":
+		default:
+			return fmt.Errorf("repository scheme %q is not supported", u.Scheme)
+		}
+		if u.Host == "" {
+			return fmt.Errorf("repository URL %q has no host", s.Repository)
+		}
+	}
+	if s.Ref != "" && (!gitRef.MatchString(s.Ref) || strings.Contains(s.Ref, "..")) {
+		return fmt.Errorf("invalid ref %q", s.Ref)
+	}
+	if _, err := contextPath(s.Subdir); err != nil {
+		return fmt.Errorf("subdir %q must be a relative path inside the repository", s.Subdir)
+	}
+	return nil
+}
+
+func underRoot(p string, roots []string) bool {
+	p, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return false
+	}
+	for _, root := range roots {
+		root, err := filepath.EvalSymlinks(root)
+		if err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(root, p); err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckoutGit fetches the source's commit into the empty directory dir and returns the
+// build context directory inside it. Only the requested commit is fetched when the
+// remote allows it.
+func CheckoutGit(ctx context.Context, src GitSource, dir string) (string, error) {
+	protocols := "http:https:ssh:git"
+	if src.Local() {
+		protocols = "file"
+	}
+	git := func(args ...string) error {
+		cmd := exec.CommandContext(ctx, "git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_ALLOW_PROTOCOL="+protocols)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			if msg := strings.TrimSpace(string(out)); msg != "" {
+				return fmt.Errorf("git %s: %s", args[0], msg)
+			}
+			return fmt.Errorf("git %s: %w", args[0], err)
+		}
+		return nil
+	}
+	ref := src.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	if err := git("init", "-q"); err != nil {
+		return "", err
+	}
+	if err := git("fetch", "-q", "--depth", "1", "--", src.Repository, ref); err != nil {
+		// servers may refuse to fetch a commit by ID; fetch everything and look it up
+		if git("fetch", "-q", "--tags", "--", src.Repository, "+refs/heads/*:refs/remotes/origin/*") != nil {
+			return "", err
+		}
+		if git("checkout", "-q", ref) != nil {
+			return "", err
+		}
+	} else if err := git("checkout", "-q", "FETCH_HEAD"); err != nil {
+		return "", err
+	}
+
+	contextDir := filepath.Join(dir, filepath.FromSlash(src.Subdir))
+	info, err := os.Stat(contextDir)
+	// a symlinked subdir could point anywhere on the server
+	if err != nil || !info.IsDir() || !underRoot(contextDir, []string{dir}) {
+		return "", fmt.Errorf("subdir %q is not a directory in the repository", src.Subdir)
+	}
+	return contextDir, nil
+}
+
+// TarBuildContext streams dir as a build context archive, leaving out the .git directory
+// and whatever .dockerignore excludes. The Dockerfile and .dockerignore are always sent,
+// as the daemon needs them.
+func TarBuildContext(dir, dockerfile string) (io.ReadCloser, error) {
+	var excludes []string
+	f, err := os.Open(filepath.Join(dir, ".dockerignore"))
+	switch {
+	case err == nil:
+		excludes, err = ignorefile.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading .dockerignore: %w", err)
+		}
+	case !errors.Is(err, fs.ErrNotExist):
+		return nil, err
+	}
+	pm, err := patternmatcher.New(excludes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid .dockerignore: %w", err)
+	}
+	keep := map[string]bool{".dockerignore": true}
+	if name, err := contextPath(dockerfile); err == nil {
+		keep[name] = true
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeContextTar(pw, dir, pm, keep))
+	}()
+	return pr, nil
+}
+
+func writeContextTar(w io.Writer, dir string, pm *patternmatcher.PatternMatcher, keep map[string]bool) error {
+	tw := tar.NewWriter(w)
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if name == ".git" {
+			return filepath.SkipDir
+		}
+		if !keep[name] {
+			excluded, err := pm.MatchesOrParentMatches(name)
+			if err != nil {
+				return err
+			}
+			if excluded {
+				// with exclusion patterns a file below may still be wanted
+				if d.IsDir() && !pm.Exclusions() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		var link string
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		hdr.Name = name
+		if d.IsDir() {
+			hdr.Name += "/"
+		}
+		hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = 0, 0, "", ""
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		file, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(tw, file)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGitSourceValidate(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	repo := filepath.Join(root, "app")
+	if err := os.Mkdir(repo, 0755); err != nil {
+		t.Fatal(err)
+	}
+	escape := filepath.Join(root, "escape")
+	if err := os.Symlink(outside, escape); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		src     GitSource
+		wantErr bool
+	}{
+		{"https url", GitSource{Repository: "https://github.com/org/app.git"}, false},
+		{"http url", GitSource{Repository: "http://git.internal/app.git"}, false},
+		{"ssh url", GitSource{Repository: "ssh://git@github.com/org/app.git"}, false},
+		{"git url", GitSource{Repository: "git://git.internal/app.git"}, false},
+		{"scp-like", GitSource{Repository: "git@github.com:org/app.git"}, false},
+		{"ref and subdir", GitSource{Repository: "https://github.com/org/app.git", Ref: "release/1.2", Subdir: "docker/api"}, false},
+		{"local repo under root", GitSource{Repository: repo}, false},
+		{"root itself", GitSource{Repository: root}, false},
+
+		{"empty", GitSource{}, true},
+		{"file scheme", GitSource{Repository: "file:///etc"}, true},
+		{"ext transport", GitSource{Repository: "ext::sh -c touch% /tmp/pwned"}, true},
+		{"option-like", GitSource{Repository: "--upload-pack=touch /tmp/pwned"}, true},
+		{"relative path", GitSource{Repository: "app"}, true},
+		{"url without host", GitSource{Repository: "https:///org/app.git"}, true},
+		{"local repo outside roots", GitSource{Repository: outside}, true},
+		{"symlink out of root", GitSource{Repository: escape}, true},
+		{"dot-dot out of root", GitSource{Repository: filepath.Join(repo, "..", "..")}, true},
+		{"missing local repo", GitSource{Repository: filepath.Join(root, "missing")}, true},
+		{"ref with option", GitSource{Repository: "https://github.com/org/app.git", Ref: "--orphan"}, true},
+		{"ref with dot-dot", GitSource{Repository: "https://github.com/org/app.git", Ref: "main..dev"}, true},
+		{"ref with space", GitSource{Repository: "https://github.com/org/app.git", Ref: "main dev"}, true},
+		{"absolute subdir", GitSource{Repository: "https://github.com/org/app.git", Subdir: "/etc"}, true},
+		{"subdir escaping", GitSource{Repository: "https://github.com/org/app.git", Subdir: "docker/../../x"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.src.Validate([]string{root})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate(%+v) error = %v, want error %v", tt.src, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGitSourceValidateWithoutRoots(t *testing.T) {
+	if err := (GitSource{Repository: t.TempDir()}).Validate(nil); err == nil {
+		t.Error("local repository accepted with no allowed roots")
+	}
+}
@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+)
+
+// MaskedValue replaces secret values in API responses.
+const MaskedValue = "********"
+
+// DefaultSecretPatterns are always matched against environment variable names; configured
+// patterns add to them.
+var DefaultSecretPatterns = []string{"PASSWORD", "PASSWD", "SECRET", "TOKEN", "KEY", "CREDENTIAL", "PRIVATE"}
+
+// SecretMatcher decides whether a variable name looks like it holds a secret.
+// Patterns are case-insensitive substrings of the name.
+type SecretMatcher struct {
+	patterns []string
+}
+
+// NewSecretMatcher builds a matcher from DefaultSecretPatterns and any extra patterns.
+func NewSecretMatcher(patterns []string) *SecretMatcher {
+	m := &SecretMatcher{patterns: append([]string{}, DefaultSecretPatterns...)}
+	for _, p := range patterns {
+		if p = strings.TrimSpace(p); p != "" {
+			m.patterns = append(m.patterns, strings.ToUpper(p))
+		}
+	}
+	return m
+}
+
+// ParseSecretPatterns splits a comma-separated pattern list such as "PASSWORD,TOKEN,API_KEY".
+func ParseSecretPatterns(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+// IsSecret reports whether name matches any pattern.
+func (m *SecretMatcher) IsSecret(name string) bool {
+	upper := strings.ToUpper(name)
+	for _, p := range m.patterns {
+		if strings.Contains(upper, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// assignment matches NAME=value words in a command line, with the value optionally quoted.
+var assignment = regexp.MustCompile(`([A-Za-z_][A-Za-z0-9_]*)=("[^"]*"|'[^']*'|[^\s"']+)`)
+
+// MaskAssignments masks the values of NAME=value words in s whose name is secret, such as the
+// build arguments and inline ENV settings recorded in image history.
+func (m *SecretMatcher) MaskAssignments(s string) string {
+	return assignment.ReplaceAllStringFunc(s, func(a string) string {
+		name, _, _ := strings.Cut(a, "=")
+		if !m.IsSecret(name) {
+			return a
+		}
+		return name + "=" + MaskedValue
+	})
+}